@@ -0,0 +1,87 @@
+package main
+
+import (
+	"time"
+)
+
+const (
+	activeExpireCycleInterval = 100 * time.Millisecond
+	// activeExpireKeysPerLoop is the number of volatile keys sampled at a
+	// time by the active expire cycle.
+	activeExpireKeysPerLoop = 20
+	// activeExpireAcceptableStale is the percentage of expired keys in a
+	// sample under which the cycle stops, as most of the remaining keys are
+	// likely not expired either.
+	activeExpireAcceptableStale = 10
+	// activeExpireTimeLimit bounds how long one cycle holds dataMu.
+	activeExpireTimeLimit = 25 * time.Millisecond
+)
+
+// activeExpireCycle periodically removes expired keys and hash fields, so
+// data that is never read again does not linger in memory.
+func (s *server) activeExpireCycle() {
+	ticker := time.NewTicker(activeExpireCycleInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		s.activeExpire()
+		s.flushKeyspaceEvents()
+	}
+}
+
+// activeExpire samples volatile keys until a sample is mostly free of
+// expired keys or the time limit is reached, like the activeExpireCycle of
+// Redis, so that a cycle never scans the whole keyspace.
+func (s *server) activeExpire() {
+	s.execMu.RLock()
+	defer s.execMu.RUnlock()
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	start := time.Now()
+	for {
+		sampled, expired := s.activeExpireSample()
+		if sampled == 0 || expired*100 <= sampled*activeExpireAcceptableStale {
+			return
+		}
+		if time.Since(start) >= activeExpireTimeLimit {
+			return
+		}
+	}
+}
+
+// activeExpireSample expires the keys and hash fields of up to
+// activeExpireKeysPerLoop volatile keys, and returns the number of keys
+// sampled along with how many of them had expired data. Keys left without
+// any TTL are no longer tracked.
+func (s *server) activeExpireSample() (sampled, expired int) {
+	// Map iteration starts at a random key, which makes a random sample.
+	for key := range s.volatileKeys {
+		if sampled == activeExpireKeysPerLoop {
+			break
+		}
+		sampled++
+
+		expVal, ok := s.data[key]
+		if !ok {
+			delete(s.volatileKeys, key)
+			continue
+		}
+
+		if s.expireIfNeeded(key) {
+			expired++
+			continue
+		}
+
+		if expVal.IsHash() && s.expireHashFieldsIfNeeded(key, expVal.Hash) {
+			expired++
+		}
+
+		if _, ok := s.data[key]; !ok || !hasVolatileData(expVal) {
+			delete(s.volatileKeys, key)
+		}
+	}
+
+	return sampled, expired
+}
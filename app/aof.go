@@ -0,0 +1,552 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/rdb"
+)
+
+// Policies for syncing the append-only file to disk, chosen with
+// appendfsync.
+const (
+	appendFsyncAlways = iota
+	appendFsyncEverysec
+	appendFsyncNo
+)
+
+const aofFsyncInterval = time.Second
+
+var errInvalidAppendFsync = errors.New("argument(s) must be one of the following: always, everysec, no")
+
+func parseAppendFsync(val string) (int, error) {
+	switch strings.ToLower(val) {
+	case "always":
+		return appendFsyncAlways, nil
+	case "everysec":
+		return appendFsyncEverysec, nil
+	case "no":
+		return appendFsyncNo, nil
+	default:
+		return 0, errInvalidAppendFsync
+	}
+}
+
+func formatAppendFsync(policy int) string {
+	switch policy {
+	case appendFsyncAlways:
+		return "always"
+	case appendFsyncNo:
+		return "no"
+	default:
+		return "everysec"
+	}
+}
+
+// States of the append-only file. While it is turned on at runtime, writes
+// are only logged once the rewrite creating its base file has started.
+const (
+	aofOff = iota
+	aofOn
+	aofWaitRewrite
+)
+
+// appendOnlyFile logs every write to the dataset in RESP format, to be
+// replayed at startup. Guarded by mu, except for the replay progress.
+type appendOnlyFile struct {
+	mu    *sync.Mutex
+	state int
+	// manifest lists the files of the append-only file, and file is the
+	// incremental file writes are appended to.
+	manifest *aofManifest
+	file     *os.File
+	// unsynced is set when data was written since the last fsync.
+	unsynced    bool
+	lastWriteOk bool
+	// currentSize is the size of the files of the append-only file, and
+	// baseSize what it was after the last rewrite, or at startup.
+	currentSize int64
+	baseSize    int64
+	// loaded and total track the progress of the replay, in bytes, and
+	// loadingBase is the base file being loaded, if it is an RDB file.
+	loaded      atomic.Int64
+	total       atomic.Int64
+	loadingBase atomic.Pointer[rdb.RDBFile]
+}
+
+func newAppendOnlyFile() *appendOnlyFile {
+	return &appendOnlyFile{
+		mu:          &sync.Mutex{},
+		lastWriteOk: true,
+	}
+}
+
+func (a *appendOnlyFile) loadProgress() (loaded, total int64) {
+	loaded = a.loaded.Load()
+	if base := a.loadingBase.Load(); base != nil {
+		baseLoaded, _ := base.LoadProgress()
+		loaded += baseLoaded
+	}
+	return loaded, a.total.Load()
+}
+
+// loadAppendOnlyFile loads the files listed in the manifest of the
+// append-only file, upgrading a single-file append-only file first.
+func (s *server) loadAppendOnlyFile() error {
+	if err := s.upgradeAppendOnlyFile(); err != nil {
+		return err
+	}
+
+	m, err := s.loadAofManifest()
+	if errors.Is(err, fs.ErrNotExist) {
+		s.aof.manifest = &aofManifest{}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	files := m.files()
+
+	total, err := s.aofSize(m)
+	if err != nil {
+		return err
+	}
+	s.aof.total.Store(total)
+
+	for i, info := range files {
+		if err := s.loadAofFile(info, i == len(files)-1); err != nil {
+			return fmt.Errorf("%s: %w", info.name, err)
+		}
+	}
+
+	// The last file may have been truncated.
+	size, err := s.aofSize(m)
+	if err != nil {
+		return err
+	}
+
+	s.aof.mu.Lock()
+	s.aof.manifest = m
+	s.aof.currentSize, s.aof.baseSize = size, size
+	s.aof.mu.Unlock()
+
+	return nil
+}
+
+// loadAofFile loads a file of the append-only file. Base files are either
+// RDB files, as written by rewrites, or logs of commands.
+func (s *server) loadAofFile(info *aofFileInfo, last bool) error {
+	path := s.aofFilePath(info.name)
+
+	if info.fileType == aofBaseFile {
+		isRDB, err := isRDBFile(path)
+		if err != nil {
+			return err
+		}
+
+		if isRDB {
+			base := rdb.NewRDBFile(s.aofDir(), info.name)
+			s.aof.loadingBase.Store(base)
+			defer s.aof.loadingBase.Store(nil)
+
+			if err := s.loadRDB(base); err != nil {
+				return err
+			}
+			_, size := base.LoadProgress()
+			s.aof.loaded.Add(size)
+			return nil
+		}
+	}
+
+	return s.replayAppendOnlyFile(path, last)
+}
+
+func isRDBFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	header := make([]byte, 5)
+	n, err := io.ReadFull(file, header)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, err
+	}
+
+	return string(header[:n]) == "REDIS", nil
+}
+
+// aofSize returns the total size of the files listed in m.
+func (s *server) aofSize(m *aofManifest) (int64, error) {
+	var size int64
+	for _, info := range m.files() {
+		stat, err := os.Stat(s.aofFilePath(info.name))
+		if err != nil {
+			return 0, err
+		}
+		size += stat.Size()
+	}
+	return size, nil
+}
+
+// upgradeAppendOnlyFile moves a single-file append-only file, as written by
+// Redis before 7.0, into the directory of the multi-part layout, where it
+// becomes the base file. The manifest is written last, so that an upgrade
+// cut short by a crash is completed at the next startup.
+func (s *server) upgradeAppendOnlyFile() error {
+	legacy := filepath.Join(s.rdbFile.Dir, s.appendFilename)
+	base := s.aofFilePath(s.appendFilename)
+
+	if _, err := os.Stat(s.aofFilePath(s.aofManifestName())); err == nil {
+		return nil
+	}
+
+	if _, err := os.Stat(legacy); err == nil {
+		if err := os.MkdirAll(s.aofDir(), 0o755); err != nil {
+			return err
+		}
+		if err := os.Rename(legacy, base); err != nil {
+			return err
+		}
+		if err := syncDir(s.rdbFile.Dir); err != nil {
+			return err
+		}
+	}
+
+	if _, err := os.Stat(base); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	fmt.Printf("Upgrading the append only file %s to the multi part layout\n", legacy)
+
+	return s.persistAofManifest(&aofManifest{
+		base:    &aofFileInfo{name: s.appendFilename, seq: 1, fileType: aofBaseFile},
+		baseSeq: 1,
+	})
+}
+
+// openAppendOnlyFile opens the last incremental file for appending, creating
+// one if there is none, and deletes the files left from the last rewrite,
+// including the temporary ones of a rewrite cut short. Writes are only
+// logged from then on.
+func (s *server) openAppendOnlyFile() error {
+	s.aof.mu.Lock()
+	defer s.aof.mu.Unlock()
+
+	m := s.aof.manifest
+
+	if err := os.MkdirAll(s.aofDir(), 0o755); err != nil {
+		return err
+	}
+
+	if len(m.incrs) == 0 {
+		name := s.aofIncrName(m.incrSeq + 1)
+		file, err := createAofFile(s.aofFilePath(name))
+		if err != nil {
+			return err
+		}
+		file.Close()
+
+		m.addIncr(name)
+		if err := s.persistAofManifest(m); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.OpenFile(s.aofFilePath(m.incrs[len(m.incrs)-1].name), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	s.aof.file = file
+	s.aof.state = aofOn
+	s.deleteAofHistory(m)
+
+	temps, _ := filepath.Glob(s.aofFilePath("temp-*"))
+	for _, temp := range temps {
+		os.Remove(temp)
+	}
+
+	return nil
+}
+
+// createAofFile creates an empty file and syncs its directory, so that the
+// file exists for good before the manifest lists it.
+func createAofFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
+
+// closeAppendOnlyFile syncs and closes the file writes are appended to.
+// Callers must hold aof.mu.
+func (s *server) closeAppendOnlyFile() {
+	if s.aof.file == nil {
+		return
+	}
+
+	if err := s.aof.file.Sync(); err != nil {
+		fmt.Println("Error syncing the append only file: ", err)
+	}
+	s.aof.file.Close()
+	s.aof.file = nil
+	s.aof.unsynced = false
+}
+
+// startAppendOnly turns on the append-only file at runtime. It only holds
+// the writes made after the dataset is snapshot by a rewrite, which is
+// started right away unless another background job is in progress. Callers
+// must hold execMu exclusively.
+func (s *server) startAppendOnly() error {
+	s.persistence.mu.Lock()
+	defer s.persistence.mu.Unlock()
+
+	s.aof.mu.Lock()
+	if s.aof.state != aofOff {
+		s.aof.mu.Unlock()
+		return nil
+	}
+	s.aof.state = aofWaitRewrite
+	s.aof.mu.Unlock()
+
+	s.appendOnly.Store(true)
+
+	if s.persistence.bgsaveInProgress || s.persistence.aofRewriteInProgress {
+		s.persistence.aofRewriteScheduled = true
+		return nil
+	}
+
+	if err := s.startAofRewrite(); err != nil {
+		s.aof.mu.Lock()
+		s.aof.state = aofOff
+		s.aof.mu.Unlock()
+
+		s.appendOnly.Store(false)
+		return err
+	}
+
+	return nil
+}
+
+// stopAppendOnly turns off the append-only file at runtime. A rewrite in
+// progress still replaces the base file, but no longer logs writes.
+func (s *server) stopAppendOnly() {
+	s.aof.mu.Lock()
+	defer s.aof.mu.Unlock()
+
+	s.closeAppendOnlyFile()
+	s.aof.state = aofOff
+	s.appendOnly.Store(false)
+}
+
+// feedAppendOnlyFile appends resp to the append-only file, if it is open.
+// Under the always policy, the file is synced before returning, and so
+// before the client gets its reply.
+func (s *server) feedAppendOnlyFile(resp []byte) {
+	s.aof.mu.Lock()
+	defer s.aof.mu.Unlock()
+
+	if s.aof.file == nil {
+		return
+	}
+
+	n, err := s.aof.file.Write(resp)
+	s.aof.currentSize += int64(n)
+	if err == nil {
+		if s.appendFsync.Load() == appendFsyncAlways {
+			err = s.aof.file.Sync()
+		} else {
+			s.aof.unsynced = true
+		}
+	}
+
+	s.aof.lastWriteOk = err == nil
+	if err != nil {
+		fmt.Println("Error writing to the append only file: ", err)
+	}
+}
+
+// aofFsyncCron syncs the append-only file once per second under the
+// everysec policy. Under the no policy, the operating system decides.
+func (s *server) aofFsyncCron() {
+	ticker := time.NewTicker(aofFsyncInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if s.appendFsync.Load() != appendFsyncEverysec {
+			continue
+		}
+
+		s.aof.mu.Lock()
+		if s.aof.file != nil && s.aof.unsynced {
+			err := s.aof.file.Sync()
+			s.aof.unsynced = err != nil
+			s.aof.lastWriteOk = err == nil
+			if err != nil {
+				fmt.Println("Error syncing the append only file: ", err)
+			}
+		}
+		s.aof.mu.Unlock()
+	}
+}
+
+// replayAppendOnlyFile replays the commands of a file of the append-only
+// file. If it is the last one, a last command cut short, as left by a crash
+// in the middle of a write, is dropped and truncated from the file if
+// aof-load-truncated is set. So is a transaction missing its EXEC. A
+// malformed command is never truncated, wherever it is, as the commands
+// following it would be lost.
+func (s *server) replayAppendOnlyFile(path string, last bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	client := NewClient(nil)
+	client.isAOFClient = true
+
+	start := s.aof.loaded.Load()
+	r := bufio.NewReader(file)
+	buf := make([]byte, 1<<16)
+	var pending []byte
+	// valid is the offset up to which commands were replayed, and
+	// validBeforeMulti the one before the current transaction.
+	var valid, validBeforeMulti int64
+
+	for {
+		n, readErr := r.Read(buf)
+		pending = append(pending, buf[:n]...)
+
+		for len(pending) > 0 {
+			if pending[0] != '*' {
+				return fmt.Errorf("bad file format reading the append only file at byte %d", valid)
+			}
+
+			cmd, size, err := parseRespArray(pending)
+			if err == nil && size > 0 && (cmd == nil || len(cmd.parts) == 0) {
+				err = errInvalidMultibulkLength
+			}
+			if err != nil {
+				return fmt.Errorf("bad file format reading the append only file at byte %d: %w", valid, err)
+			}
+			if size == 0 {
+				break
+			}
+
+			if len(cmd.parts) > 0 && strings.EqualFold(cmd.parts[0], cmdMulti) {
+				validBeforeMulti = valid
+			}
+			// Only commands that succeeded are logged, so an error here
+			// means the file does not match the dataset it was logged for.
+			if err := s.handleCommand(client, cmd); err != nil {
+				fmt.Println("cmd error: ", err)
+			}
+
+			pending = pending[size:]
+			valid += int64(size)
+			s.aof.loaded.Store(start + valid)
+		}
+
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+
+	if client.Transaction.IsOpen() {
+		valid = validBeforeMulti
+	} else if len(pending) == 0 {
+		return nil
+	}
+
+	// Only the last file is being written to, so a truncated command
+	// anywhere else is corruption.
+	if !last || !s.aofLoadTruncated.Load() {
+		return fmt.Errorf("unexpected end of file reading the append only file at byte %d", valid)
+	}
+
+	fmt.Printf("!!! Warning: short read while loading the AOF file %s!!! Truncating the AOF at offset %d\n", path, valid)
+
+	// Commands of an unfinished transaction were only queued, so dropping
+	// them leaves the dataset as loaded so far.
+	return os.Truncate(path, valid)
+}
+
+// aofCommand returns cmd with its relative expiries turned into absolute
+// ones, so that replaying the append-only file later does not extend them.
+func aofCommand(cmd *command) *command {
+	args := append([]string(nil), cmd.args...)
+
+	switch cmd.name {
+	case cmdSet:
+		if len(args) >= 4 && strings.EqualFold(args[2], "px") {
+			if at, err := parseExpiryTime(args[3], time.Millisecond, false); err == nil {
+				args[2], args[3] = "PXAT", strconv.FormatInt(at.UnixMilli(), 10)
+				return &command{name: cmd.name, args: args}
+			}
+		}
+	case cmdHExpire, cmdHPExpire, cmdHExpireAt:
+		unit, absolute := time.Second, cmd.name == cmdHExpireAt
+		if cmd.name == cmdHPExpire {
+			unit = time.Millisecond
+		}
+		if len(args) >= 2 {
+			if at, err := parseExpiryTime(args[1], unit, absolute); err == nil {
+				args[1] = strconv.FormatInt(at.UnixMilli(), 10)
+				return &command{name: cmdHPExpireAt, args: args}
+			}
+		}
+	case cmdRestore:
+		absolute := false
+		for _, arg := range args[3:] {
+			absolute = absolute || strings.EqualFold(arg, "absttl")
+		}
+		if ttl, err := strconv.ParseInt(args[1], 10, 64); err == nil && ttl > 0 && !absolute {
+			args[1] = strconv.FormatInt(time.Now().Add(time.Duration(ttl)*time.Millisecond).UnixMilli(), 10)
+			return &command{name: cmd.name, args: append(args, "ABSTTL")}
+		}
+	case cmdHSetEx, cmdHGetEx:
+		for i := 1; i+1 < len(args) && !strings.EqualFold(args[i], "fields"); i++ {
+			unit, absolute := time.Second, false
+			switch strings.ToLower(args[i]) {
+			case "ex":
+			case "px":
+				unit = time.Millisecond
+			case "exat":
+				absolute = true
+			default:
+				continue
+			}
+
+			if at, err := parseExpiryTime(args[i+1], unit, absolute); err == nil {
+				args[i], args[i+1] = "PXAT", strconv.FormatInt(at.UnixMilli(), 10)
+				return &command{name: cmd.name, args: args}
+			}
+		}
+	}
+
+	return cmd
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Types of the files listed in the manifest of the append-only file.
+const (
+	aofBaseFile    = 'b'
+	aofIncrFile    = 'i'
+	aofHistoryFile = 'h'
+)
+
+// aofFileInfo is a file of the append-only file, as listed in its manifest.
+type aofFileInfo struct {
+	name     string
+	seq      int64
+	fileType byte
+}
+
+// aofManifest lists the files making up the append-only file, in the Redis 7
+// multi-part layout: a base file holding a snapshot of the dataset, in RDB
+// or AOF format, followed by the incremental files logging the writes made
+// since, in order. History files are the ones replaced by a rewrite, and
+// are only listed until they are deleted.
+type aofManifest struct {
+	base    *aofFileInfo
+	incrs   []*aofFileInfo
+	history []*aofFileInfo
+	// baseSeq and incrSeq are the sequence numbers of the last base and
+	// incremental files created.
+	baseSeq int64
+	incrSeq int64
+}
+
+func (s *server) aofDir() string {
+	return filepath.Join(s.rdbFile.Dir, s.appendDirname)
+}
+
+func (s *server) aofFilePath(name string) string {
+	return filepath.Join(s.aofDir(), name)
+}
+
+func (s *server) aofManifestName() string {
+	return s.appendFilename + ".manifest"
+}
+
+func (s *server) aofBaseName(seq int64) string {
+	return fmt.Sprintf("%s.%d.base.rdb", s.appendFilename, seq)
+}
+
+func (s *server) aofIncrName(seq int64) string {
+	return fmt.Sprintf("%s.%d.incr.aof", s.appendFilename, seq)
+}
+
+// files returns the base file, if any, followed by the incremental files, in
+// the order they are loaded.
+func (m *aofManifest) files() []*aofFileInfo {
+	files := make([]*aofFileInfo, 0, len(m.incrs)+1)
+	if m.base != nil {
+		files = append(files, m.base)
+	}
+	return append(files, m.incrs...)
+}
+
+// clone returns a copy of m that can be changed without affecting m, so that
+// m is kept if the copy can not be persisted.
+func (m *aofManifest) clone() *aofManifest {
+	c := &aofManifest{baseSeq: m.baseSeq, incrSeq: m.incrSeq}
+	if m.base != nil {
+		base := *m.base
+		c.base = &base
+	}
+	for _, incr := range m.incrs {
+		info := *incr
+		c.incrs = append(c.incrs, &info)
+	}
+	for _, history := range m.history {
+		info := *history
+		c.history = append(c.history, &info)
+	}
+	return c
+}
+
+// addIncr records a new incremental file, written after the others.
+func (m *aofManifest) addIncr(name string) {
+	m.incrSeq++
+	m.incrs = append(m.incrs, &aofFileInfo{name: name, seq: m.incrSeq, fileType: aofIncrFile})
+}
+
+// setBase records the base file written by a rewrite. The previous base file
+// and every incremental file but the last keep are moved to the history.
+func (m *aofManifest) setBase(name string, seq int64, keep int) {
+	if m.base != nil {
+		m.base.fileType = aofHistoryFile
+		m.history = append(m.history, m.base)
+	}
+	m.base = &aofFileInfo{name: name, seq: seq, fileType: aofBaseFile}
+	m.baseSeq = seq
+
+	keep = min(keep, len(m.incrs))
+	for _, incr := range m.incrs[:len(m.incrs)-keep] {
+		incr.fileType = aofHistoryFile
+		m.history = append(m.history, incr)
+	}
+	m.incrs = append([]*aofFileInfo(nil), m.incrs[len(m.incrs)-keep:]...)
+}
+
+func (m *aofManifest) encode() []byte {
+	var buf bytes.Buffer
+	for _, info := range append(m.files(), m.history...) {
+		fmt.Fprintf(&buf, "file %s seq %d type %c\n", info.name, info.seq, info.fileType)
+	}
+	return buf.Bytes()
+}
+
+var errAofManifest = errors.New("invalid append only file manifest")
+
+// parseAofManifest reads a manifest made of one line per file, each a list
+// of key and value pairs. Unknown keys are ignored, as are empty lines and
+// comments.
+func parseAofManifest(data []byte) (*aofManifest, error) {
+	m := &aofManifest{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields)%2 != 0 {
+			return nil, fmt.Errorf("%w: odd number of fields on line %d", errAofManifest, line)
+		}
+
+		info := &aofFileInfo{}
+		for i := 0; i < len(fields); i += 2 {
+			switch val := fields[i+1]; fields[i] {
+			case "file":
+				info.name = val
+			case "seq":
+				seq, err := strconv.ParseInt(val, 10, 64)
+				if err != nil || seq < 0 {
+					return nil, fmt.Errorf("%w: invalid sequence number on line %d", errAofManifest, line)
+				}
+				info.seq = seq
+			case "type":
+				if len(val) != 1 {
+					return nil, fmt.Errorf("%w: invalid file type on line %d", errAofManifest, line)
+				}
+				info.fileType = val[0]
+			}
+		}
+
+		if checkFilename(info.name) != nil {
+			return nil, fmt.Errorf("%w: invalid file name on line %d", errAofManifest, line)
+		}
+
+		switch info.fileType {
+		case aofBaseFile:
+			if m.base != nil {
+				return nil, fmt.Errorf("%w: more than one base file", errAofManifest)
+			}
+			m.base = info
+			m.baseSeq = info.seq
+		case aofIncrFile:
+			if info.seq <= m.incrSeq {
+				return nil, fmt.Errorf("%w: incremental files out of order on line %d", errAofManifest, line)
+			}
+			m.incrs = append(m.incrs, info)
+			m.incrSeq = info.seq
+		case aofHistoryFile:
+			m.history = append(m.history, info)
+		default:
+			return nil, fmt.Errorf("%w: unknown file type on line %d", errAofManifest, line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if m.base == nil && len(m.incrs) == 0 {
+		return nil, fmt.Errorf("%w: no base or incremental file", errAofManifest)
+	}
+
+	return m, nil
+}
+
+// loadAofManifest reads the manifest of the append-only file. It returns
+// os.ErrNotExist if there is none.
+func (s *server) loadAofManifest() (*aofManifest, error) {
+	data, err := os.ReadFile(s.aofFilePath(s.aofManifestName()))
+	if err != nil {
+		return nil, err
+	}
+
+	return parseAofManifest(data)
+}
+
+// persistAofManifest replaces the manifest with m. It is written and synced
+// under a temporary name, then renamed over the previous one, so that a
+// crash leaves either manifest in place, each listing files that exist.
+func (s *server) persistAofManifest(m *aofManifest) error {
+	tmp, err := os.CreateTemp(s.aofDir(), "temp-*.manifest")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	if _, err := tmp.Write(m.encode()); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), s.aofFilePath(s.aofManifestName())); err != nil {
+		return err
+	}
+
+	return syncDir(s.aofDir())
+}
+
+// deleteAofHistory removes the files replaced by the last rewrite.
+func (s *server) deleteAofHistory(m *aofManifest) {
+	for _, info := range m.history {
+		err := os.Remove(s.aofFilePath(info.name))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			fmt.Println("Error removing append only file history: ", err)
+		}
+	}
+
+	if len(m.history) == 0 {
+		return
+	}
+
+	m.history = nil
+	if err := s.persistAofManifest(m); err != nil {
+		fmt.Println("Error writing the append only file manifest: ", err)
+	}
+}
+
+// syncDir makes the renames within dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/rdb"
+)
+
+var errAofRewriteInProgress = errors.New("Background append only file rewriting already in progress")
+
+// bgrewriteAppendOnlyFile rewrites the append-only file in the background,
+// or schedules the rewrite if a background save is in progress, which it
+// reports. Callers must hold execMu exclusively.
+func (s *server) bgrewriteAppendOnlyFile() (scheduled bool, err error) {
+	s.persistence.mu.Lock()
+	defer s.persistence.mu.Unlock()
+
+	if s.persistence.aofRewriteInProgress {
+		return false, errAofRewriteInProgress
+	}
+
+	if s.persistence.bgsaveInProgress {
+		s.persistence.aofRewriteScheduled = true
+		return true, nil
+	}
+
+	return false, s.startAofRewrite()
+}
+
+// startAofRewrite replaces the base file of the append-only file with a
+// snapshot of the dataset, written in the background. Writes made from then
+// on go to a new incremental file, so that the new base file and it hold the
+// whole dataset, while the files they replace still do until the manifest
+// is switched to them. A crash in the middle of a rewrite thus leaves the
+// previous files to load.
+//
+// When the append-only file is being turned on, the incremental file only
+// gets its final name once the base file is written, as the files listed in
+// the manifest do not hold the dataset.
+//
+// Callers must hold execMu exclusively, and persistence.mu.
+func (s *server) startAofRewrite() error {
+	s.aof.mu.Lock()
+	defer s.aof.mu.Unlock()
+
+	if s.aof.manifest == nil {
+		m, err := s.loadAofManifest()
+		if errors.Is(err, os.ErrNotExist) {
+			m = &aofManifest{}
+		} else if err != nil {
+			return err
+		}
+		s.aof.manifest = m
+	}
+	m := s.aof.manifest
+
+	if err := os.MkdirAll(s.aofDir(), 0o755); err != nil {
+		return err
+	}
+
+	// keep is the number of incremental files still listed once the base
+	// file is written.
+	var keep int
+	var tempIncr *os.File
+
+	switch s.aof.state {
+	case aofOn:
+		name := s.aofIncrName(m.incrSeq + 1)
+		file, err := createAofFile(s.aofFilePath(name))
+		if err != nil {
+			return err
+		}
+
+		m.addIncr(name)
+		if err := s.persistAofManifest(m); err != nil {
+			file.Close()
+			return err
+		}
+
+		s.closeAppendOnlyFile()
+		s.aof.file = file
+		keep = 1
+	case aofWaitRewrite:
+		file, err := createAofFile(s.aofFilePath("temp-" + s.aofIncrName(m.incrSeq+1)))
+		if err != nil {
+			return err
+		}
+
+		s.aof.file = file
+		tempIncr = file
+	}
+
+	baseSeq := m.baseSeq + 1
+	aux, entries := s.rdbAuxFields(true), s.rdbSnapshot()
+	checksum := s.rdbChecksum.Load()
+	s.persistence.aofRewriteInProgress = true
+	s.persistence.aofRewriteScheduled = false
+	s.persistence.aofRewriteStart = time.Now()
+
+	go func() {
+		base := rdb.NewRDBFile(s.aofDir(), s.aofBaseName(baseSeq))
+		err := base.Save(aux, entries, checksum)
+		s.finishAofRewrite(base.DBFilename, baseSeq, keep, tempIncr, err)
+	}()
+
+	return nil
+}
+
+// finishAofRewrite lists the base file written by a rewrite in the manifest
+// and deletes the files it replaces, unless the rewrite failed.
+func (s *server) finishAofRewrite(baseName string, baseSeq int64, keep int, tempIncr *os.File, err error) {
+	s.persistence.mu.Lock()
+	defer s.persistence.mu.Unlock()
+
+	s.aof.mu.Lock()
+	defer s.aof.mu.Unlock()
+
+	s.persistence.aofRewriteInProgress = false
+
+	// A temporary incremental file is only used while the append-only file
+	// is being turned on, and still written to unless it was turned off
+	// since.
+	if tempIncr != nil && s.aof.file != tempIncr {
+		os.Remove(tempIncr.Name())
+		tempIncr = nil
+	}
+
+	if err == nil {
+		err = s.installAofRewrite(baseName, baseSeq, keep, tempIncr)
+	}
+
+	s.persistence.lastAofRewriteOk = err == nil
+	if err == nil {
+		fmt.Println("Background AOF rewrite finished successfully")
+		return
+	}
+
+	fmt.Println("Background AOF rewrite error: ", err)
+	os.Remove(s.aofFilePath(baseName))
+
+	if tempIncr != nil {
+		s.closeAppendOnlyFile()
+		os.Remove(tempIncr.Name())
+		s.aof.state = aofOff
+		s.appendOnly.Store(false)
+		fmt.Println("Unable to turn on the append only file")
+	}
+}
+
+// installAofRewrite switches the manifest to the base file written by a
+// rewrite. Callers must hold aof.mu.
+func (s *server) installAofRewrite(baseName string, baseSeq int64, keep int, tempIncr *os.File) error {
+	m := s.aof.manifest.clone()
+	m.setBase(baseName, baseSeq, keep)
+
+	if tempIncr != nil {
+		name := s.aofIncrName(m.incrSeq + 1)
+		if err := os.Rename(tempIncr.Name(), s.aofFilePath(name)); err != nil {
+			return err
+		}
+		m.addIncr(name)
+	}
+
+	if err := s.persistAofManifest(m); err != nil {
+		return err
+	}
+
+	s.aof.manifest = m
+	if tempIncr != nil {
+		s.aof.state = aofOn
+	}
+
+	s.deleteAofHistory(m)
+
+	size, err := s.aofSize(m)
+	if err != nil {
+		return err
+	}
+	s.aof.currentSize, s.aof.baseSize = size, size
+
+	return nil
+}
+
+// shouldAutoRewrite reports whether the append-only file grew enough since
+// the last rewrite to be rewritten, or a rewrite was scheduled.
+func (s *server) shouldAutoRewrite() bool {
+	p := s.persistence
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.bgsaveInProgress || p.aofRewriteInProgress {
+		return false
+	}
+	if p.aofRewriteScheduled {
+		return true
+	}
+
+	percentage := s.autoAofRewritePercentage.Load()
+	if percentage == 0 {
+		return false
+	}
+
+	s.aof.mu.Lock()
+	defer s.aof.mu.Unlock()
+
+	if s.aof.state != aofOn || s.aof.currentSize < s.autoAofRewriteMinSize.Load() {
+		return false
+	}
+
+	base := max(s.aof.baseSize, 1)
+	return (s.aof.currentSize-base)*100/base >= percentage
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/rdb"
+)
+
+// startAofServer starts a master on dir with the append-only file enabled,
+// loading whatever it holds, as it would at startup.
+func startAofServer(t *testing.T, dir string) (*server, error) {
+	t.Helper()
+
+	config := &serverConfig{
+		rdbFile:        rdb.NewRDBFile(dir, "dump.rdb"),
+		appendFilename: "appendonly.aof",
+		appendDirname:  "appendonlydir",
+	}
+	if err := config.parseReplicaOf(""); err != nil {
+		t.Fatal(err)
+	}
+	config.appendOnly.Store(true)
+	config.appendFsync.Store(appendFsyncAlways)
+	config.aofLoadTruncated.Store(true)
+
+	s := newServer(config)
+	t.Cleanup(func() {
+		if s.aof.file != nil {
+			s.aof.file.Close()
+		}
+	})
+
+	s.persistence.loading.Store(true)
+	return &s, s.loadDataFromDisk()
+}
+
+// run handles the commands as if sent by a client, discarding the replies.
+func run(t *testing.T, s *server, cmds ...[]string) {
+	t.Helper()
+
+	client := NewClient(nil)
+	client.isAOFClient = true
+	for _, parts := range cmds {
+		if err := s.handleCommand(client, &command{parts: parts}); err != nil {
+			t.Fatalf("%v: %v", parts, err)
+		}
+	}
+}
+
+// writeIncrAof writes the first incremental file of dir, along with a
+// manifest listing it.
+func writeIncrAof(t *testing.T, dir string, content string) string {
+	t.Helper()
+
+	s, err := startAofServer(t, dir)
+	if err != nil {
+		t.Fatalf("loadDataFromDisk() error = %v", err)
+	}
+
+	path := s.aofFilePath(s.aofIncrName(1))
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func encodeCommands(t *testing.T, cmds ...[]string) string {
+	t.Helper()
+
+	var b strings.Builder
+	for _, parts := range cmds {
+		resp, err := respAsArray(parts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(resp)
+	}
+
+	return b.String()
+}
+
+func TestAofRestartWithEmptyArgument(t *testing.T) {
+	dir := t.TempDir()
+
+	s, err := startAofServer(t, dir)
+	if err != nil {
+		t.Fatalf("loadDataFromDisk() error = %v", err)
+	}
+	run(t, s, []string{"SET", "a", ""}, []string{"SET", "b", "1"})
+
+	s, err = startAofServer(t, dir)
+	if err != nil {
+		t.Fatalf("loadDataFromDisk() after restart error = %v", err)
+	}
+
+	for key, want := range map[string]string{"a": "", "b": "1"} {
+		val, ok := s.data[key]
+		if !ok {
+			t.Errorf("key %q not loaded", key)
+			continue
+		}
+		if val.Val != want {
+			t.Errorf("key %q = %q, want %q", key, val.Val, want)
+		}
+	}
+}
+
+func TestAofTruncatedLastCommand(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := encodeCommands(t, []string{"SET", "a", "1"})
+	path := writeIncrAof(t, dir, valid+"*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$1")
+
+	s, err := startAofServer(t, dir)
+	if err != nil {
+		t.Fatalf("loadDataFromDisk() error = %v", err)
+	}
+
+	if _, ok := s.data["a"]; !ok {
+		t.Errorf("key %q not loaded", "a")
+	}
+	if _, ok := s.data["b"]; ok {
+		t.Errorf("key %q of the truncated command loaded", "b")
+	}
+
+	stat, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stat.Size() != int64(len(valid)) {
+		t.Errorf("file truncated to %d bytes, want %d", stat.Size(), len(valid))
+	}
+}
+
+func TestAofMalformedCommand(t *testing.T) {
+	dir := t.TempDir()
+
+	content := encodeCommands(t, []string{"SET", "a", "1"}) +
+		"*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$-1\r\n" +
+		encodeCommands(t, []string{"SET", "c", "1"})
+	path := writeIncrAof(t, dir, content)
+
+	if _, err := startAofServer(t, dir); err == nil || !strings.Contains(err.Error(), "bad file format") {
+		t.Fatalf("loadDataFromDisk() error = %v, want a bad file format", err)
+	}
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != content {
+		t.Errorf("file changed to %q, want it left as is", got)
+	}
+}
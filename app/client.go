@@ -1,15 +1,119 @@
 package main
 
-import "net"
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	resp2 = 2
+	resp3 = 3
+)
+
+var lastClientId atomic.Int64
 
 type Client struct {
 	net.Conn
 	Transaction *Transaction
+	id          int64
+	name        string
+	// protocol is the RESP version negotiated with HELLO.
+	protocol int
+	// writeMu serializes replies with messages published by other clients.
+	writeMu *sync.Mutex
+	// watchedKeys maps every key watched by the client to whether it was
+	// already expired when watched. Guarded by server.watchMu, like dirtyCAS.
+	watchedKeys map[string]bool
+	dirtyCAS    bool
+	// channels, patterns and shardChannels are the pub/sub subscriptions of
+	// the client. Guarded by pubSub.mu.
+	channels      map[string]struct{}
+	patterns      map[string]struct{}
+	shardChannels map[string]struct{}
+	// pushes queues the messages published to the client, which a
+	// goroutine of its own writes, so that publishers never wait for a slow
+	// subscriber. It is created with the first message, and guarded by
+	// pubSub.mu like pushesOverflowed.
+	pushes           chan []byte
+	pushesOverflowed bool
+	// isMasterLink is set on a replica for the connection to its master,
+	// which streams write commands and expects no replies.
+	isMasterLink bool
+	// isAOFClient is set on the client replaying the append-only file at
+	// startup, which has no connection.
+	isAOFClient bool
 }
 
 func NewClient(conn net.Conn) *Client {
 	return &Client{
-		Conn:        conn,
-		Transaction: NewTransaction(conn),
+		Conn:          conn,
+		Transaction:   NewTransaction(conn),
+		id:            lastClientId.Add(1),
+		protocol:      resp2,
+		writeMu:       &sync.Mutex{},
+		watchedKeys:   make(map[string]bool),
+		channels:      make(map[string]struct{}),
+		patterns:      make(map[string]struct{}),
+		shardChannels: make(map[string]struct{}),
+	}
+}
+
+// Write sends a reply to the client. Replies on the master link and to the
+// append-only file replay are dropped, except for REPLCONF ACK which is
+// written to the connection directly.
+func (c *Client) Write(b []byte) (int, error) {
+	if c.isMasterLink || c.isAOFClient {
+		return len(b), nil
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	return c.Conn.Write(b)
+}
+
+// maxQueuedPushes bounds the messages waiting to be written to a client.
+// A client falling further behind is disconnected, as Redis does with the
+// clients exceeding their pubsub output buffer limit.
+const maxQueuedPushes = 1024
+
+// push queues a published message, and reports whether it was queued.
+// Callers must hold pubSub.mu, which keeps messages in publishing order.
+func (c *Client) push(frame []byte) bool {
+	if c.pushesOverflowed {
+		return false
+	}
+
+	if c.pushes == nil {
+		c.pushes = make(chan []byte, maxQueuedPushes)
+		go c.writePushes(c.pushes)
+	}
+
+	select {
+	case c.pushes <- frame:
+		return true
+	default:
+		fmt.Println("Disconnecting a client that does not read the messages published to it")
+		c.pushesOverflowed = true
+		c.Conn.Close()
+		return false
+	}
+}
+
+// writePushes writes the queued messages until the queue is closed.
+func (c *Client) writePushes(pushes <-chan []byte) {
+	for frame := range pushes {
+		c.Write(frame)
+	}
+}
+
+// closePushes stops the goroutine writing queued messages, once it wrote
+// them. Callers must hold pubSub.mu.
+func (c *Client) closePushes() {
+	if c.pushes != nil {
+		close(c.pushes)
+		c.pushes = nil
 	}
 }
@@ -0,0 +1,63 @@
+//go:build linux || darwin
+
+package main
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// watchDisconnect returns a channel closed once the connection of the
+// client is closed by its peer. A blocked command uses it to give up
+// instead of waiting for its timeout, as nothing reads the connection
+// meanwhile. The connection is only peeked at, and watching stops at the
+// first byte received, which is left for the client to read once
+// unblocked. stop must be called before the connection is read again.
+func (c *Client) watchDisconnect() (disconnected <-chan struct{}, stop func()) {
+	sc, ok := c.Conn.(syscall.Conn)
+	if !ok {
+		return nil, func() {}
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil, func() {}
+	}
+
+	closed := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		buf := make([]byte, 1)
+		eof := false
+		err := raw.Read(func(fd uintptr) bool {
+			var n int
+			var err error
+			for {
+				n, _, err = syscall.Recvfrom(int(fd), buf, syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+				if err != syscall.EINTR {
+					break
+				}
+			}
+			if err == syscall.EAGAIN {
+				return false
+			}
+			eof = n == 0 || err != nil
+			return true
+		})
+
+		if eof || err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			close(closed)
+		}
+	}()
+
+	return closed, func() {
+		// The deadline interrupts the wait for data, and is lifted once
+		// the goroutine returned.
+		c.Conn.SetReadDeadline(time.Now())
+		<-done
+		c.Conn.SetReadDeadline(time.Time{})
+	}
+}
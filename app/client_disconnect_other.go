@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package main
+
+// watchDisconnect is not supported on this platform, where blocked
+// commands of clients that disconnected wait for their timeout.
+func (c *Client) watchDisconnect() (disconnected <-chan struct{}, stop func()) {
+	return nil, func() {}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/rdb"
+)
+
+var errCorrupt = errors.New("RDB file is corrupt")
+
+// runCheck reads the whole file, verifying its checksum, and reports the
+// offset of the first problem found.
+func runCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+
+	path, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("[offset 0] Checking RDB file %s\n", path)
+
+	var keys, expires, expired int
+	now := time.Now()
+	file, err := load(path, &filter{db: -1}, func(db int, entry rdb.Entry) error {
+		keys++
+		if entry.ExpiresAt != nil {
+			expires++
+			if !entry.ExpiresAt.After(now) {
+				expired++
+			}
+		}
+		return nil
+	})
+
+	var corrupt *rdb.CorruptError
+	if errors.As(err, &corrupt) {
+		fmt.Println("--- RDB ERROR DETECTED ---")
+		fmt.Printf("[offset %d] %v\n", corrupt.Offset, corrupt.Err)
+		fmt.Printf("[info] %d keys read\n", keys)
+		return errCorrupt
+	}
+	if err != nil {
+		return err
+	}
+
+	loaded, _ := file.LoadProgress()
+	fmt.Printf("[offset %d] \\o/ RDB looks OK! \\o/\n", loaded)
+	fmt.Printf("[info] %d keys read\n", keys)
+	fmt.Printf("[info] %d expires\n", expires)
+	fmt.Printf("[info] %d already expired\n", expired)
+
+	return nil
+}
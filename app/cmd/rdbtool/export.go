@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/rdb"
+)
+
+// itemsPerCommand is the number of elements added by each command when
+// exporting as RESP, as Redis does when rewriting the append-only file.
+const itemsPerCommand = 128
+
+// exporter writes the keys of an RDB file in some format.
+type exporter interface {
+	write(db int, entry rdb.Entry) error
+	close() error
+}
+
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "json", "output format: json or resp")
+	var f filter
+	f.register(fs)
+
+	path, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+
+	var e exporter
+	switch *format {
+	case "json":
+		e = &jsonExporter{w: w}
+	case "resp":
+		e = &respExporter{w: w}
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	// Write errors are sticky in w, so they are only checked at the end and
+	// never mistaken for a corrupt file.
+	var writeErr error
+	_, err = load(path, &f, func(db int, entry rdb.Entry) error {
+		if err := e.write(db, entry); err != nil && writeErr == nil {
+			writeErr = err
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+
+	if err := e.close(); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func formatStreamId(id rdb.StreamId) string {
+	return fmt.Sprintf("%d-%d", id.Ms, id.Seq)
+}
+
+// jsonExporter writes the keys as a JSON array, one element per line.
+type jsonExporter struct {
+	w       *bufio.Writer
+	started bool
+}
+
+type jsonEntry struct {
+	DB        int    `json:"db"`
+	Key       string `json:"key"`
+	Type      string `json:"type"`
+	ExpiresAt int64  `json:"expires_at,omitempty"`
+	Value     any    `json:"value"`
+}
+
+// jsonScore is a sorted set score, written as a string when it is infinite.
+type jsonScore float64
+
+func (s jsonScore) MarshalJSON() ([]byte, error) {
+	switch v := float64(s); {
+	case math.IsInf(v, 1):
+		return []byte(`"inf"`), nil
+	case math.IsInf(v, -1):
+		return []byte(`"-inf"`), nil
+	case math.IsNaN(v):
+		return []byte(`"nan"`), nil
+	default:
+		return strconv.AppendFloat(nil, v, 'g', -1, 64), nil
+	}
+}
+
+type jsonZSetMember struct {
+	Member string    `json:"member"`
+	Score  jsonScore `json:"score"`
+}
+
+// jsonHash holds the fields of a hash, and the expiry in Unix milliseconds
+// of those having one.
+type jsonHash struct {
+	Fields    map[string]string `json:"fields"`
+	ExpiresAt map[string]int64  `json:"field_expires_at,omitempty"`
+}
+
+type jsonStreamEntry struct {
+	ID     string   `json:"id"`
+	Fields []string `json:"fields"`
+}
+
+type jsonStreamPending struct {
+	ID            string `json:"id"`
+	Consumer      string `json:"consumer"`
+	DeliveryTime  int64  `json:"delivery_time"`
+	DeliveryCount uint64 `json:"delivery_count"`
+}
+
+type jsonStreamConsumer struct {
+	Name       string `json:"name"`
+	SeenTime   int64  `json:"seen_time"`
+	ActiveTime int64  `json:"active_time,omitempty"`
+}
+
+type jsonStreamGroup struct {
+	Name        string               `json:"name"`
+	LastId      string               `json:"last_id"`
+	EntriesRead int64                `json:"entries_read"`
+	Pending     []jsonStreamPending  `json:"pending"`
+	Consumers   []jsonStreamConsumer `json:"consumers"`
+}
+
+type jsonStream struct {
+	Entries      []jsonStreamEntry `json:"entries"`
+	LastId       string            `json:"last_id"`
+	EntriesAdded uint64            `json:"entries_added"`
+	MaxDeletedId string            `json:"max_deleted_id"`
+	Groups       []jsonStreamGroup `json:"groups"`
+}
+
+func (e *jsonExporter) write(db int, entry rdb.Entry) error {
+	value, err := jsonValue(entry.Object)
+	if err != nil {
+		return fmt.Errorf("key %q: %w", entry.Key, err)
+	}
+
+	je := jsonEntry{DB: db, Key: entry.Key, Type: typeName(entry.Object), Value: value}
+	if entry.ExpiresAt != nil {
+		je.ExpiresAt = entry.ExpiresAt.UnixMilli()
+	}
+
+	b, err := json.Marshal(je)
+	if err != nil {
+		return err
+	}
+
+	if e.started {
+		e.w.WriteString(",\n")
+	} else {
+		e.w.WriteString("[\n")
+		e.started = true
+	}
+	_, err = e.w.Write(b)
+	return err
+}
+
+func (e *jsonExporter) close() error {
+	if !e.started {
+		_, err := e.w.WriteString("[]\n")
+		return err
+	}
+	_, err := e.w.WriteString("\n]\n")
+	return err
+}
+
+func jsonValue(obj *rdb.Object) (any, error) {
+	switch obj.Type {
+	case rdb.ListObject:
+		return nonNil(obj.List), nil
+	case rdb.SetObject:
+		return nonNil(obj.Set), nil
+	case rdb.ZSetObject:
+		members := make([]jsonZSetMember, len(obj.ZSet))
+		for i, m := range obj.ZSet {
+			members[i] = jsonZSetMember{Member: m.Member, Score: jsonScore(m.Score)}
+		}
+		return members, nil
+	case rdb.HashObject:
+		h := jsonHash{Fields: make(map[string]string, len(obj.Hash))}
+		for _, f := range obj.Hash {
+			h.Fields[f.Field] = f.Value
+			if f.ExpiresAt != nil {
+				if h.ExpiresAt == nil {
+					h.ExpiresAt = make(map[string]int64)
+				}
+				h.ExpiresAt[f.Field] = f.ExpiresAt.UnixMilli()
+			}
+		}
+		return h, nil
+	case rdb.StreamObject:
+		return jsonStreamValue(obj.Stream)
+	default:
+		return obj.String, nil
+	}
+}
+
+func jsonStreamValue(s *rdb.Stream) (*jsonStream, error) {
+	entries, err := s.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	js := &jsonStream{
+		Entries:      make([]jsonStreamEntry, len(entries)),
+		LastId:       formatStreamId(s.LastId),
+		EntriesAdded: s.EntriesAdded,
+		MaxDeletedId: formatStreamId(s.MaxDeletedId),
+		Groups:       make([]jsonStreamGroup, len(s.Groups)),
+	}
+	for i, entry := range entries {
+		js.Entries[i] = jsonStreamEntry{ID: formatStreamId(entry.ID), Fields: entry.Fields}
+	}
+
+	for i, g := range s.Groups {
+		owners := make(map[rdb.StreamId]string)
+		jg := jsonStreamGroup{
+			Name:        g.Name,
+			LastId:      formatStreamId(g.LastId),
+			EntriesRead: g.EntriesRead,
+			Pending:     make([]jsonStreamPending, len(g.Pending)),
+			Consumers:   make([]jsonStreamConsumer, len(g.Consumers)),
+		}
+		for j, c := range g.Consumers {
+			jc := jsonStreamConsumer{Name: c.Name, SeenTime: c.SeenTime.UnixMilli()}
+			if !c.ActiveTime.IsZero() {
+				jc.ActiveTime = c.ActiveTime.UnixMilli()
+			}
+			jg.Consumers[j] = jc
+			for _, id := range c.Pending {
+				owners[id] = c.Name
+			}
+		}
+		for j, p := range g.Pending {
+			jg.Pending[j] = jsonStreamPending{
+				ID:            formatStreamId(p.ID),
+				Consumer:      owners[p.ID],
+				DeliveryTime:  p.DeliveryTime.UnixMilli(),
+				DeliveryCount: p.DeliveryCount,
+			}
+		}
+		js.Groups[i] = jg
+	}
+
+	return js, nil
+}
+
+// nonNil makes empty lists and sets marshal as [] rather than null.
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+// respExporter writes the commands recreating the keys, as a client would
+// send them.
+type respExporter struct {
+	w  *bufio.Writer
+	db int
+}
+
+func (e *respExporter) command(args ...string) error {
+	fmt.Fprintf(e.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(e.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	// bufio.Writer keeps the first error, so checking it here is enough.
+	_, err := e.w.Write(nil)
+	return err
+}
+
+// batched sends the command made of prefix followed by items, split into
+// several commands of at most itemsPerCommand items, each spanning step
+// arguments.
+func (e *respExporter) batched(prefix []string, items []string, step int) error {
+	for len(items) > 0 {
+		n := min(len(items), itemsPerCommand*step)
+		args := append(append([]string{}, prefix...), items[:n]...)
+		if err := e.command(args...); err != nil {
+			return err
+		}
+		items = items[n:]
+	}
+	return nil
+}
+
+func (e *respExporter) write(db int, entry rdb.Entry) error {
+	// A new connection starts in database 0.
+	if db != e.db {
+		if err := e.command("SELECT", strconv.Itoa(db)); err != nil {
+			return err
+		}
+		e.db = db
+	}
+
+	key, obj := entry.Key, entry.Object
+	var err error
+	switch obj.Type {
+	case rdb.StringObject:
+		if entry.ExpiresAt != nil {
+			return e.command("SET", key, obj.String, "PXAT", strconv.FormatInt(entry.ExpiresAt.UnixMilli(), 10))
+		}
+		return e.command("SET", key, obj.String)
+	case rdb.ListObject:
+		err = e.batched([]string{"RPUSH", key}, obj.List, 1)
+	case rdb.SetObject:
+		err = e.batched([]string{"SADD", key}, obj.Set, 1)
+	case rdb.ZSetObject:
+		items := make([]string, 0, 2*len(obj.ZSet))
+		for _, m := range obj.ZSet {
+			items = append(items, formatScore(m.Score), m.Member)
+		}
+		err = e.batched([]string{"ZADD", key}, items, 2)
+	case rdb.HashObject:
+		err = e.writeHash(key, obj.Hash)
+	case rdb.StreamObject:
+		err = e.writeStream(key, obj.Stream)
+	}
+	if err != nil {
+		return err
+	}
+
+	if entry.ExpiresAt != nil {
+		return e.command("PEXPIREAT", key, strconv.FormatInt(entry.ExpiresAt.UnixMilli(), 10))
+	}
+	return nil
+}
+
+func (e *respExporter) close() error {
+	return nil
+}
+
+func formatScore(score float64) string {
+	switch {
+	case math.IsInf(score, 1):
+		return "+inf"
+	case math.IsInf(score, -1):
+		return "-inf"
+	default:
+		return strconv.FormatFloat(score, 'g', -1, 64)
+	}
+}
+
+// writeHash sets the fields of a hash, then the expiry of those having one,
+// grouping the fields expiring at the same time.
+func (e *respExporter) writeHash(key string, fields []rdb.HashField) error {
+	items := make([]string, 0, 2*len(fields))
+	expiring := make(map[int64][]string)
+	for _, f := range fields {
+		items = append(items, f.Field, f.Value)
+		if f.ExpiresAt != nil {
+			at := f.ExpiresAt.UnixMilli()
+			expiring[at] = append(expiring[at], f.Field)
+		}
+	}
+
+	if err := e.batched([]string{"HSET", key}, items, 2); err != nil {
+		return err
+	}
+
+	times := make([]int64, 0, len(expiring))
+	for at := range expiring {
+		times = append(times, at)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	for _, at := range times {
+		for names := expiring[at]; len(names) > 0; {
+			n := min(len(names), itemsPerCommand)
+			args := []string{"HPEXPIREAT", key, strconv.FormatInt(at, 10), "FIELDS", strconv.Itoa(n)}
+			if err := e.command(append(args, names[:n]...)...); err != nil {
+				return err
+			}
+			names = names[n:]
+		}
+	}
+
+	return nil
+}
+
+// writeStream adds the entries of a stream, restores its metadata with
+// XSETID, and recreates its consumer groups. Pending entries are given back
+// to their consumer with XCLAIM, along with their delivery time and count.
+func (e *respExporter) writeStream(key string, s *rdb.Stream) error {
+	entries, err := s.Entries()
+	if err != nil {
+		return fmt.Errorf("key %q: %w", key, err)
+	}
+
+	if len(entries) == 0 {
+		// XADD creates the stream, and trims the entry right away. Its ID
+		// must be greater than 0-0, so XSETID fixes the last ID after.
+		id := s.LastId
+		if id.Ms == 0 && id.Seq == 0 {
+			id.Seq = 1
+		}
+		if err := e.command("XADD", key, "MAXLEN", "0", formatStreamId(id), "x", "y"); err != nil {
+			return err
+		}
+	}
+	for _, entry := range entries {
+		args := append([]string{"XADD", key, formatStreamId(entry.ID)}, entry.Fields...)
+		if err := e.command(args...); err != nil {
+			return err
+		}
+	}
+
+	err = e.command("XSETID", key, formatStreamId(s.LastId),
+		"ENTRIESADDED", strconv.FormatUint(s.EntriesAdded, 10),
+		"MAXDELETEDID", formatStreamId(s.MaxDeletedId))
+	if err != nil {
+		return err
+	}
+
+	for _, g := range s.Groups {
+		args := []string{"XGROUP", "CREATE", key, g.Name, formatStreamId(g.LastId)}
+		if g.EntriesRead >= 0 {
+			args = append(args, "ENTRIESREAD", strconv.FormatInt(g.EntriesRead, 10))
+		}
+		if err := e.command(args...); err != nil {
+			return err
+		}
+
+		pending := make(map[rdb.StreamId]rdb.StreamPendingEntry, len(g.Pending))
+		for _, p := range g.Pending {
+			pending[p.ID] = p
+		}
+
+		for _, c := range g.Consumers {
+			if len(c.Pending) == 0 {
+				if err := e.command("XGROUP", "CREATECONSUMER", key, g.Name, c.Name); err != nil {
+					return err
+				}
+				continue
+			}
+			for _, id := range c.Pending {
+				p := pending[id]
+				err := e.command("XCLAIM", key, g.Name, c.Name, "0", formatStreamId(id),
+					"TIME", strconv.FormatInt(p.DeliveryTime.UnixMilli(), 10),
+					"RETRYCOUNT", strconv.FormatUint(p.DeliveryCount, 10),
+					"FORCE", "JUSTID")
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
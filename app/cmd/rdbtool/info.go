@@ -0,0 +1,68 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/rdb"
+)
+
+// dbStats counts the keys of a database, as INFO keyspace does.
+type dbStats struct {
+	keys    int
+	expires int
+}
+
+func runInfo(args []string) error {
+	fs := flag.NewFlagSet("info", flag.ContinueOnError)
+	var f filter
+	f.register(fs)
+
+	path, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	stats := make(map[int]*dbStats)
+	file, err := load(path, &f, func(db int, entry rdb.Entry) error {
+		if stats[db] == nil {
+			stats[db] = &dbStats{}
+		}
+		stats[db].keys++
+		if entry.ExpiresAt != nil {
+			stats[db].expires++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("rdb_version:%d\n", file.FormatVersion())
+
+	aux := file.Aux()
+	keys := make([]string, 0, len(aux))
+	for key := range aux {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Println("# Aux")
+	for _, key := range keys {
+		fmt.Printf("%s:%s\n", key, aux[key])
+	}
+
+	dbs := make([]int, 0, len(stats))
+	for db := range stats {
+		dbs = append(dbs, db)
+	}
+	sort.Ints(dbs)
+
+	fmt.Println("# Keyspace")
+	for _, db := range dbs {
+		fmt.Printf("db%d:keys=%d,expires=%d\n", db, stats[db].keys, stats[db].expires)
+	}
+
+	return nil
+}
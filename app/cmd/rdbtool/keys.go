@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+	"unicode"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/rdb"
+)
+
+// runKeys lists the matching keys. The length is the number of elements of
+// the value, or of bytes for strings, and the size is the length of its DUMP
+// serialization.
+func runKeys(args []string) error {
+	fs := flag.NewFlagSet("keys", flag.ContinueOnError)
+	var f filter
+	f.register(fs)
+
+	path, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "DB\tTYPE\tLEN\tSIZE\tTTL\tKEY")
+
+	now := time.Now()
+	_, err = load(path, &f, func(db int, entry rdb.Entry) error {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\t%s\n",
+			db,
+			typeName(entry.Object),
+			objectLen(entry.Object),
+			len(rdb.Dump(entry.Object)),
+			formatTTL(entry.ExpiresAt, now),
+			quoteIfNeeded(entry.Key),
+		)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+func objectLen(obj *rdb.Object) int {
+	switch obj.Type {
+	case rdb.ListObject:
+		return len(obj.List)
+	case rdb.SetObject:
+		return len(obj.Set)
+	case rdb.ZSetObject:
+		return len(obj.ZSet)
+	case rdb.HashObject:
+		return len(obj.Hash)
+	case rdb.StreamObject:
+		return int(obj.Stream.Length)
+	default:
+		return len(obj.String)
+	}
+}
+
+// formatTTL returns the time left before an expiry, "expired" if it is
+// past, and "-" if there is none.
+func formatTTL(expiresAt *time.Time, now time.Time) string {
+	switch {
+	case expiresAt == nil:
+		return "-"
+	case !expiresAt.After(now):
+		return "expired"
+	default:
+		return expiresAt.Sub(now).Round(time.Millisecond).String()
+	}
+}
+
+// quoteIfNeeded quotes keys that would garble the output, such as binary
+// ones.
+func quoteIfNeeded(key string) string {
+	for _, r := range key {
+		if r == unicode.ReplacementChar || !unicode.IsPrint(r) {
+			return strconv.Quote(key)
+		}
+	}
+	return key
+}
@@ -0,0 +1,158 @@
+// Rdbtool inspects and converts RDB files offline.
+//
+// Usage:
+//
+//	rdbtool info [filters] <file>
+//	rdbtool keys [filters] <file>
+//	rdbtool export [-format json|resp] [filters] <file>
+//	rdbtool check <file>
+//
+// info prints the aux fields and the number of keys of every database, keys
+// lists the keys with their type, length, serialized size and TTL, and
+// export writes them as JSON or as the commands recreating them, which can
+// be piped into any server. check verifies the whole file, like
+// redis-check-rdb.
+//
+// The filters are -db, -match for a glob-style pattern as KEYS takes, and
+// -type for one of string, list, set, zset, hash and stream.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/glob"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/rdb"
+)
+
+const usage = `usage: rdbtool <command> [flags] <file>
+
+commands:
+  info     print the aux fields and the number of keys of every database
+  keys     list the keys with their type, length, size and TTL
+  export   write the keys as JSON or as RESP commands
+  check    verify the integrity of the file
+
+Run rdbtool <command> -h for the flags of a command.
+`
+
+var errUsage = errors.New("bad usage")
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch name, args := os.Args[1], os.Args[2:]; name {
+	case "info":
+		err = runInfo(args)
+	case "keys":
+		err = runKeys(args)
+	case "export":
+		err = runExport(args)
+	case "check":
+		err = runCheck(args)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if errors.Is(err, errUsage) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rdbtool:", err)
+		os.Exit(1)
+	}
+}
+
+// filter selects keys by database, name and type. The zero value of each
+// field selects every key.
+type filter struct {
+	db      int
+	pattern string
+	typ     string
+}
+
+func (f *filter) register(fs *flag.FlagSet) {
+	fs.IntVar(&f.db, "db", -1, "only keys of this database")
+	fs.StringVar(&f.pattern, "match", "", "only keys matching this glob-style pattern")
+	fs.StringVar(&f.typ, "type", "", "only keys of this type")
+}
+
+func (f *filter) check() error {
+	switch f.typ {
+	case "", "string", "list", "set", "zset", "hash", "stream":
+		return nil
+	default:
+		return fmt.Errorf("unknown type %q", f.typ)
+	}
+}
+
+func (f *filter) match(db int, entry rdb.Entry) bool {
+	if f.db >= 0 && db != f.db {
+		return false
+	}
+	if len(f.pattern) > 0 && !glob.Match(f.pattern, entry.Key) {
+		return false
+	}
+	return len(f.typ) == 0 || typeName(entry.Object) == f.typ
+}
+
+// parseArgs parses the flags of a command, followed by the path of the RDB
+// file.
+func parseArgs(fs *flag.FlagSet, args []string) (string, error) {
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: rdbtool %s [flags] <file>\n", fs.Name())
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return "", errUsage
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return "", errUsage
+	}
+
+	return fs.Arg(0), nil
+}
+
+// load streams the keys of the RDB file at path matching f through fn.
+func load(path string, f *filter, fn rdb.EntryFunc) (*rdb.RDBFile, error) {
+	if err := f.check(); err != nil {
+		return nil, err
+	}
+
+	file := rdb.NewRDBFile(filepath.Dir(path), filepath.Base(path))
+	err := file.Load(true, func(db int, entry rdb.Entry) error {
+		if !f.match(db, entry) {
+			return nil
+		}
+		return fn(db, entry)
+	})
+
+	return file, err
+}
+
+func typeName(obj *rdb.Object) string {
+	switch obj.Type {
+	case rdb.ListObject:
+		return "list"
+	case rdb.SetObject:
+		return "set"
+	case rdb.ZSetObject:
+		return "zset"
+	case rdb.HashObject:
+		return "hash"
+	case rdb.StreamObject:
+		return "stream"
+	default:
+		return "string"
+	}
+}
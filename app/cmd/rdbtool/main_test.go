@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const fixture = "../../internal/storage/rdb/testdata/hashes_zsets.rdb"
+
+// binary is the path of the rdbtool built by TestMain, so that the tests
+// check the exit codes set by main.
+var binary string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "rdbtool")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	binary = filepath.Join(dir, "rdbtool")
+	out, err := exec.Command("go", "build", "-o", binary, ".").CombinedOutput()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "go build: %v\n%s", err, out)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// rdbtool runs the tool with args, returning its output and exit code.
+func rdbtool(t *testing.T, args ...string) (stdout, stderr string, code int) {
+	t.Helper()
+
+	var outBuf, errBuf bytes.Buffer
+	cmd := exec.Command(binary, args...)
+	cmd.Stdout = &outBuf
+	cmd.Stderr = &errBuf
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		code = exitErr.ExitCode()
+	case err != nil:
+		t.Fatalf("rdbtool %v: %v", args, err)
+	}
+
+	return outBuf.String(), errBuf.String(), code
+}
+
+// truncatedFixture writes the first n bytes of the fixture to a temporary
+// file.
+func truncatedFixture(t *testing.T, n int) string {
+	t.Helper()
+
+	data, err := os.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "truncated.rdb")
+	if err := os.WriteFile(path, data[:n], 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestCommands(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{
+			args: []string{"info", fixture},
+			want: `rdb_version:11
+# Aux
+aof-base:0
+ctime:1718000000
+redis-bits:64
+redis-ver:7.2.4
+repl-id:5a1fb1ae1ef4b0c1d0df8ef5e4e4c1fcb1a5bbfd
+repl-offset:0
+repl-stream-db:0
+used-mem:1000000
+# Keyspace
+db0:keys=4,expires=0
+`,
+		},
+		{
+			args: []string{"keys", fixture},
+			want: `DB  TYPE  LEN  SIZE  TTL  KEY
+0   hash  3    44    -    hash
+0   hash  2    127   -    hash_table
+0   zset  3    42    -    zset
+0   zset  2    104   -    zset_skiplist
+`,
+		},
+		{
+			args: []string{"keys", "-type", "zset", "-match", "zset_*", fixture},
+			want: `DB  TYPE  LEN  SIZE  TTL  KEY
+0   zset  2    104   -    zset_skiplist
+`,
+		},
+		{
+			args: []string{"keys", "-db", "1", fixture},
+			want: "DB  TYPE  LEN  SIZE  TTL  KEY\n",
+		},
+		{
+			args: []string{"export", "-match", "hash", fixture},
+			want: `[
+{"db":0,"key":"hash","type":"hash","value":{"fields":{"name":"redis","ratio":"-1.5","version":"7"}}}
+]
+`,
+		},
+		{
+			args: []string{"export", "-format", "resp", "-match", "zset", fixture},
+			want: "*8\r\n$4\r\nZADD\r\n$4\r\nzset\r\n" +
+				"$5\r\n-3.25\r\n$1\r\nc\r\n$1\r\n1\r\n$1\r\na\r\n$3\r\n2.5\r\n$1\r\nb\r\n",
+		},
+		{
+			args: []string{"check", fixture},
+			want: `[offset 0] Checking RDB file ` + fixture + `
+[offset 352] \o/ RDB looks OK! \o/
+[info] 4 keys read
+[info] 0 expires
+[info] 0 already expired
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args[:len(tt.args)-1], " "), func(t *testing.T) {
+			stdout, stderr, code := rdbtool(t, tt.args...)
+			if code != 0 {
+				t.Fatalf("exit code = %d, want 0, stderr:\n%s", code, stderr)
+			}
+			if stdout != tt.want {
+				t.Errorf("stdout:\n%q\nwant:\n%q", stdout, tt.want)
+			}
+		})
+	}
+}
+
+func TestTruncatedFile(t *testing.T) {
+	path := truncatedFixture(t, 200)
+
+	for _, name := range []string{"info", "keys", "export"} {
+		t.Run(name, func(t *testing.T) {
+			stdout, stderr, code := rdbtool(t, name, path)
+			if code != 1 {
+				t.Errorf("exit code = %d, want 1", code)
+			}
+			if want := "rdbtool: corrupt file at byte 167: unexpected EOF\n"; stderr != want {
+				t.Errorf("stderr = %q, want %q", stderr, want)
+			}
+			if strings.Contains(stdout, "zset") {
+				t.Errorf("stdout = %q, want no key of the truncated file", stdout)
+			}
+		})
+	}
+
+	t.Run("check", func(t *testing.T) {
+		stdout, stderr, code := rdbtool(t, "check", path)
+		if code != 1 {
+			t.Errorf("exit code = %d, want 1", code)
+		}
+		if !strings.Contains(stdout, "--- RDB ERROR DETECTED ---\n[offset 167] unexpected EOF\n") {
+			t.Errorf("stdout = %q, want the offset of the error", stdout)
+		}
+		if want := "rdbtool: RDB file is corrupt\n"; stderr != want {
+			t.Errorf("stderr = %q, want %q", stderr, want)
+		}
+	})
+}
+
+func TestCheckWrongChecksum(t *testing.T) {
+	stdout, _, code := rdbtool(t, "check", "../../internal/storage/rdb/testdata/corrupt_crc.rdb")
+	if code != 1 {
+		t.Errorf("exit code = %d, want 1", code)
+	}
+	if !strings.Contains(stdout, "wrong checksum") || strings.Contains(stdout, "RDB looks OK") {
+		t.Errorf("stdout = %q, want a wrong checksum", stdout)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	tests := []struct {
+		args []string
+		code int
+	}{
+		{args: nil, code: 2},
+		{args: []string{"unknown", fixture}, code: 2},
+		{args: []string{"keys"}, code: 2},
+		{args: []string{"keys", "-bogus", fixture}, code: 2},
+		{args: []string{"keys", "-type", "bogus", fixture}, code: 1},
+		{args: []string{"export", "-format", "xml", fixture}, code: 1},
+		{args: []string{"info", filepath.Join(t.TempDir(), "missing.rdb")}, code: 1},
+	}
+
+	for _, tt := range tests {
+		_, stderr, code := rdbtool(t, tt.args...)
+		if code != tt.code {
+			t.Errorf("rdbtool %v exit code = %d, want %d", tt.args, code, tt.code)
+		}
+		if len(stderr) == 0 {
+			t.Errorf("rdbtool %v wrote nothing to stderr", tt.args)
+		}
+	}
+}
@@ -2,63 +2,94 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"strings"
 )
 
 type command struct {
 	rawBytes  []byte
 	name      string
+	parts     []string
 	args      []string
 	isQueable bool
 	isWrite   bool
-}
-
-func (c *command) append(b byte) {
-	c.rawBytes = append(c.rawBytes, b)
+	// payload holds a bulk string sent outside of an array, in place of
+	// parts. Only the RDB file of a full resync is sent that way.
+	payload []byte
 }
 
 func (c *command) bytesLength() int {
 	return len(c.rawBytes)
 }
 
+// parse resolves the command name, matching subcommands like "config get"
+// as a single name, and leaves the remaining parts as arguments. Only the
+// name is case-insensitive; arguments are kept exactly as sent.
 func (c *command) parse() error {
-	pieces := strings.Split(string(c.rawBytes), carriageReturn())[1:]
-
-	cleanCmdPieces := make([]string, 0, len(pieces)/2)
-
-	for idx, piece := range pieces {
-		if idx%2 != 0 {
-			cleanCmdPieces = append(cleanCmdPieces, piece)
-		}
+	if len(c.parts) == 0 {
+		return errors.New("empty command")
 	}
 
-	cleanCmd := strings.ToLower(strings.Join(cleanCmdPieces, " "))
+	matchedCmd := strings.ToLower(c.parts[0])
+	argsIdx := 1
 
-	var matchedCmd string
-	for _, supportedCmd := range supportedCommands {
-		if strings.HasPrefix(cleanCmd, supportedCmd) && len(matchedCmd) < len(supportedCmd) {
-			matchedCmd = supportedCmd
+	if len(c.parts) > 1 {
+		subCmd := matchedCmd + " " + strings.ToLower(c.parts[1])
+		if _, ok := commandArity[subCmd]; ok {
+			matchedCmd = subCmd
+			argsIdx = 2
 		}
 	}
 
-	if len(matchedCmd) == 0 {
-		return errors.New("command not supported")
+	if _, ok := commandArity[matchedCmd]; !ok {
+		return unknownCommandError(c.parts)
 	}
 
 	c.name = matchedCmd
 
+	// Replication and subscription commands cannot be part of a transaction,
+	// WAIT would be pointless in one and SAVE would block it for too long.
+	c.isQueable = true
+
 	switch c.name {
-	case cmdEcho, cmdGet, cmdKeys, cmdType, cmdXRange:
-		c.isQueable = true
-	case cmdIncr, cmdSet, cmdXAdd:
-		c.isQueable = true
+	case cmdPsync, cmdReplConf, cmdReplConfGetAck, cmdReplConfAck, cmdWait,
+		cmdSubscribe, cmdUnsubscribe, cmdPSubscribe, cmdPUnsubscribe, cmdSSubscribe, cmdSUnsubscribe,
+		cmdSave:
+		c.isQueable = false
+	case cmdIncr, cmdSet, cmdDel, cmdFlushAll, cmdFlushDb, cmdXAdd, cmdXDel, cmdXTrim, cmdXSetId,
+		cmdXGroupCreate, cmdXGroupSetId, cmdXGroupDestroy, cmdXGroupCreateConsumer, cmdXGroupDelConsumer,
+		cmdXReadGroup, cmdXAck, cmdXClaim, cmdXAutoClaim,
+		cmdHSet, cmdHDel, cmdHExpire, cmdHPExpire, cmdHExpireAt, cmdHPExpireAt, cmdHPersist, cmdHGetEx, cmdHSetEx,
+		cmdRestore:
 		c.isWrite = true
 	}
 
-	if len(cleanCmd) > len(matchedCmd) {
-		args := cleanCmd[len(matchedCmd)+1:]
-		c.args = strings.Split(args, " ")
-	}
+	c.args = c.parts[argsIdx:]
 
 	return nil
 }
+
+// hasValidArity checks the number of parts of the command against its arity.
+func (c *command) hasValidArity() bool {
+	arity := commandArity[c.name]
+	if arity < 0 {
+		return len(c.parts) >= -arity
+	}
+	return len(c.parts) == arity
+}
+
+func unknownCommandError(parts []string) error {
+	args := make([]string, 0, len(parts)-1)
+	for _, arg := range parts[1:] {
+		args = append(args, fmt.Sprintf("'%s'", arg))
+	}
+
+	return fmt.Errorf("unknown command '%s', with args beginning with: %s", parts[0], strings.Join(args, " "))
+}
+
+// encode serializes the command back to a RESP array, as sent to slaves.
+func (c *command) encode() ([]byte, error) {
+	parts := strings.Fields(c.name)
+	parts = append(parts, c.args...)
+	return respAsArray(parts)
+}
@@ -0,0 +1,13 @@
+package main
+
+func (s *server) handleCommandBgRewriteAof() ([]byte, error) {
+	scheduled, err := s.bgrewriteAppendOnlyFile()
+	if err != nil {
+		return respAsError(err.Error()), nil
+	}
+
+	if scheduled {
+		return respAsSimpleString("Background append only file rewriting scheduled"), nil
+	}
+	return respAsSimpleString("Background append only file rewriting started"), nil
+}
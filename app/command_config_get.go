@@ -1,23 +1,56 @@
 package main
 
 import (
+	"sort"
+	"strconv"
 	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/glob"
 )
 
+// configParams returns the current value of every parameter that CONFIG GET
+// can read.
+func (s *server) configParams() map[string]string {
+	return map[string]string{
+		"dir":                         s.rdbFile.Dir,
+		"dbfilename":                  s.rdbFile.DBFilename,
+		"notify-keyspace-events":      formatNotifyKeyspaceEvents(int(s.notifyKeyspaceEvents.Load())),
+		"save":                        formatSaveRules(*s.saveRules.Load()),
+		"rdbchecksum":                 formatYesNo(s.rdbChecksum.Load()),
+		"appendonly":                  formatYesNo(s.appendOnly.Load()),
+		"appenddirname":               s.appendDirname,
+		"appendfilename":              s.appendFilename,
+		"appendfsync":                 formatAppendFsync(int(s.appendFsync.Load())),
+		"aof-load-truncated":          formatYesNo(s.aofLoadTruncated.Load()),
+		"auto-aof-rewrite-percentage": strconv.FormatInt(s.autoAofRewritePercentage.Load(), 10),
+		"auto-aof-rewrite-min-size":   strconv.FormatInt(s.autoAofRewriteMinSize.Load(), 10),
+	}
+}
+
+// handleCommandConfigGet replies with every parameter matching one of the
+// glob patterns in args, as a flat list of names and values.
 func (s *server) handleCommandConfigGet(args []string) ([]byte, error) {
-	key := args[0]
-	var val string
+	params := s.configParams()
 
-	switch strings.ToLower(key) {
-	case "dir":
-		val = s.rdbFile.Dir
-	case "dbfilename":
-		val = s.rdbFile.DBFilename
+	names := make([]string, 0, len(params))
+	for name := range params {
+		for _, pattern := range args {
+			if glob.Match(strings.ToLower(pattern), name) {
+				names = append(names, name)
+				break
+			}
+		}
 	}
+	sort.Strings(names)
 
-	if len(val) > 0 {
-		return respAsArray([]string{key, val})
+	resps := make([][]byte, 0, len(names)*2)
+	for _, name := range names {
+		val := respAsEmptyBulkString()
+		if len(params[name]) > 0 {
+			val = respAsBulkString(params[name])
+		}
+		resps = append(resps, respAsBulkString(name), val)
 	}
 
-	return nil, nil
+	return respAsMap(resp2, resps), nil
 }
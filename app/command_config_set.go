@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// handleCommandConfigSet changes the parameters that can be set at runtime.
+// Every value is validated before any parameter is changed. Turning on the
+// append-only file comes last, as it is the only change that may fail.
+func (s *server) handleCommandConfigSet(args []string) ([]byte, error) {
+	if len(args)%2 != 0 {
+		return respAsError("wrong number of arguments for 'config|set' command"), nil
+	}
+
+	setters := make([]func(), 0, len(args)/2)
+	var appendOnly *bool
+
+	for i := 0; i < len(args); i += 2 {
+		name, val := strings.ToLower(args[i]), args[i+1]
+
+		switch name {
+		case "notify-keyspace-events":
+			classes, err := parseNotifyKeyspaceEvents(val)
+			if err != nil {
+				return respAsError(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", args[i], err)), nil
+			}
+			setters = append(setters, func() {
+				s.notifyKeyspaceEvents.Store(int32(classes))
+			})
+		case "save":
+			rules, err := parseSaveRules(val)
+			if err != nil {
+				return respAsError(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", args[i], err)), nil
+			}
+			setters = append(setters, func() {
+				s.saveRules.Store(&rules)
+			})
+		case "rdbchecksum":
+			checksum, err := parseYesNo(val)
+			if err != nil {
+				return respAsError(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", args[i], err)), nil
+			}
+			setters = append(setters, func() {
+				s.rdbChecksum.Store(checksum)
+			})
+		case "appendfsync":
+			policy, err := parseAppendFsync(val)
+			if err != nil {
+				return respAsError(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", args[i], err)), nil
+			}
+			setters = append(setters, func() {
+				s.appendFsync.Store(int32(policy))
+			})
+		case "aof-load-truncated":
+			loadTruncated, err := parseYesNo(val)
+			if err != nil {
+				return respAsError(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", args[i], err)), nil
+			}
+			setters = append(setters, func() {
+				s.aofLoadTruncated.Store(loadTruncated)
+			})
+		case "appendonly":
+			enable, err := parseYesNo(val)
+			if err != nil {
+				return respAsError(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", args[i], err)), nil
+			}
+			appendOnly = &enable
+		case "auto-aof-rewrite-percentage":
+			percentage, err := parsePercentage(val)
+			if err != nil {
+				return respAsError(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", args[i], err)), nil
+			}
+			setters = append(setters, func() {
+				s.autoAofRewritePercentage.Store(percentage)
+			})
+		case "auto-aof-rewrite-min-size":
+			minSize, err := parseMemory(val)
+			if err != nil {
+				return respAsError(fmt.Sprintf("CONFIG SET failed (possibly related to argument '%s') - %s", args[i], err)), nil
+			}
+			setters = append(setters, func() {
+				s.autoAofRewriteMinSize.Store(minSize)
+			})
+		default:
+			return respAsError(fmt.Sprintf("Unknown option or number of arguments for CONFIG SET - '%s'", args[i])), nil
+		}
+	}
+
+	for _, set := range setters {
+		set()
+	}
+
+	if appendOnly != nil && !*appendOnly {
+		s.stopAppendOnly()
+	}
+	if appendOnly != nil && *appendOnly {
+		if err := s.startAppendOnly(); err != nil {
+			fmt.Println("Unable to turn on the append only file: ", err)
+			return respAsError("CONFIG SET failed (possibly related to argument 'appendonly') - Unable to turn on AOF. Check server logs."), nil
+		}
+	}
+
+	return okSimpleString(), nil
+}
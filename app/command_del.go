@@ -0,0 +1,32 @@
+package main
+
+func (s *server) handleCommandDel(args []string) ([]byte, error) {
+	deleted := 0
+
+	for _, key := range args {
+		if !s.deleteKey(key) {
+			continue
+		}
+
+		deleted++
+		s.signalModifiedKey(key)
+		s.notifyKeyspaceEvent(notifyGeneric, "del", key)
+	}
+
+	return respAsInteger(deleted), nil
+}
+
+// deleteKey removes key, whatever the type of its value, and reports whether
+// it existed.
+func (s *server) deleteKey(key string) bool {
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	s.expireIfNeeded(key)
+	if _, ok := s.data[key]; ok {
+		delete(s.data, key)
+		return true
+	}
+
+	return s.deleteStream(key)
+}
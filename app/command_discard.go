@@ -14,6 +14,8 @@ func (s *server) handleCommandDiscard(client *Client) error {
 		return err
 	}
 
+	s.unwatchAllKeys(client)
+
 	_, err = client.Write(okSimpleString())
 	if err != nil {
 		return err
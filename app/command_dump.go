@@ -0,0 +1,41 @@
+package main
+
+import (
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/rdb"
+)
+
+// handleCommandDump serializes the value of a key in the format RESTORE
+// reads, without its expiry.
+func (s *server) handleCommandDump(args []string) ([]byte, error) {
+	payload, _, ok := s.dumpKey(args[0])
+	if !ok {
+		return respAsBulkString(""), nil
+	}
+
+	return respAsBulkString(string(payload)), nil
+}
+
+// dumpKey serializes the value of key as DUMP does, and returns its expiry
+// along with it. It reports false if key does not exist.
+func (s *server) dumpKey(key string) (payload []byte, expiresAt *time.Time, ok bool) {
+	s.dataMu.Lock()
+	s.expireIfNeeded(key)
+	var obj *rdb.Object
+	if expVal, ok := s.data[key]; ok {
+		obj = rdbObject(expVal)
+		if at, ok := expVal.ExpiresAt(); ok {
+			expiresAt = &at
+		}
+	} else if stream := s.streams.Streams[key]; stream != nil {
+		obj = stream.rdbObject()
+	}
+	s.dataMu.Unlock()
+
+	if obj == nil {
+		return nil, nil, false
+	}
+
+	return rdb.Dump(obj), expiresAt, true
+}
@@ -2,55 +2,66 @@ package main
 
 import "fmt"
 
+// handleCommandExec runs the queued commands while holding the exec lock
+// exclusively, so that no other client can access the keyspace until the
+// whole transaction is done.
 func (s *server) handleCommandExec(client *Client) error {
-	if client.Transaction.IsOpen() {
-		if len(client.Transaction.Queue) == 0 {
-			resp, err := respAsArray([]string{})
-			if err != nil {
-				return err
-			}
-
-			_, err = client.Write(resp)
-			if err != nil {
-				return err
-			}
-		} else {
-			resps := make([][]byte, 0, len(client.Transaction.Queue))
-			for _, cmd := range client.Transaction.Queue {
-				resp, err := s.handleCommandOnMaster(client, cmd)
-				if err != nil {
-					resp = respAsError(err.Error())
-				}
-				resps = append(resps, resp)
-			}
-			if len(resps) > 0 {
-				respToWrite, err := respAsByteArrays(resps)
-				if err != nil {
-					return err
-				}
-				_, err = client.Write(respToWrite)
-				if err != nil {
-					return err
-				}
-			}
-			for _, cmd := range client.Transaction.Queue {
-				if cmd.isWrite {
-					err := s.propagateCommandToSlaves(cmd)
-					if err != nil {
-						fmt.Println("Failed propagating to slaves: ", err)
-					}
-				}
-			}
-		}
+	if !client.Transaction.IsOpen() {
+		_, err := client.Write(respAsError("EXEC without MULTI"))
+		return err
 	}
 
+	defer s.unwatchAllKeys(client)
+
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+
+	queue := client.Transaction.Queue
+	aborted := client.Transaction.IsAborted()
+
 	err := client.Transaction.Close()
 	if err != nil {
-		_, err := client.Write(respAsError("EXEC without MULTI"))
+		return err
+	}
+
+	if aborted {
+		_, err := client.Write(respAsCodedError("EXECABORT", "Transaction discarded because of previous errors."))
+		return err
+	}
+
+	if s.isTransactionDirty(client) {
+		_, err := client.Write(respAsNullArray())
+		return err
+	}
+
+	client.Transaction.isExecuting = true
+	resps := make([][]byte, 0, len(queue))
+	writes := make([]*command, 0, len(queue))
+	for _, cmd := range queue {
+		resp, err := s.handleCommandOnRole(client, cmd)
+		if err != nil {
+			resp = respAsError(err.Error())
+		}
+		resps = append(resps, resp)
+
+		if cmd.isWrite && !isErrorReply(resp) {
+			writes = append(writes, cmd)
+		}
+	}
+	client.Transaction.isExecuting = false
+
+	if len(writes) > 0 {
+		err := s.propagateTransaction(writes)
 		if err != nil {
-			return err
+			fmt.Println("Failed propagating to slaves: ", err)
 		}
 	}
 
-	return nil
+	respToWrite, err := respAsByteArrays(resps)
+	if err != nil {
+		return err
+	}
+
+	_, err = client.Write(respToWrite)
+	return err
 }
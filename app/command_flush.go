@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage"
+)
+
+// handleCommandFlush handles both FLUSHALL and FLUSHDB, as there is a single
+// database. The ASYNC and SYNC modes are accepted, and the flush is always
+// synchronous.
+func (s *server) handleCommandFlush(args []string) ([]byte, error) {
+	if len(args) > 1 {
+		return respAsError(ErrSyntax.Error()), nil
+	}
+	if len(args) == 1 && !strings.EqualFold(args[0], "async") && !strings.EqualFold(args[0], "sync") {
+		return respAsError(ErrSyntax.Error()), nil
+	}
+
+	s.signalFlushedDb()
+
+	s.dataMu.Lock()
+	removed := len(s.data) + len(s.streams.Streams)
+	s.data = make(map[string]*storage.ExpiringValue)
+	s.volatileKeys = make(map[string]struct{})
+	s.streams.Streams = make(map[string]*Stream)
+	s.dataMu.Unlock()
+
+	s.persistence.dirty.Add(int64(removed))
+
+	return okSimpleString(), nil
+}
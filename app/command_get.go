@@ -11,13 +11,24 @@ func (s *server) handleCommandGet(args []string) ([]byte, error) {
 
 	nullBulkString := respAsBulkString("")
 
-	s.dataMu.RLock()
+	s.dataMu.Lock()
+	expired := s.expireIfNeeded(args[0])
 	expVal, ok := s.data[args[0]]
-	s.dataMu.RUnlock()
+	isStream := s.isStream(args[0])
+	s.dataMu.Unlock()
 
-	if !ok || expVal.HasExpired() {
+	if isStream {
+		return respAsWrongTypeError(), nil
+	}
+
+	if !ok || expired {
+		s.notifyKeyspaceEvent(notifyKeyMiss, "keymiss", args[0])
 		return nullBulkString, nil
 	}
 
+	if !expVal.IsString() {
+		return respAsWrongTypeError(), nil
+	}
+
 	return respAsBulkString(string(expVal.Val)), nil
 }
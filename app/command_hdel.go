@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+)
+
+func (s *server) handleCommandHDel(args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return nil, errors.New("command hdel requires a key and at least one field")
+	}
+
+	key := args[0]
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	hash, err := s.findHash(key)
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+
+	if hash == nil {
+		return respAsInteger(0), nil
+	}
+
+	deleted := 0
+	for _, field := range args[1:] {
+		if hash.Delete(field) {
+			deleted++
+		}
+	}
+
+	if deleted > 0 {
+		s.signalModifiedKey(key)
+		s.notifyKeyspaceEvent(notifyHash, "hdel", key)
+	}
+
+	s.deleteHashIfEmpty(key, hash)
+
+	return respAsInteger(deleted), nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+const serverVersion = "7.4.0"
+
+// handleCommandHello switches the protocol of the client and replies with
+// details about the server and the connection.
+func (s *server) handleCommandHello(client *Client, args []string) ([]byte, error) {
+	protocol := client.protocol
+
+	if len(args) > 0 {
+		version, err := strconv.Atoi(args[0])
+		if err != nil {
+			return respAsError("Protocol version is not an integer or out of range"), nil
+		}
+		if version != resp2 && version != resp3 {
+			return respAsCodedError("NOPROTO", "unsupported protocol version"), nil
+		}
+		protocol = version
+
+		for idx := 1; idx < len(args); idx++ {
+			switch strings.ToLower(args[idx]) {
+			case "setname":
+				if idx+1 >= len(args) {
+					return respAsError(ErrSyntax.Error()), nil
+				}
+				client.name = args[idx+1]
+				idx++
+			case "auth":
+				return respAsError("AUTH failed: no password is set"), nil
+			default:
+				return respAsError(ErrSyntax.Error()), nil
+			}
+		}
+	}
+
+	client.protocol = protocol
+
+	modules, err := respAsByteArrays([][]byte{})
+	if err != nil {
+		return nil, err
+	}
+
+	return respAsMap(protocol, [][]byte{
+		respAsBulkString("server"), respAsBulkString("redis"),
+		respAsBulkString("version"), respAsBulkString(serverVersion),
+		respAsBulkString("proto"), respAsInteger(protocol),
+		respAsBulkString("id"), respAsInteger(int(client.id)),
+		respAsBulkString("mode"), respAsBulkString("standalone"),
+		respAsBulkString("role"), respAsBulkString(s.role.string()),
+		respAsBulkString("modules"), modules,
+	}), nil
+}
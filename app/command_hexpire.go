@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	hashFieldNotFound    = -2
+	hashFieldNoExpiry    = -1
+	hashFieldConditionNo = 0
+	hashFieldExpireSet   = 1
+	hashFieldDeleted     = 2
+	hashFieldPersisted   = 1
+)
+
+// handleCommandHExpire implements HEXPIRE, HPEXPIRE, HEXPIREAT and HPEXPIREAT.
+// unit is the unit of the time argument, and absolute tells whether it is a
+// unix timestamp rather than a TTL.
+func (s *server) handleCommandHExpire(args []string, unit time.Duration, absolute bool) ([]byte, error) {
+	if len(args) < 4 {
+		return nil, errors.New("wrong number of arguments for hash field expire command")
+	}
+
+	key := args[0]
+
+	at, err := parseExpiryTime(args[1], unit, absolute)
+	if err != nil {
+		return respAsError(err.Error()), nil
+	}
+
+	condition := ""
+	fieldsIdx := 2
+	switch strings.ToLower(args[2]) {
+	case "nx", "xx", "gt", "lt":
+		condition = strings.ToLower(args[2])
+		fieldsIdx++
+	}
+
+	fields, err := parseHashFields(args[fieldsIdx:], 1)
+	if err != nil {
+		return respAsError(err.Error()), nil
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	hash, err := s.findHash(key)
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+
+	expired, deleted := false, false
+	results := make([][]byte, 0, len(fields))
+	for _, field := range fields {
+		if hash == nil {
+			results = append(results, respAsInteger(hashFieldNotFound))
+			continue
+		}
+
+		val, ok := hash.Get(field)
+		if !ok {
+			results = append(results, respAsInteger(hashFieldNotFound))
+			continue
+		}
+
+		current, hasExpiry := val.ExpiresAt()
+
+		var conditionMet bool
+		switch condition {
+		case "nx":
+			conditionMet = !hasExpiry
+		case "xx":
+			conditionMet = hasExpiry
+		case "gt":
+			conditionMet = hasExpiry && at.After(current)
+		case "lt":
+			conditionMet = !hasExpiry || at.Before(current)
+		default:
+			conditionMet = true
+		}
+
+		if !conditionMet {
+			results = append(results, respAsInteger(hashFieldConditionNo))
+			continue
+		}
+
+		if hash.ExpireField(field, at) {
+			deleted = true
+			results = append(results, respAsInteger(hashFieldDeleted))
+		} else {
+			expired = true
+			results = append(results, respAsInteger(hashFieldExpireSet))
+		}
+	}
+
+	if expired || deleted {
+		s.signalModifiedKey(key)
+	}
+	if expired {
+		s.trackVolatileKey(key)
+		s.notifyKeyspaceEvent(notifyHash, "hexpire", key)
+	}
+	if deleted {
+		s.notifyKeyspaceEvent(notifyHash, "hdel", key)
+	}
+
+	s.deleteHashIfEmpty(key, hash)
+
+	return respAsByteArrays(results)
+}
+
+// parseExpiryTime turns a TTL or unix timestamp given in unit into an
+// absolute point in time.
+func parseExpiryTime(rawTime string, unit time.Duration, absolute bool) (time.Time, error) {
+	n, err := strconv.ParseInt(rawTime, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New("value is not an integer or out of range")
+	}
+
+	if n < 0 {
+		return time.Time{}, errors.New("invalid expire time, must be >= 0")
+	}
+
+	if absolute {
+		return time.UnixMilli(n * int64(unit/time.Millisecond)).UTC(), nil
+	}
+
+	return time.Now().UTC().Add(time.Duration(n) * unit), nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+)
+
+func (s *server) handleCommandHGet(args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, errors.New("command hget must take two arguments")
+	}
+
+	key := args[0]
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	hash, err := s.findHash(key)
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+
+	if hash == nil {
+		return respAsBulkString(""), nil
+	}
+
+	val, ok := hash.Get(args[1])
+	s.deleteHashIfEmpty(key, hash)
+	if !ok {
+		return respAsBulkString(""), nil
+	}
+
+	return respAsBulkString(val.Val), nil
+}
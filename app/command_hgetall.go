@@ -0,0 +1,36 @@
+package main
+
+import (
+	"errors"
+)
+
+func (s *server) handleCommandHGetAll(args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("command hgetall must take one argument")
+	}
+
+	key := args[0]
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	hash, err := s.findHash(key)
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+
+	if hash == nil {
+		return respAsArray([]string{})
+	}
+
+	vals := make([]string, 0, len(hash.Fields)*2)
+	for field, val := range hash.Fields {
+		if val.HasExpired() {
+			continue
+		}
+		vals = append(vals, field)
+		vals = append(vals, val.Val)
+	}
+
+	return respAsArray(vals)
+}
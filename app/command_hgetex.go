@@ -0,0 +1,137 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// hashFieldExpiry is the expiry option shared by HGETEX and HSETEX.
+type hashFieldExpiry struct {
+	at      *time.Time
+	persist bool
+	keepTTL bool
+}
+
+// parseHashFieldExpiry parses an EX, PX, EXAT or PXAT option starting at
+// args[0]. It returns the number of arguments consumed, or 0 if args[0] is
+// not an expiry option.
+func parseHashFieldExpiry(args []string, expiry *hashFieldExpiry) (int, error) {
+	var unit time.Duration
+	var absolute bool
+
+	switch strings.ToLower(args[0]) {
+	case "ex":
+		unit = time.Second
+	case "px":
+		unit = time.Millisecond
+	case "exat":
+		unit, absolute = time.Second, true
+	case "pxat":
+		unit, absolute = time.Millisecond, true
+	default:
+		return 0, nil
+	}
+
+	if expiry.at != nil || expiry.persist || expiry.keepTTL {
+		return 0, errors.New("syntax error")
+	}
+
+	if len(args) < 2 {
+		return 0, errors.New("syntax error")
+	}
+
+	at, err := parseExpiryTime(args[1], unit, absolute)
+	if err != nil {
+		return 0, err
+	}
+	expiry.at = &at
+
+	return 2, nil
+}
+
+func (s *server) handleCommandHGetEx(args []string) ([]byte, error) {
+	if len(args) < 3 {
+		return nil, errors.New("wrong number of arguments for command hgetex")
+	}
+
+	key := args[0]
+
+	var expiry hashFieldExpiry
+	idx := 1
+	if !strings.EqualFold(args[idx], "fields") {
+		if strings.EqualFold(args[idx], "persist") {
+			expiry.persist = true
+			idx++
+		} else {
+			n, err := parseHashFieldExpiry(args[idx:], &expiry)
+			if err != nil {
+				return respAsError(err.Error()), nil
+			}
+			if n == 0 {
+				return respAsError("syntax error"), nil
+			}
+			idx += n
+		}
+	}
+
+	fields, err := parseHashFields(args[idx:], 1)
+	if err != nil {
+		return respAsError(err.Error()), nil
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	hash, err := s.findHash(key)
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+
+	persisted, expired, deleted := false, false, false
+	results := make([][]byte, 0, len(fields))
+	for _, field := range fields {
+		if hash == nil {
+			results = append(results, respAsBulkString(""))
+			continue
+		}
+
+		val, ok := hash.Get(field)
+		if !ok {
+			results = append(results, respAsBulkString(""))
+			continue
+		}
+
+		results = append(results, respAsBulkString(val.Val))
+
+		switch {
+		case expiry.persist:
+			persisted = persisted || val.HasExpiry()
+			val.Persist()
+		case expiry.at != nil:
+			if hash.ExpireField(field, *expiry.at) {
+				deleted = true
+			} else {
+				expired = true
+			}
+		}
+	}
+
+	if persisted || expired || deleted {
+		s.signalModifiedKey(key)
+	}
+	if persisted {
+		s.notifyKeyspaceEvent(notifyHash, "hpersist", key)
+	}
+	if expired {
+		s.trackVolatileKey(key)
+		s.notifyKeyspaceEvent(notifyHash, "hexpire", key)
+	}
+	if deleted {
+		s.notifyKeyspaceEvent(notifyHash, "hdel", key)
+	}
+
+	s.deleteHashIfEmpty(key, hash)
+
+	return respAsByteArrays(results)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+)
+
+func (s *server) handleCommandHLen(args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("command hlen must take one argument")
+	}
+
+	key := args[0]
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	hash, err := s.findHash(key)
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+
+	if hash == nil {
+		return respAsInteger(0), nil
+	}
+
+	length := hash.Len()
+	s.deleteHashIfEmpty(key, hash)
+
+	return respAsInteger(length), nil
+}
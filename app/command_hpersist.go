@@ -0,0 +1,59 @@
+package main
+
+import (
+	"errors"
+)
+
+func (s *server) handleCommandHPersist(args []string) ([]byte, error) {
+	if len(args) < 3 {
+		return nil, errors.New("wrong number of arguments for command hpersist")
+	}
+
+	key := args[0]
+
+	fields, err := parseHashFields(args[1:], 1)
+	if err != nil {
+		return respAsError(err.Error()), nil
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	hash, err := s.findHash(key)
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+
+	modified := false
+	results := make([][]byte, 0, len(fields))
+	for _, field := range fields {
+		if hash == nil {
+			results = append(results, respAsInteger(hashFieldNotFound))
+			continue
+		}
+
+		val, ok := hash.Get(field)
+		if !ok {
+			results = append(results, respAsInteger(hashFieldNotFound))
+			continue
+		}
+
+		if !val.HasExpiry() {
+			results = append(results, respAsInteger(hashFieldNoExpiry))
+			continue
+		}
+
+		val.Persist()
+		modified = true
+		results = append(results, respAsInteger(hashFieldPersisted))
+	}
+
+	if modified {
+		s.signalModifiedKey(key)
+		s.notifyKeyspaceEvent(notifyHash, "hpersist", key)
+	}
+
+	s.deleteHashIfEmpty(key, hash)
+
+	return respAsByteArrays(results)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+)
+
+func (s *server) handleCommandHSet(args []string) ([]byte, error) {
+	if len(args) < 3 || len(args)%2 == 0 {
+		return nil, errors.New("command hset requires a key and field-value pairs")
+	}
+
+	key := args[0]
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	hash, err := s.findHash(key)
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+
+	isNew := hash == nil
+	hash, _ = s.findOrCreateHash(key)
+
+	added := 0
+	for i := 1; i < len(args); i += 2 {
+		if hash.Set(args[i], args[i+1]) {
+			added++
+		}
+	}
+
+	s.signalModifiedKey(key)
+
+	if isNew {
+		s.notifyKeyspaceEvent(notifyNew, "new", key)
+	}
+	s.notifyKeyspaceEvent(notifyHash, "hset", key)
+
+	return respAsInteger(added), nil
+}
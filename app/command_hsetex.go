@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+func (s *server) handleCommandHSetEx(args []string) ([]byte, error) {
+	if len(args) < 4 {
+		return nil, errors.New("wrong number of arguments for command hsetex")
+	}
+
+	key := args[0]
+
+	var expiry hashFieldExpiry
+	var condition string
+
+	idx := 1
+	for idx < len(args) && !strings.EqualFold(args[idx], "fields") {
+		switch opt := strings.ToLower(args[idx]); opt {
+		case "fnx", "fxx":
+			if len(condition) > 0 {
+				return respAsError("syntax error"), nil
+			}
+			condition = opt
+			idx++
+		case "keepttl":
+			if expiry.at != nil || expiry.keepTTL {
+				return respAsError("syntax error"), nil
+			}
+			expiry.keepTTL = true
+			idx++
+		default:
+			n, err := parseHashFieldExpiry(args[idx:], &expiry)
+			if err != nil {
+				return respAsError(err.Error()), nil
+			}
+			if n == 0 {
+				return respAsError("syntax error"), nil
+			}
+			idx += n
+		}
+	}
+
+	fieldsAndVals, err := parseHashFields(args[idx:], 2)
+	if err != nil {
+		return respAsError(err.Error()), nil
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	hash, err := s.findHash(key)
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+
+	if len(condition) > 0 {
+		for i := 0; i < len(fieldsAndVals); i += 2 {
+			exists := false
+			if hash != nil {
+				_, exists = hash.Get(fieldsAndVals[i])
+			}
+			if (condition == "fnx" && exists) || (condition == "fxx" && !exists) {
+				return respAsInteger(0), nil
+			}
+		}
+	}
+
+	isNew := hash == nil
+	hash, _ = s.findOrCreateHash(key)
+
+	for i := 0; i < len(fieldsAndVals); i += 2 {
+		field, val := fieldsAndVals[i], fieldsAndVals[i+1]
+
+		if expiry.keepTTL {
+			hash.SetKeepTTL(field, val)
+			continue
+		}
+
+		hash.Set(field, val)
+		if expiry.at != nil {
+			hash.ExpireField(field, *expiry.at)
+		}
+	}
+
+	s.signalModifiedKey(key)
+
+	if isNew {
+		s.notifyKeyspaceEvent(notifyNew, "new", key)
+	}
+	s.notifyKeyspaceEvent(notifyHash, "hset", key)
+	if expiry.at != nil {
+		s.trackVolatileKey(key)
+		s.notifyKeyspaceEvent(notifyHash, "hexpire", key)
+	}
+
+	s.deleteHashIfEmpty(key, hash)
+
+	return respAsInteger(1), nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// handleCommandHTTL implements HTTL, HPTTL, HEXPIRETIME and HPEXPIRETIME.
+// unit is the unit of the replies, and absolute tells whether to reply with
+// unix timestamps rather than remaining TTLs.
+func (s *server) handleCommandHTTL(args []string, unit time.Duration, absolute bool) ([]byte, error) {
+	if len(args) < 3 {
+		return nil, errors.New("wrong number of arguments for hash field ttl command")
+	}
+
+	key := args[0]
+
+	fields, err := parseHashFields(args[1:], 1)
+	if err != nil {
+		return respAsError(err.Error()), nil
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	hash, err := s.findHash(key)
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+
+	now := time.Now().UTC()
+
+	results := make([][]byte, 0, len(fields))
+	for _, field := range fields {
+		if hash == nil {
+			results = append(results, respAsInteger(hashFieldNotFound))
+			continue
+		}
+
+		val, ok := hash.Get(field)
+		if !ok {
+			results = append(results, respAsInteger(hashFieldNotFound))
+			continue
+		}
+
+		at, hasExpiry := val.ExpiresAt()
+		if !hasExpiry {
+			results = append(results, respAsInteger(hashFieldNoExpiry))
+			continue
+		}
+
+		var millis int64
+		if absolute {
+			millis = at.UnixMilli()
+		} else {
+			millis = at.Sub(now).Milliseconds()
+		}
+
+		if unit == time.Second {
+			if absolute {
+				results = append(results, respAsInteger(int(millis/1000)))
+			} else {
+				results = append(results, respAsInteger(int((millis+500)/1000)))
+			}
+		} else {
+			results = append(results, respAsInteger(int(millis)))
+		}
+	}
+
+	s.deleteHashIfEmpty(key, hash)
+
+	return respAsByteArrays(results)
+}
@@ -9,26 +9,38 @@ import (
 func (s *server) handleCommandIncr(args []string) ([]byte, error) {
 	key := args[0]
 
-	s.dataMu.RLock()
+	s.dataMu.Lock()
+	if s.isStream(key) {
+		s.dataMu.Unlock()
+		return respAsWrongTypeError(), nil
+	}
+	s.expireIfNeeded(key)
 	expVal, ok := s.data[key]
-	s.dataMu.RUnlock()
+	isNew := !ok || expVal.HasExpired()
 	var newVal int
-	if !ok {
+	if isNew {
 		newVal = 1
-		s.dataMu.Lock()
 		s.data[key] = storage.NewExpiringValue(strconv.Itoa(newVal))
+	} else if !expVal.IsString() {
 		s.dataMu.Unlock()
+		return respAsWrongTypeError(), nil
 	} else {
 		val, err := strconv.Atoi(expVal.Val)
 		if err != nil {
-			return respAsError("value is not an integer or out of range"), nil
-		} else {
-			newVal = val + 1
-			s.dataMu.Lock()
-			s.data[key].Val = strconv.Itoa(newVal)
 			s.dataMu.Unlock()
+			return respAsError("value is not an integer or out of range"), nil
 		}
+		newVal = val + 1
+		expVal.Val = strconv.Itoa(newVal)
+	}
+	s.dataMu.Unlock()
+
+	s.signalModifiedKey(key)
+
+	if isNew {
+		s.notifyKeyspaceEvent(notifyNew, "new", key)
 	}
+	s.notifyKeyspaceEvent(notifyString, "incrby", key)
 
 	return respAsInteger(newVal), nil
 }
@@ -5,19 +5,19 @@ import (
 	"strings"
 )
 
-func (s *server) handleCommandInfo(client *Client, args []string) error {
+func (s *server) handleCommandInfo(args []string) ([]byte, error) {
 	if len(args) != 1 {
-		return errors.New("not yet supported")
+		return nil, errors.New("not yet supported")
 	}
 
-	switch ServerInfoSection(args[0]) {
+	switch ServerInfoSection(strings.ToLower(args[0])) {
 	case replication:
 		respStr := strings.Join(s.replicationInfo(), "\n")
-		_, err := client.Write(respAsBulkString(respStr))
-		if err != nil {
-			return err
-		}
+		return respAsBulkString(respStr), nil
+	case persistenceSection:
+		respStr := strings.Join(s.persistenceInfo(), "\n")
+		return respAsBulkString(respStr), nil
 	}
 
-	return nil
+	return nil, nil
 }
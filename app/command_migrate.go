@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const migrateDefaultTimeout = time.Second
+
+// migrateKey is a key being moved by MIGRATE, serialized as DUMP does.
+type migrateKey struct {
+	key     string
+	payload []byte
+	// ttl is the time to live of the key in milliseconds, or 0.
+	ttl int64
+}
+
+// migrateOptions are the options of MIGRATE besides the keys.
+type migrateOptions struct {
+	copy     bool
+	replace  bool
+	username string
+	password string
+}
+
+// handleCommandMigrate moves keys to another instance: they are restored
+// there with RESTORE, then deleted unless COPY is given. Like in Redis, it
+// blocks every other command until done, so that keys do not change
+// between being dumped and deleted. Keys that do not exist are skipped.
+func (s *server) handleCommandMigrate(args []string) ([]byte, error) {
+	host, port, key := args[0], args[1], args[2]
+
+	db, err := strconv.Atoi(args[3])
+	if err != nil || db < 0 {
+		return respAsError("value is not an integer or out of range"), nil
+	}
+	timeoutMs, err := strconv.ParseInt(args[4], 10, 64)
+	if err != nil {
+		return respAsError("value is not an integer or out of range"), nil
+	}
+	timeout := time.Duration(timeoutMs) * time.Millisecond
+	if timeout <= 0 {
+		timeout = migrateDefaultTimeout
+	}
+
+	var opts migrateOptions
+	keys := []string{key}
+
+	for i := 5; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "copy":
+			opts.copy = true
+		case "replace":
+			opts.replace = true
+		case "auth":
+			if i+1 >= len(args) {
+				return respAsError(ErrSyntax.Error()), nil
+			}
+			opts.password = args[i+1]
+			i++
+		case "auth2":
+			if i+2 >= len(args) {
+				return respAsError(ErrSyntax.Error()), nil
+			}
+			opts.username, opts.password = args[i+1], args[i+2]
+			i += 2
+		case "keys":
+			if len(key) > 0 {
+				return respAsError("When using MIGRATE KEYS option, the key argument must be set to the empty string"), nil
+			}
+			keys = args[i+1:]
+			i = len(args)
+		default:
+			return respAsError(ErrSyntax.Error()), nil
+		}
+	}
+
+	var toMigrate []migrateKey
+	for _, key := range keys {
+		payload, expiresAt, ok := s.dumpKey(key)
+		if !ok {
+			continue
+		}
+
+		mk := migrateKey{key: key, payload: payload}
+		if expiresAt != nil {
+			mk.ttl = max(time.Until(*expiresAt).Milliseconds(), 1)
+		}
+		toMigrate = append(toMigrate, mk)
+	}
+
+	if len(toMigrate) == 0 {
+		return respAsSimpleString("NOKEY"), nil
+	}
+
+	// A cached connection may have been closed by the target since it was
+	// last used, so the transfer is retried once on a new one, unless it
+	// timed out.
+	addr := net.JoinHostPort(host, port)
+	var replies []error
+	for retry := true; ; retry = false {
+		replies, err = s.migrateKeys(addr, db, timeout, opts, toMigrate)
+		if err == nil {
+			break
+		}
+
+		var netErr net.Error
+		var targetErr *targetError
+		if errors.As(err, &targetErr) {
+			return respAsError(fmt.Sprintf("Target instance replied with error: %s", targetErr.msg)), nil
+		}
+		if !retry || (errors.As(err, &netErr) && netErr.Timeout()) {
+			return respAsCodedError("IOERR", fmt.Sprintf("error or timeout reading to target instance: %v", err)), nil
+		}
+	}
+
+	var firstErr error
+	var deleted []string
+	for i, err := range replies {
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if opts.copy {
+			continue
+		}
+
+		key := toMigrate[i].key
+		if s.deleteKey(key) {
+			deleted = append(deleted, key)
+			s.signalModifiedKey(key)
+			s.notifyKeyspaceEvent(notifyGeneric, "del", key)
+		}
+	}
+
+	// MIGRATE is not propagated itself, as replicas and the append-only file
+	// only need to drop the keys.
+	if len(deleted) > 0 {
+		err := s.propagateCommand(&command{name: cmdDel, args: deleted}, propagateAll)
+		if err != nil {
+			fmt.Println("Failed propagating to slaves: ", err)
+		}
+	}
+
+	if firstErr != nil {
+		return respAsError(fmt.Sprintf("Target instance replied with error: %s", firstErr)), nil
+	}
+
+	return okSimpleString(), nil
+}
+
+// migrateKeys sends the keys to the target in a single batch of RESTORE
+// commands, preceded by AUTH and SELECT if needed, and returns the reply to
+// each RESTORE. A failed AUTH or SELECT is returned as a *targetError, and
+// the connection is dropped on any other error.
+func (s *server) migrateKeys(addr string, db int, timeout time.Duration, opts migrateOptions, keys []migrateKey) ([]error, error) {
+	c, err := s.migrateConns.get(addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, err := c.restore(db, timeout, opts, keys)
+	if err != nil {
+		var targetErr *targetError
+		if !errors.As(err, &targetErr) {
+			s.migrateConns.close(addr)
+		}
+		return nil, err
+	}
+
+	return replies, nil
+}
+
+func (c *migrateConn) restore(db int, timeout time.Duration, opts migrateOptions, keys []migrateKey) ([]error, error) {
+	var cmds []*command
+	if len(opts.password) > 0 {
+		auth := &command{name: "auth", args: []string{opts.password}}
+		if len(opts.username) > 0 {
+			auth.args = []string{opts.username, opts.password}
+		}
+		cmds = append(cmds, auth)
+	}
+
+	selectDb := c.db != db
+	if selectDb {
+		cmds = append(cmds, &command{name: "select", args: []string{strconv.Itoa(db)}})
+	}
+
+	for _, key := range keys {
+		restore := &command{name: cmdRestore, args: []string{key.key, strconv.FormatInt(key.ttl, 10), string(key.payload)}}
+		if opts.replace {
+			restore.args = append(restore.args, "REPLACE")
+		}
+		cmds = append(cmds, restore)
+	}
+
+	var batch []byte
+	for _, cmd := range cmds {
+		encoded, err := cmd.encode()
+		if err != nil {
+			return nil, err
+		}
+		batch = append(batch, encoded...)
+	}
+
+	if err := c.conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	if _, err := c.conn.Write(batch); err != nil {
+		return nil, err
+	}
+
+	// Every reply is read even after an error, so that the connection can
+	// be reused.
+	var setupErr error
+	for i := 0; i < len(cmds)-len(keys); i++ {
+		if _, err := c.readReply(); err != nil {
+			var targetErr *targetError
+			if !errors.As(err, &targetErr) {
+				return nil, err
+			}
+			if setupErr == nil {
+				setupErr = err
+			}
+		}
+	}
+
+	replies := make([]error, len(keys))
+	for i := range keys {
+		_, err := c.readReply()
+		var targetErr *targetError
+		if err != nil && !errors.As(err, &targetErr) {
+			return nil, err
+		}
+		replies[i] = err
+	}
+
+	if setupErr != nil {
+		return nil, setupErr
+	}
+	if selectDb {
+		c.db = db
+	}
+
+	return replies, nil
+}
@@ -3,6 +3,7 @@ package main
 func (s *server) handleCommandMulti(client *Client) error {
 	err := client.Transaction.Open()
 	if err != nil {
+		_, err = client.Write(respAsError("MULTI calls can not be nested"))
 		return err
 	}
 
@@ -1,12 +1,23 @@
 package main
 
-func (s *server) handleCommandPing(client *Client) error {
-	if s.isMaster() {
-		_, err := client.Write(respAsSimpleString("PONG"))
-		if err != nil {
-			return err
+func (s *server) handleCommandPing(client *Client, args []string) ([]byte, error) {
+	if len(args) > 1 {
+		return respAsError("wrong number of arguments for 'ping' command"), nil
+	}
+
+	// In subscribed mode, RESP2 clients get the reply in the same shape as
+	// published messages.
+	if client.protocol < resp3 && s.pubsub.isSubscribed(client) {
+		message := respAsEmptyBulkString()
+		if len(args) == 1 {
+			message = respAsBulkString(args[0])
 		}
+		return respAsByteArrays([][]byte{respAsBulkString("pong"), message})
+	}
+
+	if len(args) == 1 {
+		return respAsBulkString(args[0]), nil
 	}
 
-	return nil
+	return respAsSimpleString("PONG"), nil
 }
@@ -1,25 +1,35 @@
 package main
 
 import (
-	"encoding/base64"
+	"bytes"
 	"fmt"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/rdb"
 )
 
+// handleCommandPsync always answers with a full resynchronization: a
+// snapshot of the dataset in the RDB format, after which the replica
+// receives the write commands. Callers must hold execMu exclusively, so that
+// no write happens between the snapshot and the registration of the
+// replica.
 func (s *server) handleCommandPsync(client *Client) error {
 	resp := fmt.Sprintf("FULLRESYNC %s %d", s.masterReplId, s.masterReplOffset)
 
-	_, err := client.Write(respAsSimpleString(resp))
-	if err != nil {
+	var fileData bytes.Buffer
+	enc := rdb.NewEncoder(&fileData)
+	enc.WriteHeader(s.rdbAuxFields(false))
+	enc.WriteDatabase(0, s.rdbSnapshot())
+	enc.WriteEOF(s.rdbChecksum.Load())
+	if err := enc.Err(); err != nil {
 		return err
 	}
 
-	emptyFileBase64 := "UkVESVMwMDEx+glyZWRpcy12ZXIFNy4yLjD6CnJlZGlzLWJpdHPAQPoFY3RpbWXCbQi8ZfoIdXNlZC1tZW3CsMQQAPoIYW9mLWJhc2XAAP/wbjv+wP9aog=="
-	fileData, err := base64.StdEncoding.DecodeString(emptyFileBase64)
+	_, err := client.Write(respAsSimpleString(resp))
 	if err != nil {
 		return err
 	}
 
-	_, err = client.Write(respAsFileData(fileData))
+	_, err = client.Write(respAsFileData(fileData.Bytes()))
 	if err != nil {
 		return err
 	}
@@ -29,31 +39,5 @@ func (s *server) handleCommandPsync(client *Client) error {
 	s.slaves = append(s.slaves, client.Conn)
 	s.slavesMu.Unlock()
 
-	s.dataMu.RLock()
-	for k, v := range s.data {
-		resp := make([]string, 0, 5)
-		resp = append(resp, "SET")
-		resp = append(resp, k)
-		resp = append(resp, v.Val)
-		if px := v.ExpiresIn; px > 0 {
-			pxBytes, err := intToByteSlice(px)
-			if err != nil {
-				continue
-			}
-			resp = append(resp, "px")
-			resp = append(resp, string(pxBytes))
-		}
-		r, err := respAsArray(resp)
-		if err != nil {
-			continue
-		}
-
-		_, err = client.Write(r)
-		if err != nil {
-			return err
-		}
-	}
-	s.dataMu.RUnlock()
-
 	return nil
 }
@@ -0,0 +1,33 @@
+package main
+
+import "fmt"
+
+// handleCommandPublish delivers a message to the local subscribers. On a
+// master, the message is also propagated to the slaves so that clients
+// subscribed on replicas receive it too.
+func (s *server) handleCommandPublish(args []string) ([]byte, error) {
+	receivers := s.pubsub.publish(args[0], args[1])
+
+	if s.isMaster() {
+		err := s.propagateCommand(&command{name: cmdPublish, args: args}, propagateRepl)
+		if err != nil {
+			fmt.Println("Failed propagating to slaves: ", err)
+		}
+	}
+
+	return respAsInteger(receivers), nil
+}
+
+// handleCommandSPublish is like handleCommandPublish, for shard channels.
+func (s *server) handleCommandSPublish(args []string) ([]byte, error) {
+	receivers := s.pubsub.shardPublish(args[0], args[1])
+
+	if s.isMaster() {
+		err := s.propagateCommand(&command{name: cmdSPublish, args: args}, propagateRepl)
+		if err != nil {
+			fmt.Println("Failed propagating to slaves: ", err)
+		}
+	}
+
+	return respAsInteger(receivers), nil
+}
@@ -0,0 +1,39 @@
+package main
+
+func (s *server) handleCommandPubSubChannels(args []string, isShard bool) ([]byte, error) {
+	name := "pubsub|channels"
+	if isShard {
+		name = "pubsub|shardchannels"
+	}
+
+	if len(args) > 1 {
+		return respAsError("wrong number of arguments for '" + name + "' command"), nil
+	}
+
+	pattern := ""
+	if len(args) == 1 {
+		pattern = args[0]
+	}
+
+	if isShard {
+		return respAsArray(s.pubsub.activeShardChannels(pattern))
+	}
+	return respAsArray(s.pubsub.activeChannels(pattern))
+}
+
+func (s *server) handleCommandPubSubNumSub(args []string, isShard bool) ([]byte, error) {
+	resps := make([][]byte, 0, len(args)*2)
+	for _, channel := range args {
+		count := s.pubsub.numSub(channel)
+		if isShard {
+			count = s.pubsub.shardNumSub(channel)
+		}
+		resps = append(resps, respAsBulkString(channel), respAsInteger(count))
+	}
+
+	return respAsMap(resp2, resps), nil
+}
+
+func (s *server) handleCommandPubSubNumPat() ([]byte, error) {
+	return respAsInteger(s.pubsub.numPat()), nil
+}
@@ -23,7 +23,7 @@ func (s *server) handleCommandReplconfGetAck(client *Client) error {
 		return err
 	}
 
-	_, err = client.Write(resp)
+	_, err = client.Conn.Write(resp)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/rdb"
+)
+
+// handleCommandRestore creates a key from a value serialized by DUMP. The
+// TTL is in milliseconds, or a Unix time in milliseconds with ABSTTL, and 0
+// means no expiry. Streams can not expire, so their TTL is ignored.
+//
+// IDLETIME and FREQ are validated for compatibility, but there is no
+// eviction for them to feed.
+func (s *server) handleCommandRestore(args []string) ([]byte, error) {
+	key, rawTTL, payload := args[0], args[1], args[2]
+
+	var replace, absTTL, idleTime, freq bool
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToLower(args[i]); {
+		case opt == "replace":
+			replace = true
+		case opt == "absttl":
+			absTTL = true
+		case opt == "idletime" && i+1 < len(args) && !freq:
+			i++
+			idle, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				return respAsError("value is not an integer or out of range"), nil
+			}
+			if idle < 0 {
+				return respAsError("Invalid IDLETIME value, must be >= 0"), nil
+			}
+			idleTime = true
+		case opt == "freq" && i+1 < len(args) && !idleTime:
+			i++
+			f, err := strconv.ParseInt(args[i], 10, 64)
+			if err != nil {
+				return respAsError("value is not an integer or out of range"), nil
+			}
+			if f < 0 || f > 255 {
+				return respAsError("Invalid FREQ value, must be >= 0 and <= 255"), nil
+			}
+			freq = true
+		default:
+			return respAsError(ErrSyntax.Error()), nil
+		}
+	}
+
+	ttl, err := strconv.ParseInt(rawTTL, 10, 64)
+	if err != nil {
+		return respAsError("value is not an integer or out of range"), nil
+	}
+	if ttl < 0 {
+		return respAsError("Invalid TTL value, must be >= 0"), nil
+	}
+
+	var expiresAt *time.Time
+	if ttl > 0 {
+		at := time.UnixMilli(ttl)
+		if !absTTL {
+			at = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		}
+		expiresAt = &at
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	s.expireIfNeeded(key)
+	_, exists := s.data[key]
+	exists = exists || s.isStream(key)
+
+	if exists && !replace {
+		return respAsCodedError("BUSYKEY", "Target key name already exists."), nil
+	}
+
+	obj, err := rdb.Restore([]byte(payload))
+	if err != nil {
+		return respAsError(err.Error()), nil
+	}
+
+	if exists {
+		delete(s.data, key)
+		s.deleteStream(key)
+	}
+
+	// A key restored already expired is only deleted, which loadRDBEntry
+	// takes care of by skipping it.
+	if err := s.loadRDBEntry(rdb.Entry{Key: key, ExpiresAt: expiresAt, Object: obj}); err != nil {
+		return respAsError(rdb.ErrDataFormat.Error()), nil
+	}
+
+	_, restored := s.data[key]
+	restored = restored || s.isStream(key)
+
+	if restored || exists {
+		s.signalModifiedKey(key)
+	}
+	if restored {
+		s.notifyKeyspaceEvent(notifyGeneric, "restore", key)
+	} else if exists {
+		s.notifyKeyspaceEvent(notifyGeneric, "del", key)
+	}
+
+	return okSimpleString(), nil
+}
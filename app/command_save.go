@@ -0,0 +1,38 @@
+package main
+
+import "strings"
+
+func (s *server) handleCommandSave() ([]byte, error) {
+	err := s.saveRDB()
+	if err != nil {
+		return respAsError(err.Error()), nil
+	}
+
+	return okSimpleString(), nil
+}
+
+// handleCommandBgSave starts a background save. With SCHEDULE, a save that
+// can not start while the append-only file is rewritten starts once the
+// rewrite is done.
+func (s *server) handleCommandBgSave(args []string) ([]byte, error) {
+	if len(args) > 1 || (len(args) == 1 && !strings.EqualFold(args[0], "schedule")) {
+		return respAsError(ErrSyntax.Error()), nil
+	}
+
+	scheduled, err := s.bgsaveRDB(len(args) == 1)
+	if err != nil {
+		return respAsError(err.Error()), nil
+	}
+
+	if scheduled {
+		return respAsSimpleString("Background saving scheduled"), nil
+	}
+	return respAsSimpleString("Background saving started"), nil
+}
+
+func (s *server) handleCommandLastSave() ([]byte, error) {
+	s.persistence.mu.Lock()
+	defer s.persistence.mu.Unlock()
+
+	return respAsInteger(int(s.persistence.lastSave.Unix())), nil
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/codecrafters-io/redis-starter-go/app/internal/storage"
 )
@@ -37,7 +38,7 @@ func (s *server) handleCommandSet(args []string) error {
 
 	if len(args) > 2 {
 		extraArg := args[2]
-		if !strings.EqualFold(extraArg, "px") {
+		if !strings.EqualFold(extraArg, "px") && !strings.EqualFold(extraArg, "pxat") {
 			return fmt.Errorf("unknown extra argument \"%s\"", extraArg)
 		}
 
@@ -46,12 +47,35 @@ func (s *server) handleCommandSet(args []string) error {
 			return err
 		}
 
-		expVal.ExpiresIn = exp
+		// PXAT is written to the append-only file in place of PX, so that
+		// replaying it does not extend the expiry.
+		if strings.EqualFold(extraArg, "pxat") {
+			expVal.SetExpiresAt(time.UnixMilli(int64(exp)).UTC())
+		} else {
+			expVal.ExpiresIn = exp
+		}
 	}
 
 	s.dataMu.Lock()
+	s.expireIfNeeded(key)
+	_, existed := s.data[key]
+	// SET replaces a value of any type, streams included.
+	existed = s.deleteStream(key) || existed
 	s.data[key] = expVal
+	if expVal.HasExpiry() {
+		s.trackVolatileKey(key)
+	}
 	s.dataMu.Unlock()
 
+	s.signalModifiedKey(key)
+
+	if !existed {
+		s.notifyKeyspaceEvent(notifyNew, "new", key)
+	}
+	s.notifyKeyspaceEvent(notifyString, "set", key)
+	if expVal.HasExpiry() {
+		s.notifyKeyspaceEvent(notifyGeneric, "expire", key)
+	}
+
 	return nil
 }
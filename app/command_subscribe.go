@@ -0,0 +1,70 @@
+package main
+
+// subscribeReplyKinds lists the kind of the reply sent for every subscribed
+// and unsubscribed channel, per kind of subscription.
+var subscribeReplyKinds = map[subscriptionKind][2]string{
+	channelSubscription:      {"subscribe", "unsubscribe"},
+	patternSubscription:      {"psubscribe", "punsubscribe"},
+	shardChannelSubscription: {"ssubscribe", "sunsubscribe"},
+}
+
+// handleCommandSubscribe implements SUBSCRIBE, PSUBSCRIBE and SSUBSCRIBE,
+// replying with one confirmation per channel or pattern.
+func (s *server) handleCommandSubscribe(client *Client, args []string, kind subscriptionKind) ([]byte, error) {
+	replyKind := subscribeReplyKinds[kind][0]
+
+	resp := make([]byte, 0)
+	for _, channel := range args {
+		count := s.pubsub.subscribe(client, channel, kind)
+		resp = append(resp, respAsPush(client.protocol, [][]byte{
+			respAsBulkString(replyKind),
+			respAsBulkString(channel),
+			respAsInteger(count),
+		})...)
+	}
+
+	return resp, nil
+}
+
+// handleCommandUnsubscribe implements UNSUBSCRIBE, PUNSUBSCRIBE and
+// SUNSUBSCRIBE. Without arguments, the client is unsubscribed from all its
+// subscriptions of that kind.
+func (s *server) handleCommandUnsubscribe(client *Client, args []string, kind subscriptionKind) ([]byte, error) {
+	replyKind := subscribeReplyKinds[kind][1]
+
+	channels := args
+	if len(channels) == 0 {
+		channels = s.pubsub.subscriptions(client, kind)
+	}
+
+	if len(channels) == 0 {
+		return respAsPush(client.protocol, [][]byte{
+			respAsBulkString(replyKind),
+			respAsBulkString(""),
+			respAsInteger(0),
+		}), nil
+	}
+
+	resp := make([]byte, 0)
+	for _, channel := range channels {
+		count := s.pubsub.unsubscribe(client, channel, kind)
+		resp = append(resp, respAsPush(client.protocol, [][]byte{
+			respAsBulkString(replyKind),
+			respAsBulkString(channel),
+			respAsInteger(count),
+		})...)
+	}
+
+	return resp, nil
+}
+
+// isAllowedInSubscribedMode reports whether a RESP2 client with active
+// subscriptions may run the command name.
+func isAllowedInSubscribedMode(name string) bool {
+	switch name {
+	case cmdSubscribe, cmdUnsubscribe, cmdPSubscribe, cmdPUnsubscribe, cmdSSubscribe, cmdSUnsubscribe, cmdPing:
+		return true
+	default:
+		return false
+	}
+}
@@ -6,15 +6,30 @@ import (
 )
 
 func (s *server) handleCommandType(args []string) ([]byte, error) {
+	s.dataMu.Lock()
+	expired := s.expireIfNeeded(args[0])
 	val, ok := s.data[args[0]]
-	if !ok {
-		stream := s.findStream(args[0])
-		if stream == nil {
+	isStream := s.isStream(args[0])
+	s.dataMu.Unlock()
+
+	if !ok || expired {
+		if !isStream {
 			return respAsSimpleString("none"), nil
 		}
 		return respAsSimpleString("stream"), nil
 	}
 
+	switch {
+	case val.IsHash():
+		return respAsSimpleString("hash"), nil
+	case val.IsList():
+		return respAsSimpleString("list"), nil
+	case val.IsSet():
+		return respAsSimpleString("set"), nil
+	case val.IsZSet():
+		return respAsSimpleString("zset"), nil
+	}
+
 	t := reflect.TypeOf(val.Val).Kind()
 	if t == reflect.String {
 		return respAsSimpleString("string"), nil
@@ -8,14 +8,22 @@ import (
 )
 
 func (s *server) handleCommandWait(client *Client, args []string) error {
-	if len(s.data) == 0 {
-		_, err := client.Write(respAsInteger(len(s.slaves)))
+	s.dataMu.RLock()
+	empty := len(s.data) == 0 && len(s.streams.Streams) == 0
+	s.dataMu.RUnlock()
+
+	s.slavesMu.Lock()
+	slaves := append([]net.Conn(nil), s.slaves...)
+	s.slavesMu.Unlock()
+
+	if empty {
+		_, err := client.Write(respAsInteger(len(slaves)))
 		if err != nil {
 			return err
 		}
 
 	} else {
-		for _, slave := range s.slaves {
+		for _, slave := range slaves {
 			go getAckFromSlave(slave)
 		}
 
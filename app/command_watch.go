@@ -0,0 +1,21 @@
+package main
+
+func (s *server) handleCommandWatch(client *Client, args []string) ([]byte, error) {
+	if len(args) == 0 {
+		return respAsError("wrong number of arguments for 'watch' command"), nil
+	}
+
+	if client.Transaction.IsOpen() {
+		return respAsError("WATCH inside MULTI is not allowed"), nil
+	}
+
+	s.watchKeys(client, args)
+
+	return okSimpleString(), nil
+}
+
+func (s *server) handleCommandUnwatch(client *Client) ([]byte, error) {
+	s.unwatchAllKeys(client)
+
+	return okSimpleString(), nil
+}
@@ -0,0 +1,44 @@
+package main
+
+func (s *server) handleCommandXACK(args []string) ([]byte, error) {
+	if len(args) < 3 {
+		return respAsError("wrong number of arguments for 'xack' command"), nil
+	}
+
+	ids := make([]*StreamEntryId, 0, len(args)-2)
+	for _, rawId := range args[2:] {
+		id, err := parseStreamRangeId(rawId, 0)
+		if err != nil {
+			return respAsError(ErrInvalidStreamIdArg.Error()), nil
+		}
+		ids = append(ids, id)
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	stream, err := s.findStream(args[0])
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+	if stream == nil {
+		return respAsInteger(0), nil
+	}
+
+	group := stream.findGroup(args[1])
+	if group == nil {
+		return respAsInteger(0), nil
+	}
+
+	acked := 0
+	for _, id := range ids {
+		if group.Ack(*id) {
+			acked++
+		}
+	}
+	if acked > 0 {
+		s.signalModifiedKey(args[0])
+	}
+
+	return respAsInteger(acked), nil
+}
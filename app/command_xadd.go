@@ -1,30 +1,93 @@
 package main
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
 
 func (s *server) handleCommandXADD(args []string) ([]byte, error) {
 	streamKey := args[0]
 
-	stream := s.findStream(streamKey)
-	if stream == nil {
+	noMkStream := false
+	var trimOpts *streamTrimOptions
+
+	idx := 1
+options:
+	for idx < len(args) {
+		switch strings.ToLower(args[idx]) {
+		case "nomkstream":
+			noMkStream = true
+			idx++
+		case streamTrimMaxLen, streamTrimMinId:
+			opts, n, err := parseStreamTrimOptions(args[idx:])
+			if err != nil {
+				return respAsError(err.Error()), nil
+			}
+			trimOpts = opts
+			idx += n
+		default:
+			break options
+		}
+	}
+
+	fieldsAndVals := len(args) - idx - 1
+	if fieldsAndVals <= 0 || fieldsAndVals%2 != 0 {
+		return respAsError("wrong number of arguments for 'xadd' command"), nil
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	stream, err := s.findStream(streamKey)
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+	isNewStream := stream == nil
+	if isNewStream {
+		if noMkStream {
+			return respAsBulkString(""), nil
+		}
 		stream = NewStream(streamKey)
-		s.streams.Streams = append(s.streams.Streams, stream)
 	}
 
-	rawId := args[1]
+	rawId := args[idx]
 	entry, err := stream.NewStreamEntry(rawId)
 	if err != nil {
+		if errors.Is(err, ErrStreamExhausted) {
+			return respAsError(err.Error()), nil
+		}
 		return respAsError(fmt.Sprint("The ID specified in XADD ", err.Error())), nil
 	}
 
+	for i := idx + 1; i < len(args)-1; i += 2 {
+		entry.AddData(args[i], args[i+1])
+	}
+
+	if isNewStream {
+		s.streams.Streams[streamKey] = stream
+	}
+
 	stream.AddEntry(entry)
-	if s.streams.IsBlocking {
-		s.streams.EntryAddedChan <- true
+	trimmed := 0
+	if trimOpts != nil {
+		trimmed = stream.trim(trimOpts)
 	}
 
-	for i := 2; i < len(args)-1; i += 2 {
-		entry.AddData(args[i], args[i+1])
+	s.signalModifiedKey(streamKey)
+	s.streams.signalKeyReady(streamKey)
+
+	if isNewStream {
+		s.notifyKeyspaceEvent(notifyNew, "new", streamKey)
 	}
+	s.notifyKeyspaceEvent(notifyStream, "xadd", streamKey)
+	if trimmed > 0 {
+		s.notifyKeyspaceEvent(notifyStream, "xtrim", streamKey)
+	}
+
+	// Propagate the generated ID rather than "*" or a partial ID, so that
+	// replicas store the very same entry.
+	args[idx] = entry.ID.String()
 
 	return respAsBulkString(entry.ID.String()), nil
 }
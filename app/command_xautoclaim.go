@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xautoclaimAttemptsFactor bounds how many PEL entries one XAUTOCLAIM call
+// may scan, relative to its COUNT.
+const xautoclaimAttemptsFactor = 10
+
+func (s *server) handleCommandXAUTOCLAIM(args []string) ([]byte, error) {
+	if len(args) < 5 {
+		return respAsError("wrong number of arguments for 'xautoclaim' command"), nil
+	}
+
+	key, groupName, consumerName := args[0], args[1], args[2]
+
+	minIdle, err := strconv.Atoi(args[3])
+	if err != nil {
+		return respAsError("Invalid min-idle-time argument for XAUTOCLAIM"), nil
+	}
+	minIdle = max(minIdle, 0)
+
+	start, err := parseStreamRangeBound(args[4], true)
+	if err != nil {
+		return respAsError(ErrInvalidStreamIdArg.Error()), nil
+	}
+
+	count := 100
+	var opts xclaimOptions
+
+	for idx := 5; idx < len(args); idx++ {
+		switch strings.ToLower(args[idx]) {
+		case "count":
+			if idx+1 >= len(args) {
+				return respAsError(ErrSyntax.Error()), nil
+			}
+			n, err := strconv.Atoi(args[idx+1])
+			if err != nil || n < 1 {
+				return respAsError("COUNT must be > 0"), nil
+			}
+			count = n
+			idx++
+		case "justid":
+			opts.justId = true
+		default:
+			return respAsError(ErrSyntax.Error()), nil
+		}
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	stream, err := s.findStream(key)
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+	var group *StreamConsumerGroup
+	if stream != nil {
+		group = stream.findGroup(groupName)
+	}
+	if group == nil {
+		return respAsCodedError("NOGROUP", fmt.Sprintf("No such key '%s' or consumer group '%s'", key, groupName)), nil
+	}
+
+	consumer, created := group.CreateConsumer(consumerName)
+
+	now := time.Now().UTC()
+	attempts := count * xautoclaimAttemptsFactor
+	claimedBytes := make([][]byte, 0, count)
+	deletedIds := make([]string, 0)
+	nextId := minStreamEntryId.String()
+
+	for _, pending := range group.sortedPending() {
+		if pending.ID.Compare(start) < 0 {
+			continue
+		}
+
+		if attempts == 0 || len(claimedBytes) >= count {
+			nextId = pending.ID.String()
+			break
+		}
+		attempts--
+
+		entry := stream.findEntry(&pending.ID)
+		if entry == nil {
+			deletedIds = append(deletedIds, pending.ID.String())
+			group.Ack(pending.ID)
+			continue
+		}
+
+		if minIdle > 0 && pending.idle(now) < minIdle {
+			continue
+		}
+
+		claimResp, err := claimPendingEntry(group, pending, consumer, entry, &opts, now)
+		if err != nil {
+			return nil, err
+		}
+
+		claimedBytes = append(claimedBytes, claimResp)
+	}
+
+	consumer.touch(now, len(claimedBytes) > 0)
+	if created || len(claimedBytes) > 0 || len(deletedIds) > 0 {
+		s.signalModifiedKey(key)
+	}
+
+	claimedResp, err := respAsByteArrays(claimedBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	deletedResp, err := respAsArray(deletedIds)
+	if err != nil {
+		return nil, err
+	}
+
+	return respAsByteArrays([][]byte{
+		respAsBulkString(nextId),
+		claimedResp,
+		deletedResp,
+	})
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type xclaimOptions struct {
+	deliveryTime *time.Time
+	retryCount   *int
+	force        bool
+	justId       bool
+	lastId       *StreamEntryId
+}
+
+func (s *server) handleCommandXCLAIM(args []string) ([]byte, error) {
+	if len(args) < 5 {
+		return respAsError("wrong number of arguments for 'xclaim' command"), nil
+	}
+
+	key, groupName, consumerName := args[0], args[1], args[2]
+
+	minIdle, err := strconv.Atoi(args[3])
+	if err != nil {
+		return respAsError("Invalid min-idle-time argument for XCLAIM"), nil
+	}
+	minIdle = max(minIdle, 0)
+
+	ids := make([]*StreamEntryId, 0)
+	idx := 4
+	for ; idx < len(args); idx++ {
+		id, err := parseStreamRangeId(args[idx], 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+
+	now := time.Now().UTC()
+	var opts xclaimOptions
+
+	for ; idx < len(args); idx++ {
+		opt := strings.ToLower(args[idx])
+		switch opt {
+		case "force":
+			opts.force = true
+		case "justid":
+			opts.justId = true
+		case "idle", "time", "retrycount", "lastid":
+			if idx+1 >= len(args) {
+				return respAsError(ErrSyntax.Error()), nil
+			}
+			val := args[idx+1]
+			idx++
+
+			if opt == "lastid" {
+				lastId, err := parseStreamRangeId(val, 0)
+				if err != nil {
+					return respAsError(ErrInvalidStreamIdArg.Error()), nil
+				}
+				opts.lastId = lastId
+				continue
+			}
+
+			n, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return respAsError(fmt.Sprintf("Invalid %s option argument for XCLAIM", strings.ToUpper(opt))), nil
+			}
+
+			switch opt {
+			case "idle":
+				deliveryTime := now.Add(-time.Duration(n) * time.Millisecond)
+				opts.deliveryTime = &deliveryTime
+			case "time":
+				deliveryTime := time.UnixMilli(n).UTC()
+				opts.deliveryTime = &deliveryTime
+			case "retrycount":
+				retryCount := int(n)
+				opts.retryCount = &retryCount
+			}
+		default:
+			return respAsError(fmt.Sprintf("Unrecognized XCLAIM option '%s'", args[idx])), nil
+		}
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	stream, err := s.findStream(key)
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+	var group *StreamConsumerGroup
+	if stream != nil {
+		group = stream.findGroup(groupName)
+	}
+	if group == nil {
+		return respAsCodedError("NOGROUP", fmt.Sprintf("No such key '%s' or consumer group '%s'", key, groupName)), nil
+	}
+
+	// modified tells whether the group changed, in which case the key is
+	// signaled as modified.
+	modified := false
+
+	if opts.lastId != nil && opts.lastId.Compare(group.LastDeliveredId) > 0 {
+		group.LastDeliveredId = opts.lastId
+		modified = true
+	}
+
+	consumer, created := group.CreateConsumer(consumerName)
+	modified = modified || created
+
+	claimedBytes := make([][]byte, 0, len(ids))
+	for _, id := range ids {
+		pending, ok := group.Pending[*id]
+		entry := stream.findEntry(id)
+
+		if !ok {
+			if !opts.force || entry == nil {
+				continue
+			}
+			pending = &StreamPendingEntry{ID: *id, DeliveryTime: now}
+			group.Pending[*id] = pending
+		}
+
+		if entry == nil {
+			group.Ack(*id)
+			modified = true
+			continue
+		}
+
+		if minIdle > 0 && pending.idle(now) < minIdle {
+			continue
+		}
+
+		claimResp, err := claimPendingEntry(group, pending, consumer, entry, &opts, now)
+		if err != nil {
+			return nil, err
+		}
+
+		claimedBytes = append(claimedBytes, claimResp)
+	}
+
+	consumer.touch(now, len(claimedBytes) > 0)
+	if modified || len(claimedBytes) > 0 {
+		s.signalModifiedKey(key)
+	}
+
+	return respAsByteArrays(claimedBytes)
+}
+
+// claimPendingEntry transfers a pending entry to consumer and returns the
+// reply for it: the entry itself, or only its ID for JUSTID.
+func claimPendingEntry(group *StreamConsumerGroup, pending *StreamPendingEntry, consumer *StreamConsumer, entry *StreamEntry, opts *xclaimOptions, now time.Time) ([]byte, error) {
+	group.assign(pending, consumer)
+
+	if opts.deliveryTime != nil {
+		pending.DeliveryTime = *opts.deliveryTime
+	} else {
+		pending.DeliveryTime = now
+	}
+
+	if opts.retryCount != nil {
+		pending.DeliveryCount = *opts.retryCount
+	} else if !opts.justId {
+		pending.DeliveryCount++
+	}
+
+	if opts.justId {
+		return respAsBulkString(pending.ID.String()), nil
+	}
+
+	return entry.encodeToResp()
+}
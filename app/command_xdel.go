@@ -0,0 +1,41 @@
+package main
+
+func (s *server) handleCommandXDEL(args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return respAsError("wrong number of arguments for 'xdel' command"), nil
+	}
+
+	ids := make([]*StreamEntryId, 0, len(args)-1)
+	for _, rawId := range args[1:] {
+		id, err := parseStreamRangeId(rawId, 0)
+		if err != nil {
+			return respAsError(ErrInvalidStreamIdArg.Error()), nil
+		}
+		ids = append(ids, id)
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	stream, err := s.findStream(args[0])
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+	if stream == nil {
+		return respAsInteger(0), nil
+	}
+
+	deleted := 0
+	for _, id := range ids {
+		if stream.DeleteEntry(id) {
+			deleted++
+		}
+	}
+
+	if deleted > 0 {
+		s.signalModifiedKey(args[0])
+		s.notifyKeyspaceEvent(notifyStream, "xdel", args[0])
+	}
+
+	return respAsInteger(deleted), nil
+}
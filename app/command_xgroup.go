@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const errXGroupKeyMissing = "The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically."
+
+// findStreamGroup looks up the stream and consumer group an XGROUP
+// subcommand operates on, returning an error reply if either is missing.
+func (s *server) findStreamGroup(key, groupName string) (*Stream, *StreamConsumerGroup, []byte) {
+	stream, err := s.findStream(key)
+	if err != nil {
+		return nil, nil, respAsWrongTypeError()
+	}
+	if stream == nil {
+		return nil, nil, respAsError(errXGroupKeyMissing)
+	}
+
+	group := stream.findGroup(groupName)
+	if group == nil {
+		return nil, nil, respAsCodedError("NOGROUP", fmt.Sprintf("No such consumer group '%s' for key name '%s'", groupName, key))
+	}
+
+	return stream, group, nil
+}
+
+// parseGroupLastId parses the ID a consumer group starts reading after, where
+// "$" stands for the last ID of the stream.
+func (s *Stream) parseGroupLastId(rawId string) (*StreamEntryId, error) {
+	if rawId == "$" {
+		if s.LastId == nil {
+			id := minStreamEntryId
+			return &id, nil
+		}
+		id := *s.LastId
+		return &id, nil
+	}
+
+	id, err := parseStreamRangeId(rawId, 0)
+	if err != nil {
+		return nil, ErrInvalidStreamIdArg
+	}
+
+	return id, nil
+}
+
+func parseEntriesRead(raw string) (int, error) {
+	entriesRead, err := strconv.Atoi(raw)
+	if err != nil {
+		return 0, fmt.Errorf("value is not an integer or out of range")
+	}
+
+	if entriesRead < 0 && entriesRead != streamGroupEntriesReadUnknown {
+		return 0, fmt.Errorf("value for ENTRIESREAD must be positive or -1")
+	}
+
+	return entriesRead, nil
+}
+
+func (s *server) handleCommandXGroupCreate(args []string) ([]byte, error) {
+	if len(args) < 3 {
+		return respAsError("wrong number of arguments for 'xgroup|create' command"), nil
+	}
+
+	key, groupName, rawId := args[0], args[1], args[2]
+
+	mkStream := false
+	entriesRead := streamGroupEntriesReadUnknown
+
+	for i := 3; i < len(args); i++ {
+		switch strings.ToLower(args[i]) {
+		case "mkstream":
+			mkStream = true
+		case "entriesread":
+			if i+1 >= len(args) {
+				return respAsError(ErrSyntax.Error()), nil
+			}
+			n, err := parseEntriesRead(args[i+1])
+			if err != nil {
+				return respAsError(err.Error()), nil
+			}
+			entriesRead = n
+			i++
+		default:
+			return respAsError(ErrSyntax.Error()), nil
+		}
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	stream, err := s.findStream(key)
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+	if stream == nil {
+		if !mkStream {
+			return respAsError(errXGroupKeyMissing), nil
+		}
+		stream = NewStream(key)
+		s.streams.Streams[key] = stream
+	}
+
+	lastId, err := stream.parseGroupLastId(rawId)
+	if err != nil {
+		return respAsError(err.Error()), nil
+	}
+
+	if _, created := stream.CreateGroup(groupName, lastId, entriesRead); !created {
+		return respAsCodedError("BUSYGROUP", "Consumer Group name already exists"), nil
+	}
+
+	s.signalModifiedKey(key)
+	s.notifyKeyspaceEvent(notifyStream, "xgroup-create", key)
+
+	return okSimpleString(), nil
+}
+
+func (s *server) handleCommandXGroupSetId(args []string) ([]byte, error) {
+	if len(args) != 3 && len(args) != 5 {
+		return respAsError("wrong number of arguments for 'xgroup|setid' command"), nil
+	}
+
+	entriesRead := streamGroupEntriesReadUnknown
+	if len(args) == 5 {
+		if !strings.EqualFold(args[3], "entriesread") {
+			return respAsError(ErrSyntax.Error()), nil
+		}
+		n, err := parseEntriesRead(args[4])
+		if err != nil {
+			return respAsError(err.Error()), nil
+		}
+		entriesRead = n
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	stream, group, errResp := s.findStreamGroup(args[0], args[1])
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	lastId, err := stream.parseGroupLastId(args[2])
+	if err != nil {
+		return respAsError(err.Error()), nil
+	}
+
+	group.LastDeliveredId = lastId
+	group.EntriesRead = entriesRead
+
+	s.signalModifiedKey(args[0])
+	s.notifyKeyspaceEvent(notifyStream, "xgroup-setid", args[0])
+
+	return okSimpleString(), nil
+}
+
+func (s *server) handleCommandXGroupDestroy(args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return respAsError("wrong number of arguments for 'xgroup|destroy' command"), nil
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	stream, err := s.findStream(args[0])
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+	if stream == nil {
+		return respAsError(errXGroupKeyMissing), nil
+	}
+
+	if stream.DestroyGroup(args[1]) {
+		s.signalModifiedKey(args[0])
+		s.notifyKeyspaceEvent(notifyStream, "xgroup-destroy", args[0])
+		return respAsInteger(1), nil
+	}
+
+	return respAsInteger(0), nil
+}
+
+func (s *server) handleCommandXGroupCreateConsumer(args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return respAsError("wrong number of arguments for 'xgroup|createconsumer' command"), nil
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	_, group, errResp := s.findStreamGroup(args[0], args[1])
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	if _, created := group.CreateConsumer(args[2]); created {
+		s.signalModifiedKey(args[0])
+		s.notifyKeyspaceEvent(notifyStream, "xgroup-createconsumer", args[0])
+		return respAsInteger(1), nil
+	}
+
+	return respAsInteger(0), nil
+}
+
+func (s *server) handleCommandXGroupDelConsumer(args []string) ([]byte, error) {
+	if len(args) != 3 {
+		return respAsError("wrong number of arguments for 'xgroup|delconsumer' command"), nil
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	_, group, errResp := s.findStreamGroup(args[0], args[1])
+	if errResp != nil {
+		return errResp, nil
+	}
+
+	pending := group.DeleteConsumer(args[2])
+	if pending < 0 {
+		pending = 0
+	} else {
+		s.signalModifiedKey(args[0])
+		s.notifyKeyspaceEvent(notifyStream, "xgroup-delconsumer", args[0])
+	}
+
+	return respAsInteger(pending), nil
+}
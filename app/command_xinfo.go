@@ -0,0 +1,302 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// xinfoFullDefaultCount is how many entries and PEL entries XINFO STREAM FULL
+// reports when no COUNT is given.
+const xinfoFullDefaultCount = 10
+
+func (s *server) handleCommandXInfoStream(args []string) ([]byte, error) {
+	if len(args) < 1 {
+		return respAsError("wrong number of arguments for 'xinfo|stream' command"), nil
+	}
+
+	full := false
+	count := xinfoFullDefaultCount
+
+	if len(args) > 1 {
+		if !strings.EqualFold(args[1], "full") {
+			return respAsError(ErrSyntax.Error()), nil
+		}
+		full = true
+
+		switch {
+		case len(args) == 4 && strings.EqualFold(args[2], "count"):
+			n, err := strconv.Atoi(args[3])
+			if err != nil {
+				return respAsError("value is not an integer or out of range"), nil
+			}
+			count = max(n, 0)
+		case len(args) != 2:
+			return respAsError(ErrSyntax.Error()), nil
+		}
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	stream, err := s.findStream(args[0])
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+	if stream == nil {
+		return respAsError("no such key"), nil
+	}
+
+	radixTreeKeys, radixTreeNodes := stream.radixTreeStats()
+
+	info := [][]byte{
+		respAsBulkString("length"), respAsInteger(stream.Len()),
+		respAsBulkString("radix-tree-keys"), respAsInteger(radixTreeKeys),
+		respAsBulkString("radix-tree-nodes"), respAsInteger(radixTreeNodes),
+		respAsBulkString("last-generated-id"), respAsBulkString(streamIdOrZero(stream.LastId)),
+		respAsBulkString("max-deleted-entry-id"), respAsBulkString(streamIdOrZero(stream.MaxDeletedEntryId)),
+		respAsBulkString("entries-added"), respAsInteger(stream.EntriesAdded),
+		respAsBulkString("recorded-first-entry-id"), respAsBulkString(streamIdOrZero(stream.firstEntryId())),
+	}
+
+	if !full {
+		firstEntryResp, lastEntryResp := respAsBulkString(""), respAsBulkString("")
+		if !stream.isEmpty() {
+			var err error
+			firstEntryResp, err = stream.firstEntry().encodeToResp()
+			if err != nil {
+				return nil, err
+			}
+			lastEntryResp, err = stream.lastEntry().encodeToResp()
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		info = append(info,
+			respAsBulkString("groups"), respAsInteger(len(stream.Groups)),
+			respAsBulkString("first-entry"), firstEntryResp,
+			respAsBulkString("last-entry"), lastEntryResp,
+		)
+
+		return respAsByteArrays(info)
+	}
+
+	entries := stream.rangeEntries(&minStreamEntryId, &maxStreamEntryId, count, false)
+
+	entriesResp, err := encodeEntriesToResp(entries)
+	if err != nil {
+		return nil, err
+	}
+
+	groupsBytes := make([][]byte, 0, len(stream.Groups))
+	for _, group := range stream.sortedGroups() {
+		groupResp, err := encodeGroupFullInfo(stream, group, count)
+		if err != nil {
+			return nil, err
+		}
+		groupsBytes = append(groupsBytes, groupResp)
+	}
+
+	groupsResp, err := respAsByteArrays(groupsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	info = append(info,
+		respAsBulkString("entries"), entriesResp,
+		respAsBulkString("groups"), groupsResp,
+	)
+
+	return respAsByteArrays(info)
+}
+
+func (s *server) handleCommandXInfoGroups(args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return respAsError("wrong number of arguments for 'xinfo|groups' command"), nil
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	stream, err := s.findStream(args[0])
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+	if stream == nil {
+		return respAsError("no such key"), nil
+	}
+
+	groupsBytes := make([][]byte, 0, len(stream.Groups))
+	for _, group := range stream.sortedGroups() {
+		groupResp, err := respAsByteArrays([][]byte{
+			respAsBulkString("name"), respAsBulkString(group.Name),
+			respAsBulkString("consumers"), respAsInteger(len(group.Consumers)),
+			respAsBulkString("pending"), respAsInteger(len(group.Pending)),
+			respAsBulkString("last-delivered-id"), respAsBulkString(group.LastDeliveredId.String()),
+			respAsBulkString("entries-read"), respAsEntriesRead(group.EntriesRead),
+			respAsBulkString("lag"), respAsLag(stream, group),
+		})
+		if err != nil {
+			return nil, err
+		}
+		groupsBytes = append(groupsBytes, groupResp)
+	}
+
+	return respAsByteArrays(groupsBytes)
+}
+
+func (s *server) handleCommandXInfoConsumers(args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return respAsError("wrong number of arguments for 'xinfo|consumers' command"), nil
+	}
+
+	key, groupName := args[0], args[1]
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	stream, err := s.findStream(key)
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+	if stream == nil {
+		return respAsError("no such key"), nil
+	}
+
+	group := stream.findGroup(groupName)
+	if group == nil {
+		return respAsCodedError("NOGROUP", fmt.Sprintf("No such consumer group '%s' for key name '%s'", groupName, key)), nil
+	}
+
+	now := time.Now().UTC()
+
+	consumersBytes := make([][]byte, 0, len(group.Consumers))
+	for _, consumer := range group.sortedConsumers() {
+		inactive := -1
+		if !consumer.ActiveTime.IsZero() {
+			inactive = int(now.Sub(consumer.ActiveTime).Milliseconds())
+		}
+
+		consumerResp, err := respAsByteArrays([][]byte{
+			respAsBulkString("name"), respAsBulkString(consumer.Name),
+			respAsBulkString("pending"), respAsInteger(len(consumer.Pending)),
+			respAsBulkString("idle"), respAsInteger(int(now.Sub(consumer.SeenTime).Milliseconds())),
+			respAsBulkString("inactive"), respAsInteger(inactive),
+		})
+		if err != nil {
+			return nil, err
+		}
+		consumersBytes = append(consumersBytes, consumerResp)
+	}
+
+	return respAsByteArrays(consumersBytes)
+}
+
+// encodeGroupFullInfo encodes a consumer group for XINFO STREAM FULL, listing
+// at most count PEL entries for the group and for each consumer, or all of
+// them when count is 0.
+func encodeGroupFullInfo(stream *Stream, group *StreamConsumerGroup, count int) ([]byte, error) {
+	pelBytes := make([][]byte, 0)
+	for _, pending := range group.sortedPending() {
+		if count > 0 && len(pelBytes) >= count {
+			break
+		}
+
+		pendingResp, err := respAsByteArrays([][]byte{
+			respAsBulkString(pending.ID.String()),
+			respAsBulkString(pending.Consumer.Name),
+			respAsInteger(int(pending.DeliveryTime.UnixMilli())),
+			respAsInteger(pending.DeliveryCount),
+		})
+		if err != nil {
+			return nil, err
+		}
+		pelBytes = append(pelBytes, pendingResp)
+	}
+
+	pelResp, err := respAsByteArrays(pelBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	consumersBytes := make([][]byte, 0, len(group.Consumers))
+	for _, consumer := range group.sortedConsumers() {
+		consumerPelBytes := make([][]byte, 0)
+		for _, pending := range consumer.sortedPending() {
+			if count > 0 && len(consumerPelBytes) >= count {
+				break
+			}
+
+			pendingResp, err := respAsByteArrays([][]byte{
+				respAsBulkString(pending.ID.String()),
+				respAsInteger(int(pending.DeliveryTime.UnixMilli())),
+				respAsInteger(pending.DeliveryCount),
+			})
+			if err != nil {
+				return nil, err
+			}
+			consumerPelBytes = append(consumerPelBytes, pendingResp)
+		}
+
+		consumerPelResp, err := respAsByteArrays(consumerPelBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		activeTime := -1
+		if !consumer.ActiveTime.IsZero() {
+			activeTime = int(consumer.ActiveTime.UnixMilli())
+		}
+
+		consumerResp, err := respAsByteArrays([][]byte{
+			respAsBulkString("name"), respAsBulkString(consumer.Name),
+			respAsBulkString("seen-time"), respAsInteger(int(consumer.SeenTime.UnixMilli())),
+			respAsBulkString("active-time"), respAsInteger(activeTime),
+			respAsBulkString("pel-count"), respAsInteger(len(consumer.Pending)),
+			respAsBulkString("pending"), consumerPelResp,
+		})
+		if err != nil {
+			return nil, err
+		}
+		consumersBytes = append(consumersBytes, consumerResp)
+	}
+
+	consumersResp, err := respAsByteArrays(consumersBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return respAsByteArrays([][]byte{
+		respAsBulkString("name"), respAsBulkString(group.Name),
+		respAsBulkString("last-delivered-id"), respAsBulkString(group.LastDeliveredId.String()),
+		respAsBulkString("entries-read"), respAsEntriesRead(group.EntriesRead),
+		respAsBulkString("lag"), respAsLag(stream, group),
+		respAsBulkString("pel-count"), respAsInteger(len(group.Pending)),
+		respAsBulkString("pending"), pelResp,
+		respAsBulkString("consumers"), consumersResp,
+	})
+}
+
+func respAsEntriesRead(entriesRead int) []byte {
+	if entriesRead == streamGroupEntriesReadUnknown {
+		return respAsBulkString("")
+	}
+	return respAsInteger(entriesRead)
+}
+
+func respAsLag(stream *Stream, group *StreamConsumerGroup) []byte {
+	lag, ok := group.lag(stream)
+	if !ok {
+		return respAsBulkString("")
+	}
+	return respAsInteger(lag)
+}
+
+func streamIdOrZero(id *StreamEntryId) string {
+	if id == nil {
+		return minStreamEntryId.String()
+	}
+	return id.String()
+}
@@ -0,0 +1,22 @@
+package main
+
+import "errors"
+
+func (s *server) handleCommandXLEN(args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("command xlen must take one argument")
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	stream, err := s.findStream(args[0])
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+	if stream == nil {
+		return respAsInteger(0), nil
+	}
+
+	return respAsInteger(stream.Len()), nil
+}
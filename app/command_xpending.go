@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func (s *server) handleCommandXPENDING(args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return respAsError("wrong number of arguments for 'xpending' command"), nil
+	}
+
+	key, groupName := args[0], args[1]
+
+	minIdle := 0
+	idx := 2
+	if len(args) > idx && strings.EqualFold(args[idx], "idle") {
+		if len(args) < idx+2 {
+			return respAsError(ErrSyntax.Error()), nil
+		}
+		n, err := strconv.Atoi(args[idx+1])
+		if err != nil {
+			return respAsError("value is not an integer or out of range"), nil
+		}
+		minIdle = n
+		idx += 2
+	}
+
+	extended := len(args) > 2
+	if extended && len(args)-idx != 3 && len(args)-idx != 4 {
+		return respAsError(ErrSyntax.Error()), nil
+	}
+
+	var start, end *StreamEntryId
+	var count int
+	var consumerName string
+
+	if extended {
+		var err error
+		start, err = parseStreamRangeBound(args[idx], true)
+		if err != nil {
+			return respAsError(ErrInvalidStreamIdArg.Error()), nil
+		}
+		end, err = parseStreamRangeBound(args[idx+1], false)
+		if err != nil {
+			return respAsError(ErrInvalidStreamIdArg.Error()), nil
+		}
+		count, err = strconv.Atoi(args[idx+2])
+		if err != nil {
+			return respAsError("value is not an integer or out of range"), nil
+		}
+		if len(args)-idx == 4 {
+			consumerName = args[idx+3]
+		}
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	stream, err := s.findStream(key)
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+	var group *StreamConsumerGroup
+	if stream != nil {
+		group = stream.findGroup(groupName)
+	}
+	if group == nil {
+		return respAsCodedError("NOGROUP", fmt.Sprintf("No such key '%s' or consumer group '%s'", key, groupName)), nil
+	}
+
+	if !extended {
+		return encodePendingSummary(group)
+	}
+
+	pel := group.sortedPending()
+	if len(consumerName) > 0 {
+		consumer := group.findConsumer(consumerName)
+		if consumer == nil {
+			return respAsArray([]string{})
+		}
+		pel = consumer.sortedPending()
+	}
+
+	now := time.Now().UTC()
+	pendingBytes := make([][]byte, 0)
+
+	for _, pending := range pel {
+		if len(pendingBytes) >= count {
+			break
+		}
+
+		if pending.ID.Compare(start) < 0 || pending.ID.Compare(end) > 0 {
+			continue
+		}
+
+		idle := pending.idle(now)
+		if idle < minIdle {
+			continue
+		}
+
+		pendingResp, err := respAsByteArrays([][]byte{
+			respAsBulkString(pending.ID.String()),
+			respAsBulkString(pending.Consumer.Name),
+			respAsInteger(idle),
+			respAsInteger(pending.DeliveryCount),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		pendingBytes = append(pendingBytes, pendingResp)
+	}
+
+	return respAsByteArrays(pendingBytes)
+}
+
+// encodePendingSummary encodes the summary form of XPENDING: the number of
+// pending entries, the smallest and greatest pending IDs, and the number of
+// entries pending per consumer.
+func encodePendingSummary(group *StreamConsumerGroup) ([]byte, error) {
+	pel := group.sortedPending()
+	if len(pel) == 0 {
+		return respAsByteArrays([][]byte{
+			respAsInteger(0),
+			respAsBulkString(""),
+			respAsBulkString(""),
+			respAsNullArray(),
+		})
+	}
+
+	consumersBytes := make([][]byte, 0, len(group.Consumers))
+	for _, consumer := range group.sortedConsumers() {
+		if len(consumer.Pending) == 0 {
+			continue
+		}
+
+		consumerResp, err := respAsArray([]string{consumer.Name, strconv.Itoa(len(consumer.Pending))})
+		if err != nil {
+			return nil, err
+		}
+
+		consumersBytes = append(consumersBytes, consumerResp)
+	}
+
+	consumersResp, err := respAsByteArrays(consumersBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	return respAsByteArrays([][]byte{
+		respAsInteger(len(pel)),
+		respAsBulkString(pel[0].ID.String()),
+		respAsBulkString(pel[len(pel)-1].ID.String()),
+		consumersResp,
+	})
+}
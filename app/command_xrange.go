@@ -1,31 +1,58 @@
 package main
 
-import "fmt"
+import (
+	"strconv"
+	"strings"
+)
+
+// handleCommandXRANGE implements XRANGE and, with reverse set, XREVRANGE,
+// which takes the end of the range before its start.
+func (s *server) handleCommandXRANGE(args []string, reverse bool) ([]byte, error) {
+	if len(args) != 3 && len(args) != 5 {
+		return respAsError(ErrSyntax.Error()), nil
+	}
 
-func (s *server) handleCommandXRANGE(args []string) ([]byte, error) {
-	stream := s.findStream(args[0])
-	if stream == nil {
-		return nil, fmt.Errorf("no streams found for key: %s", args[0])
+	rawStart, rawEnd := args[1], args[2]
+	if reverse {
+		rawStart, rawEnd = rawEnd, rawStart
 	}
 
-	start := args[1]
-	end := args[2]
+	start, err := parseStreamRangeBound(rawStart, true)
+	if err != nil {
+		return respAsError(err.Error()), nil
+	}
 
-	entries, err := stream.findEntries(&start, &end)
+	end, err := parseStreamRangeBound(rawEnd, false)
 	if err != nil {
-		return nil, err
+		return respAsError(err.Error()), nil
 	}
 
-	entriesBytes := make([][]byte, 0, len(entries))
+	count := 0
+	if len(args) == 5 {
+		if !strings.EqualFold(args[3], "count") {
+			return respAsError(ErrSyntax.Error()), nil
+		}
 
-	for _, entry := range entries {
-		entryBytesResp, err := entry.encodeToResp()
+		count, err = strconv.Atoi(args[4])
 		if err != nil {
-			return nil, err
+			return respAsError("value is not an integer or out of range"), nil
+		}
+
+		if count <= 0 {
+			return respAsArray([]string{})
 		}
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
 
-		entriesBytes = append(entriesBytes, entryBytesResp)
+	stream, err := s.findStream(args[0])
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+	if stream == nil {
+		return respAsArray([]string{})
 	}
 
-	return respAsByteArrays(entriesBytes)
+	return encodeEntriesToResp(stream.rangeEntries(start, end, count, reverse))
 }
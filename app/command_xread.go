@@ -1,141 +1,164 @@
 package main
 
 import (
-	"errors"
-	"fmt"
 	"strconv"
 	"strings"
-	"time"
 )
 
-func (s *server) handleCommandXREAD(args []string) ([]byte, error) {
+const (
+	streamLastIdArg    = "$"
+	streamLastEntryArg = "+"
+)
+
+func (s *server) handleCommandXREAD(client *Client, args []string, canBlock bool) ([]byte, error) {
+	count := 0
 	var blockingMillis *int
 	streamsArgIdx := -1
 
-	for idx, arg := range args {
-		lowerArg := strings.ToLower(arg)
-
-		if lowerArg == "block" {
-			blockingMillisInt, err := strconv.Atoi(args[idx+1])
+options:
+	for idx := 0; idx < len(args); idx++ {
+		switch strings.ToLower(args[idx]) {
+		case "count", "block":
+			if idx+1 >= len(args) {
+				return respAsError(ErrSyntax.Error()), nil
+			}
+			n, err := strconv.Atoi(args[idx+1])
 			if err != nil {
-				return nil, err
+				return respAsError("value is not an integer or out of range"), nil
 			}
-
-			blockingMillis = &blockingMillisInt
-		} else if strings.ToLower(arg) == "streams" {
+			if strings.EqualFold(args[idx], "count") {
+				count = max(n, 0)
+			} else {
+				if n < 0 {
+					return respAsError("timeout is negative"), nil
+				}
+				blockingMillis = &n
+			}
+			idx++
+		case "streams":
 			streamsArgIdx = idx
-			break
+			break options
+		default:
+			return respAsError(ErrSyntax.Error()), nil
 		}
 	}
 
 	if streamsArgIdx == -1 {
-		return nil, errors.New("invalid XREAD command - \"streams\" argument not found")
+		return respAsError(ErrSyntax.Error()), nil
 	}
 
 	streamArgs := args[streamsArgIdx+1:]
-
-	streamKeyAndIds := make([]streamKeyAndId, 0, len(streamArgs)/2)
-
-	i := 0
-	j := len(streamArgs) / 2
-
-	for j < len(streamArgs) {
-		streamKeyAndIds = append(streamKeyAndIds, streamKeyAndId{
-			key: streamArgs[i],
-			id:  streamArgs[j],
-		})
-		i++
-		j++
+	if len(streamArgs) == 0 || len(streamArgs)%2 != 0 {
+		return respAsError("Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified."), nil
 	}
 
-	if len(streamKeyAndIds) == 0 {
-		return nil, errors.New("no streams to read from")
-	}
-
-	var createdAfter *time.Time
-
-	if blockingMillis != nil {
-		now := time.Now().UTC()
-		createdAfter = &now
-		if *blockingMillis > 0 {
-			timer := time.After(time.Duration(*blockingMillis) * time.Millisecond)
-			<-timer
-		} else if *blockingMillis == 0 {
-			s.streams.blockAndWaitForEntryAdded()
+	// "$" is resolved once, at call time, so that a blocked client only sees
+	// entries added after it started waiting. "+" reads the last entry of the
+	// stream, and behaves like "$" if there is none.
+	numStreams := len(streamArgs) / 2
+	keys := make([]string, 0, numStreams)
+	afterIds := make([]*StreamEntryId, 0, numStreams)
+	readLast := make([]bool, 0, numStreams)
+
+	s.dataMu.Lock()
+	for i := 0; i < numStreams; i++ {
+		key, rawId := streamArgs[i], streamArgs[numStreams+i]
+		stream, err := s.findStream(key)
+		if err != nil {
+			s.dataMu.Unlock()
+			return respAsWrongTypeError(), nil
 		}
-	}
 
-	streamBytesResp := make([][]byte, 0, len(streamKeyAndIds))
+		afterId := &minStreamEntryId
+		last := false
 
-	for _, streamKeyAndId := range streamKeyAndIds {
-		stream := s.findStream(streamKeyAndId.key)
-		if stream == nil {
-			fmt.Println("No streams found for key: ", streamKeyAndId.key)
-			continue
+		switch rawId {
+		case streamLastIdArg, streamLastEntryArg:
+			if stream != nil && stream.LastId != nil {
+				afterId = stream.LastId
+			}
+			last = rawId == streamLastEntryArg && stream != nil && !stream.isEmpty()
+		default:
+			id, err := parseStreamRangeId(rawId, 0)
+			if err != nil {
+				s.dataMu.Unlock()
+				return respAsError(ErrInvalidStreamIdArg.Error()), nil
+			}
+			afterId = id
 		}
 
-		var entries []*StreamEntry
+		keys = append(keys, key)
+		afterIds = append(afterIds, afterId)
+		readLast = append(readLast, last)
+	}
+	s.dataMu.Unlock()
 
-		if createdAfter != nil && streamKeyAndId.id == "$" {
-			entries = stream.findEntriesNewerThan(*createdAfter)
-		} else {
-			e, err := stream.findEntries(&streamKeyAndId.id, nil)
-			if err != nil {
-				return nil, err
-			}
+	// The keyspace is locked for each read rather than for the whole call,
+	// so that other clients can add entries while this one is blocked.
+	read := func() ([][]byte, error) {
+		s.dataMu.Lock()
+		defer s.dataMu.Unlock()
 
-			entries = e
-		}
+		streamBytesResp := make([][]byte, 0, len(keys))
 
-		if len(entries) == 0 {
-			continue
-		}
+		for i, key := range keys {
+			// The key may have been deleted, or replaced with another
+			// type, while blocked.
+			stream, _ := s.findStream(key)
+			if stream == nil {
+				continue
+			}
 
-		entriesBytes := make([][]byte, 0, len(entries))
+			var entries []*StreamEntry
+			if readLast[i] {
+				// The stream may have been emptied since the call.
+				if last := stream.lastEntry(); last != nil {
+					entries = []*StreamEntry{last}
+				}
+			} else {
+				entries = stream.entriesAfter(afterIds[i], count)
+			}
 
-		for _, entry := range entries {
-			if createdAfter != nil && entry.Created.Before(*createdAfter) {
+			if len(entries) == 0 {
 				continue
 			}
 
-			entryBytesResp, err := entry.encodeToResp()
+			entriesResp, err := encodeEntriesToResp(entries)
 			if err != nil {
 				return nil, err
 			}
 
-			entriesBytes = append(entriesBytes, entryBytesResp)
-		}
-
-		if len(entriesBytes) == 0 {
-			continue
-		}
-
-		streamBytes := make([][]byte, 0, 2)
+			encodedStreamBytes, err := respAsByteArrays([][]byte{
+				respAsBulkString(key),
+				entriesResp,
+			})
+			if err != nil {
+				return nil, err
+			}
 
-		entriesBytesResp, err := respAsByteArrays(entriesBytes)
-		if err != nil {
-			return nil, err
+			streamBytesResp = append(streamBytesResp, encodedStreamBytes)
 		}
 
-		streamBytes = append(streamBytes, respAsBulkString(streamKeyAndId.key))
-		streamBytes = append(streamBytes, entriesBytesResp)
+		return streamBytesResp, nil
+	}
 
-		encodedStreamBytes, err := respAsByteArrays(streamBytes)
-		if err != nil {
-			return nil, err
-		}
+	var streamBytesResp [][]byte
+	var err error
 
-		streamBytesResp = append(streamBytesResp, encodedStreamBytes)
+	if blockingMillis != nil && canBlock {
+		disconnected, stopWatching := client.watchDisconnect()
+		streamBytesResp, err = s.streams.blockUntil(keys, *blockingMillis, disconnected, s.execMu.RLocker(), read)
+		stopWatching()
+	} else {
+		streamBytesResp, err = read()
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	if len(streamBytesResp) == 0 {
-		return respAsBulkString(""), nil
+		return respAsNullArray(), nil
 	}
 
 	return respAsByteArrays(streamBytesResp)
 }
-
-type streamKeyAndId struct {
-	key string
-	id  string
-}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const streamNewEntriesId = ">"
+
+func (s *server) handleCommandXREADGROUP(client *Client, args []string, canBlock bool) ([]byte, error) {
+	if len(args) < 6 || !strings.EqualFold(args[0], "group") {
+		return respAsError(ErrSyntax.Error()), nil
+	}
+
+	groupName, consumerName := args[1], args[2]
+
+	count := 0
+	var blockingMillis *int
+	noAck := false
+	streamsArgIdx := -1
+
+options:
+	for idx := 3; idx < len(args); idx++ {
+		switch strings.ToLower(args[idx]) {
+		case "count", "block":
+			if idx+1 >= len(args) {
+				return respAsError(ErrSyntax.Error()), nil
+			}
+			n, err := strconv.Atoi(args[idx+1])
+			if err != nil {
+				return respAsError("value is not an integer or out of range"), nil
+			}
+			if strings.EqualFold(args[idx], "count") {
+				count = max(n, 0)
+			} else {
+				if n < 0 {
+					return respAsError("timeout is negative"), nil
+				}
+				blockingMillis = &n
+			}
+			idx++
+		case "noack":
+			noAck = true
+		case "streams":
+			streamsArgIdx = idx
+			break options
+		default:
+			return respAsError(ErrSyntax.Error()), nil
+		}
+	}
+
+	if streamsArgIdx == -1 {
+		return respAsError(ErrSyntax.Error()), nil
+	}
+
+	streamArgs := args[streamsArgIdx+1:]
+	if len(streamArgs) == 0 || len(streamArgs)%2 != 0 {
+		return respAsError("Unbalanced 'xreadgroup' list of streams: for each stream key an ID or '>' must be specified."), nil
+	}
+
+	streamKeyAndIds := make([]streamKeyAndId, 0, len(streamArgs)/2)
+	onlyNewEntries := true
+
+	s.dataMu.Lock()
+	for i := 0; i < len(streamArgs)/2; i++ {
+		key, rawId := streamArgs[i], streamArgs[len(streamArgs)/2+i]
+
+		stream, err := s.findStream(key)
+		if err != nil {
+			s.dataMu.Unlock()
+			return respAsWrongTypeError(), nil
+		}
+		if stream == nil || stream.findGroup(groupName) == nil {
+			s.dataMu.Unlock()
+			return respAsCodedError("NOGROUP", fmt.Sprintf("No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, groupName)), nil
+		}
+
+		if rawId != streamNewEntriesId {
+			onlyNewEntries = false
+			if _, err := parseStreamRangeId(rawId, 0); err != nil {
+				s.dataMu.Unlock()
+				return respAsError(ErrInvalidStreamIdArg.Error()), nil
+			}
+		}
+
+		streamKeyAndIds = append(streamKeyAndIds, streamKeyAndId{key: key, id: rawId})
+	}
+	s.dataMu.Unlock()
+
+	read := func() ([][]byte, error) {
+		return s.readGroup(groupName, consumerName, streamKeyAndIds, count, noAck)
+	}
+
+	var streamBytesResp [][]byte
+	var err error
+
+	if blockingMillis != nil && canBlock && onlyNewEntries {
+		keys := make([]string, 0, len(streamKeyAndIds))
+		for _, streamKeyAndId := range streamKeyAndIds {
+			keys = append(keys, streamKeyAndId.key)
+		}
+		disconnected, stopWatching := client.watchDisconnect()
+		streamBytesResp, err = s.streams.blockUntil(keys, *blockingMillis, disconnected, s.execMu.RLocker(), read)
+		stopWatching()
+	} else {
+		streamBytesResp, err = read()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(streamBytesResp) == 0 {
+		return respAsNullArray(), nil
+	}
+
+	return respAsByteArrays(streamBytesResp)
+}
+
+// readGroup reads every requested stream on behalf of a consumer. New entries
+// (">") are added to the PEL unless noAck is set, while any other ID reads
+// the consumer's own pending history after that ID. It locks the keyspace
+// itself, as it is called again every time a blocked client wakes up.
+func (s *server) readGroup(groupName, consumerName string, streamKeyAndIds []streamKeyAndId, count int, noAck bool) ([][]byte, error) {
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	now := time.Now().UTC()
+	streamBytesResp := make([][]byte, 0, len(streamKeyAndIds))
+
+	for _, streamKeyAndId := range streamKeyAndIds {
+		stream, _ := s.findStream(streamKeyAndId.key)
+		if stream == nil {
+			continue
+		}
+
+		group := stream.findGroup(groupName)
+		if group == nil {
+			continue
+		}
+
+		consumer, created := group.CreateConsumer(consumerName)
+		if created {
+			s.signalModifiedKey(streamKeyAndId.key)
+		}
+
+		var entriesResp []byte
+		var err error
+
+		if streamKeyAndId.id == streamNewEntriesId {
+			entries := stream.entriesAfter(group.LastDeliveredId, count)
+			consumer.touch(now, len(entries) > 0)
+			if len(entries) == 0 {
+				continue
+			}
+			// The group's last delivered ID and its PEL change.
+			s.signalModifiedKey(streamKeyAndId.key)
+
+			for _, entry := range entries {
+				group.markDelivered(stream, entry.ID)
+				if !noAck {
+					group.deliver(*entry.ID, consumer, now)
+				}
+			}
+
+			entriesResp, err = encodeEntriesToResp(entries)
+		} else {
+			startId, _ := parseStreamRangeId(streamKeyAndId.id, 0)
+			consumer.touch(now, false)
+			var delivered int
+			entriesResp, delivered, err = encodePendingHistory(stream, consumer, startId, count, now)
+			// Delivering the history again updates its PEL entries.
+			if delivered > 0 {
+				s.signalModifiedKey(streamKeyAndId.key)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		encodedStreamBytes, err := respAsByteArrays([][]byte{
+			respAsBulkString(streamKeyAndId.key),
+			entriesResp,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		streamBytesResp = append(streamBytesResp, encodedStreamBytes)
+	}
+
+	return streamBytesResp, nil
+}
+
+// encodePendingHistory encodes the entries pending for a consumer with an ID
+// greater than startId, along with their number. Entries that were deleted
+// from the stream in the meantime are reported with a null field list.
+func encodePendingHistory(stream *Stream, consumer *StreamConsumer, startId *StreamEntryId, count int, now time.Time) ([]byte, int, error) {
+	entriesBytes := make([][]byte, 0)
+
+	for _, pending := range consumer.sortedPending() {
+		if count > 0 && len(entriesBytes) >= count {
+			break
+		}
+
+		if pending.ID.Compare(startId) <= 0 {
+			continue
+		}
+
+		pending.DeliveryTime = now
+		pending.DeliveryCount++
+
+		entry := stream.findEntry(&pending.ID)
+		if entry == nil {
+			deletedEntryResp, err := respAsByteArrays([][]byte{
+				respAsBulkString(pending.ID.String()),
+				respAsNullArray(),
+			})
+			if err != nil {
+				return nil, 0, err
+			}
+			entriesBytes = append(entriesBytes, deletedEntryResp)
+			continue
+		}
+
+		entryResp, err := entry.encodeToResp()
+		if err != nil {
+			return nil, 0, err
+		}
+		entriesBytes = append(entriesBytes, entryResp)
+	}
+
+	resp, err := respAsByteArrays(entriesBytes)
+	return resp, len(entriesBytes), err
+}
+
+type streamKeyAndId struct {
+	key string
+	id  string
+}
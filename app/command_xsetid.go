@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+func (s *server) handleCommandXSETID(args []string) ([]byte, error) {
+	if len(args) < 2 {
+		return respAsError("wrong number of arguments for 'xsetid' command"), nil
+	}
+
+	lastId, err := parseStreamRangeId(args[1], 0)
+	if err != nil {
+		return respAsError(ErrInvalidStreamIdArg.Error()), nil
+	}
+
+	entriesAdded := -1
+	var maxDeletedId *StreamEntryId
+
+	for idx := 2; idx < len(args); idx += 2 {
+		if idx+1 >= len(args) {
+			return respAsError(ErrSyntax.Error()), nil
+		}
+
+		switch strings.ToLower(args[idx]) {
+		case "entriesadded":
+			n, err := strconv.Atoi(args[idx+1])
+			if err != nil {
+				return respAsError("value is not an integer or out of range"), nil
+			}
+			if n < 0 {
+				return respAsError("entries_added must be positive"), nil
+			}
+			entriesAdded = n
+		case "maxdeletedid":
+			id, err := parseStreamRangeId(args[idx+1], 0)
+			if err != nil {
+				return respAsError(ErrInvalidStreamIdArg.Error()), nil
+			}
+			if lastId.Compare(id) < 0 {
+				return respAsError("The ID specified in XSETID is smaller than the provided max_deleted_entry_id"), nil
+			}
+			maxDeletedId = id
+		default:
+			return respAsError(ErrSyntax.Error()), nil
+		}
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	stream, err := s.findStream(args[0])
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+	if stream == nil {
+		return respAsError("no such key"), nil
+	}
+
+	if entriesAdded >= 0 && stream.Len() > entriesAdded {
+		return respAsError("The entries_added specified in XSETID is smaller than the target stream length"), nil
+	}
+
+	if last := stream.lastEntry(); last != nil && lastId.Compare(last.ID) < 0 {
+		return respAsError("The ID specified in XSETID is smaller than the target stream top item"), nil
+	}
+
+	stream.LastId = lastId
+	if entriesAdded >= 0 {
+		stream.EntriesAdded = entriesAdded
+	}
+	if maxDeletedId != nil {
+		stream.MaxDeletedEntryId = maxDeletedId
+	}
+
+	s.signalModifiedKey(args[0])
+	s.notifyKeyspaceEvent(notifyStream, "xsetid", args[0])
+
+	return okSimpleString(), nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import "strings"
+
+func (s *server) handleCommandXTRIM(args []string) ([]byte, error) {
+	if len(args) < 3 {
+		return respAsError("wrong number of arguments for 'xtrim' command"), nil
+	}
+
+	switch strings.ToLower(args[1]) {
+	case streamTrimMaxLen, streamTrimMinId:
+	default:
+		return respAsError(ErrSyntax.Error()), nil
+	}
+
+	opts, n, err := parseStreamTrimOptions(args[1:])
+	if err != nil {
+		return respAsError(err.Error()), nil
+	}
+
+	if 1+n != len(args) {
+		return respAsError(ErrSyntax.Error()), nil
+	}
+
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	stream, err := s.findStream(args[0])
+	if err != nil {
+		return respAsWrongTypeError(), nil
+	}
+	if stream == nil {
+		return respAsInteger(0), nil
+	}
+
+	trimmed := stream.trim(opts)
+	if trimmed > 0 {
+		s.signalModifiedKey(args[0])
+		s.notifyKeyspaceEvent(notifyStream, "xtrim", args[0])
+	}
+
+	return respAsInteger(trimmed), nil
+}
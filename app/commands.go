@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"strings"
+	"time"
 )
 
 type Type byte
@@ -10,61 +12,222 @@ const (
 	array      Type = '*'
 	bulkString Type = '$'
 	integer    Type = ':'
+	push       Type = '>'
+	mapType    Type = '%'
 )
 
 const (
-	cmdPing           = "ping"
-	cmdEcho           = "echo"
-	cmdGet            = "get"
-	cmdSet            = "set"
-	cmdInfo           = "info"
-	cmdReplConf       = "replconf"
-	cmdReplConfGetAck = "replconf getack"
-	cmdReplConfAck    = "replconf ack"
-	cmdPsync          = "psync"
-	cmdWait           = "wait"
-	cmdConfigGet      = "config get"
-	cmdKeys           = "keys"
-	cmdIncr           = "incr"
-	cmdMulti          = "multi"
-	cmdExec           = "exec"
-	cmdDiscard        = "discard"
-	cmdType           = "type"
-	cmdXAdd           = "xadd"
-	cmdXRange         = "xrange"
-	cmdXRead          = "xread"
+	cmdPing                 = "ping"
+	cmdEcho                 = "echo"
+	cmdGet                  = "get"
+	cmdSet                  = "set"
+	cmdInfo                 = "info"
+	cmdReplConf             = "replconf"
+	cmdReplConfGetAck       = "replconf getack"
+	cmdReplConfAck          = "replconf ack"
+	cmdPsync                = "psync"
+	cmdWait                 = "wait"
+	cmdConfigGet            = "config get"
+	cmdConfigSet            = "config set"
+	cmdKeys                 = "keys"
+	cmdIncr                 = "incr"
+	cmdDel                  = "del"
+	cmdMulti                = "multi"
+	cmdExec                 = "exec"
+	cmdDiscard              = "discard"
+	cmdWatch                = "watch"
+	cmdUnwatch              = "unwatch"
+	cmdFlushAll             = "flushall"
+	cmdFlushDb              = "flushdb"
+	cmdType                 = "type"
+	cmdXAdd                 = "xadd"
+	cmdXRange               = "xrange"
+	cmdXRevRange            = "xrevrange"
+	cmdXRead                = "xread"
+	cmdXLen                 = "xlen"
+	cmdXDel                 = "xdel"
+	cmdXTrim                = "xtrim"
+	cmdXSetId               = "xsetid"
+	cmdXGroupCreate         = "xgroup create"
+	cmdXGroupSetId          = "xgroup setid"
+	cmdXGroupDestroy        = "xgroup destroy"
+	cmdXGroupCreateConsumer = "xgroup createconsumer"
+	cmdXGroupDelConsumer    = "xgroup delconsumer"
+	cmdXReadGroup           = "xreadgroup"
+	cmdXAck                 = "xack"
+	cmdXPending             = "xpending"
+	cmdXClaim               = "xclaim"
+	cmdXAutoClaim           = "xautoclaim"
+	cmdXInfoStream          = "xinfo stream"
+	cmdXInfoGroups          = "xinfo groups"
+	cmdXInfoConsumers       = "xinfo consumers"
+	cmdHSet                 = "hset"
+	cmdHGet                 = "hget"
+	cmdHDel                 = "hdel"
+	cmdHGetAll              = "hgetall"
+	cmdHLen                 = "hlen"
+	cmdHExpire              = "hexpire"
+	cmdHPExpire             = "hpexpire"
+	cmdHExpireAt            = "hexpireat"
+	cmdHPExpireAt           = "hpexpireat"
+	cmdHTTL                 = "httl"
+	cmdHPTTL                = "hpttl"
+	cmdHExpireTime          = "hexpiretime"
+	cmdHPExpireTime         = "hpexpiretime"
+	cmdHPersist             = "hpersist"
+	cmdHGetEx               = "hgetex"
+	cmdHSetEx               = "hsetex"
+	cmdSubscribe            = "subscribe"
+	cmdUnsubscribe          = "unsubscribe"
+	cmdPSubscribe           = "psubscribe"
+	cmdPUnsubscribe         = "punsubscribe"
+	cmdPublish              = "publish"
+	cmdPubSubChannels       = "pubsub channels"
+	cmdPubSubNumSub         = "pubsub numsub"
+	cmdPubSubNumPat         = "pubsub numpat"
+	cmdSSubscribe           = "ssubscribe"
+	cmdSUnsubscribe         = "sunsubscribe"
+	cmdSPublish             = "spublish"
+	cmdPubSubShardChannels  = "pubsub shardchannels"
+	cmdPubSubShardNumSub    = "pubsub shardnumsub"
+	cmdHello                = "hello"
+	cmdSave                 = "save"
+	cmdBgSave               = "bgsave"
+	cmdLastSave             = "lastsave"
+	cmdBgRewriteAof         = "bgrewriteaof"
+	cmdDump                 = "dump"
+	cmdRestore              = "restore"
+	cmdMigrate              = "migrate"
 )
 
-var supportedCommands = []string{
-	cmdPing,
-	cmdEcho,
-	cmdGet,
-	cmdSet,
-	cmdInfo,
-	cmdReplConf,
-	cmdReplConfGetAck,
-	cmdReplConfAck,
-	cmdPsync,
-	cmdWait,
-	cmdConfigGet,
-	cmdKeys,
-	cmdIncr,
-	cmdMulti,
-	cmdExec,
-	cmdDiscard,
-	cmdType,
-	cmdXAdd,
-	cmdXRange,
-	cmdXRead,
+// commandArity lists every supported command along with its arity, which
+// follows the Redis convention: a positive arity is the exact number of parts
+// of the command, its name included, and a negative one is the minimum.
+var commandArity = map[string]int{
+	cmdPing:                 -1,
+	cmdEcho:                 2,
+	cmdGet:                  2,
+	cmdSet:                  -3,
+	cmdInfo:                 -1,
+	cmdReplConf:             -1,
+	cmdReplConfGetAck:       -2,
+	cmdReplConfAck:          -2,
+	cmdPsync:                -3,
+	cmdWait:                 3,
+	cmdConfigGet:            -3,
+	cmdConfigSet:            -4,
+	cmdKeys:                 2,
+	cmdIncr:                 2,
+	cmdDel:                  -2,
+	cmdMulti:                1,
+	cmdExec:                 1,
+	cmdDiscard:              1,
+	cmdWatch:                -2,
+	cmdUnwatch:              1,
+	cmdFlushAll:             -1,
+	cmdFlushDb:              -1,
+	cmdType:                 2,
+	cmdXAdd:                 -5,
+	cmdXRange:               -4,
+	cmdXRevRange:            -4,
+	cmdXRead:                -4,
+	cmdXLen:                 2,
+	cmdXDel:                 -3,
+	cmdXTrim:                -4,
+	cmdXSetId:               -3,
+	cmdXGroupCreate:         -5,
+	cmdXGroupSetId:          -5,
+	cmdXGroupDestroy:        4,
+	cmdXGroupCreateConsumer: 5,
+	cmdXGroupDelConsumer:    5,
+	cmdXReadGroup:           -7,
+	cmdXAck:                 -4,
+	cmdXPending:             -3,
+	cmdXClaim:               -6,
+	cmdXAutoClaim:           -6,
+	cmdXInfoStream:          -3,
+	cmdXInfoGroups:          3,
+	cmdXInfoConsumers:       4,
+	cmdHSet:                 -4,
+	cmdHGet:                 3,
+	cmdHDel:                 -3,
+	cmdHGetAll:              2,
+	cmdHLen:                 2,
+	cmdHExpire:              -6,
+	cmdHPExpire:             -6,
+	cmdHExpireAt:            -6,
+	cmdHPExpireAt:           -6,
+	cmdHTTL:                 -5,
+	cmdHPTTL:                -5,
+	cmdHExpireTime:          -5,
+	cmdHPExpireTime:         -5,
+	cmdHPersist:             -5,
+	cmdHGetEx:               -5,
+	cmdHSetEx:               -6,
+	cmdSubscribe:            -2,
+	cmdUnsubscribe:          -1,
+	cmdPSubscribe:           -2,
+	cmdPUnsubscribe:         -1,
+	cmdPublish:              3,
+	cmdPubSubChannels:       -2,
+	cmdPubSubNumSub:         -2,
+	cmdPubSubNumPat:         2,
+	cmdSSubscribe:           -2,
+	cmdSUnsubscribe:         -1,
+	cmdSPublish:             3,
+	cmdPubSubShardChannels:  -2,
+	cmdPubSubShardNumSub:    -2,
+	cmdHello:                -1,
+	cmdSave:                 1,
+	cmdBgSave:               -1,
+	cmdLastSave:             1,
+	cmdBgRewriteAof:         1,
+	cmdDump:                 2,
+	cmdRestore:              -4,
+	cmdMigrate:              -6,
 }
 
 func (s *server) handleCommand(client *Client, cmd *command) error {
+	// A replica's offset covers every byte received from its master. It is
+	// only updated once the command is handled, so that REPLCONF GETACK
+	// reports the offset before itself.
+	if client.isMasterLink {
+		defer func() {
+			s.masterReplOffset += cmd.bytesLength()
+		}()
+	}
+
 	err := cmd.parse()
+	if err == nil && !cmd.hasValidArity() {
+		err = fmt.Errorf("wrong number of arguments for '%s' command", strings.ReplaceAll(cmd.name, " ", "|"))
+	}
 	if err != nil {
+		client.Transaction.Abort()
+		_, err = client.Write(respAsError(err.Error()))
+		return err
+	}
+
+	if s.persistence.loading.Load() && !client.isAOFClient && !isAllowedWhileLoading(cmd.name) {
+		_, err := client.Write(respAsCodedError("LOADING", "Redis is loading the dataset in memory"))
 		return err
 	}
 
-	if client.Transaction.isOpen && cmd.isQueable {
+	// RESP2 clients with subscriptions cannot tell replies from published
+	// messages, so they are restricted to the subscription commands.
+	if client.protocol < resp3 && !isAllowedInSubscribedMode(cmd.name) && s.pubsub.isSubscribed(client) {
+		_, err := client.Write(respAsError(fmt.Sprintf(
+			"Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context",
+			strings.ReplaceAll(cmd.name, " ", "|"))))
+		return err
+	}
+
+	if client.Transaction.IsOpen() && !isTransactionCommand(cmd.name) {
+		if !cmd.isQueable {
+			client.Transaction.Abort()
+			_, err := client.Write(respAsError("Command not allowed inside a transaction"))
+			return err
+		}
+
 		client.Transaction.Queue = append(client.Transaction.Queue, cmd)
 		_, err := client.Write(respAsSimpleString("QUEUED"))
 		if err != nil {
@@ -73,20 +236,38 @@ func (s *server) handleCommand(client *Client, cmd *command) error {
 		return nil
 	}
 
+	// Commands share the exec lock so that EXEC, which takes it exclusively,
+	// runs atomically. Sharing it is only safe because every handler locks
+	// the data it touches on its own: dataMu for the keyspace, streams
+	// included, and the dedicated mutexes of replicas, subscriptions and
+	// persistence. WAIT and REPLCONF ACK do not access the keyspace and may
+	// block on each other for a long time, so they do not take the lock.
+	// Saves and rewrites of the append-only file, which CONFIG SET may
+	// start, take it exclusively to snapshot a consistent dataset, and so
+	// do PSYNC, for the snapshot sent to a new replica, and MIGRATE to move
+	// keys atomically.
+	switch cmd.name {
+	case cmdExec, cmdWait, cmdReplConfAck:
+	case cmdSave, cmdBgSave, cmdBgRewriteAof, cmdConfigSet, cmdPsync, cmdMigrate:
+		s.execMu.Lock()
+		defer s.execMu.Unlock()
+	default:
+		s.execMu.RLock()
+		defer s.execMu.RUnlock()
+	}
+
 	var resp []byte
 
-	if s.isMaster() {
-		resp, err = s.handleCommandOnMaster(client, cmd)
-		if cmd.isWrite {
-			go func() {
-				err := s.propagateCommandToSlaves(cmd)
-				if err != nil {
-					fmt.Println("Failed propagating to slaves: ", err)
-				}
-			}()
+	resp, err = s.handleCommandOnRole(client, cmd)
+	s.flushKeyspaceEvents()
+	// Writes reach a slave only from its master, and are propagated to
+	// its own append-only file. A write that failed changed nothing, so it
+	// is not propagated.
+	if cmd.isWrite && err == nil && !isErrorReply(resp) {
+		err := s.propagateCommand(cmd, propagateAll)
+		if err != nil {
+			fmt.Println("Failed propagating to slaves: ", err)
 		}
-	} else {
-		resp, err = s.handleCommandOnSlave(client, cmd)
 	}
 	if err != nil {
 		return err
@@ -102,10 +283,30 @@ func (s *server) handleCommand(client *Client, cmd *command) error {
 	return nil
 }
 
+// isTransactionCommand reports whether name controls transactions, and so is
+// executed right away rather than queued inside MULTI.
+func isTransactionCommand(name string) bool {
+	switch name {
+	case cmdMulti, cmdExec, cmdDiscard, cmdWatch:
+		return true
+	default:
+		return false
+	}
+}
+
+// handleCommandOnRole dispatches cmd to the master or slave handlers,
+// depending on the role of the server.
+func (s *server) handleCommandOnRole(client *Client, cmd *command) ([]byte, error) {
+	if s.isMaster() {
+		return s.handleCommandOnMaster(client, cmd)
+	}
+	return s.handleCommandOnSlave(client, cmd)
+}
+
 func (s *server) handleCommandOnMaster(client *Client, cmd *command) (resp []byte, err error) {
 	switch cmd.name {
 	case cmdPing:
-		return nil, s.handleCommandPing(client)
+		return s.handleCommandPing(client, cmd.args)
 	case cmdEcho:
 		return s.handleCommandEcho(cmd.args)
 	case cmdGet:
@@ -113,7 +314,7 @@ func (s *server) handleCommandOnMaster(client *Client, cmd *command) (resp []byt
 	case cmdSet:
 		return s.handleCommandSetOnMaster(cmd.args)
 	case cmdInfo:
-		return nil, s.handleCommandInfo(client, cmd.args)
+		return s.handleCommandInfo(cmd.args)
 	case cmdReplConf:
 		return nil, s.handleCommandReplconf(client)
 	case cmdReplConfAck:
@@ -124,24 +325,144 @@ func (s *server) handleCommandOnMaster(client *Client, cmd *command) (resp []byt
 		return nil, s.handleCommandWait(client, cmd.args)
 	case cmdConfigGet:
 		return s.handleCommandConfigGet(cmd.args)
+	case cmdConfigSet:
+		return s.handleCommandConfigSet(cmd.args)
 	case cmdKeys:
 		return s.handleCommandKeys()
 	case cmdIncr:
 		return s.handleCommandIncr(cmd.args)
+	case cmdDel:
+		return s.handleCommandDel(cmd.args)
 	case cmdMulti:
 		return nil, s.handleCommandMulti(client)
 	case cmdExec:
 		return nil, s.handleCommandExec(client)
 	case cmdDiscard:
 		return nil, s.handleCommandDiscard(client)
+	case cmdWatch:
+		return s.handleCommandWatch(client, cmd.args)
+	case cmdUnwatch:
+		return s.handleCommandUnwatch(client)
+	case cmdFlushAll, cmdFlushDb:
+		return s.handleCommandFlush(cmd.args)
 	case cmdType:
 		return s.handleCommandType(cmd.args)
 	case cmdXAdd:
 		return s.handleCommandXADD(cmd.args)
 	case cmdXRange:
-		return s.handleCommandXRANGE(cmd.args)
+		return s.handleCommandXRANGE(cmd.args, false)
+	case cmdXRevRange:
+		return s.handleCommandXRANGE(cmd.args, true)
 	case cmdXRead:
-		return s.handleCommandXREAD(cmd.args)
+		return s.handleCommandXREAD(client, cmd.args, !client.Transaction.isExecuting)
+	case cmdXLen:
+		return s.handleCommandXLEN(cmd.args)
+	case cmdXDel:
+		return s.handleCommandXDEL(cmd.args)
+	case cmdXTrim:
+		return s.handleCommandXTRIM(cmd.args)
+	case cmdXSetId:
+		return s.handleCommandXSETID(cmd.args)
+	case cmdXGroupCreate:
+		return s.handleCommandXGroupCreate(cmd.args)
+	case cmdXGroupSetId:
+		return s.handleCommandXGroupSetId(cmd.args)
+	case cmdXGroupDestroy:
+		return s.handleCommandXGroupDestroy(cmd.args)
+	case cmdXGroupCreateConsumer:
+		return s.handleCommandXGroupCreateConsumer(cmd.args)
+	case cmdXGroupDelConsumer:
+		return s.handleCommandXGroupDelConsumer(cmd.args)
+	case cmdXReadGroup:
+		return s.handleCommandXREADGROUP(client, cmd.args, !client.Transaction.isExecuting)
+	case cmdXAck:
+		return s.handleCommandXACK(cmd.args)
+	case cmdXPending:
+		return s.handleCommandXPENDING(cmd.args)
+	case cmdXClaim:
+		return s.handleCommandXCLAIM(cmd.args)
+	case cmdXAutoClaim:
+		return s.handleCommandXAUTOCLAIM(cmd.args)
+	case cmdXInfoStream:
+		return s.handleCommandXInfoStream(cmd.args)
+	case cmdXInfoGroups:
+		return s.handleCommandXInfoGroups(cmd.args)
+	case cmdXInfoConsumers:
+		return s.handleCommandXInfoConsumers(cmd.args)
+	case cmdHSet:
+		return s.handleCommandHSet(cmd.args)
+	case cmdHGet:
+		return s.handleCommandHGet(cmd.args)
+	case cmdHDel:
+		return s.handleCommandHDel(cmd.args)
+	case cmdHGetAll:
+		return s.handleCommandHGetAll(cmd.args)
+	case cmdHLen:
+		return s.handleCommandHLen(cmd.args)
+	case cmdHExpire:
+		return s.handleCommandHExpire(cmd.args, time.Second, false)
+	case cmdHPExpire:
+		return s.handleCommandHExpire(cmd.args, time.Millisecond, false)
+	case cmdHExpireAt:
+		return s.handleCommandHExpire(cmd.args, time.Second, true)
+	case cmdHPExpireAt:
+		return s.handleCommandHExpire(cmd.args, time.Millisecond, true)
+	case cmdHTTL:
+		return s.handleCommandHTTL(cmd.args, time.Second, false)
+	case cmdHPTTL:
+		return s.handleCommandHTTL(cmd.args, time.Millisecond, false)
+	case cmdHExpireTime:
+		return s.handleCommandHTTL(cmd.args, time.Second, true)
+	case cmdHPExpireTime:
+		return s.handleCommandHTTL(cmd.args, time.Millisecond, true)
+	case cmdHPersist:
+		return s.handleCommandHPersist(cmd.args)
+	case cmdHGetEx:
+		return s.handleCommandHGetEx(cmd.args)
+	case cmdHSetEx:
+		return s.handleCommandHSetEx(cmd.args)
+	case cmdSubscribe:
+		return s.handleCommandSubscribe(client, cmd.args, channelSubscription)
+	case cmdUnsubscribe:
+		return s.handleCommandUnsubscribe(client, cmd.args, channelSubscription)
+	case cmdPSubscribe:
+		return s.handleCommandSubscribe(client, cmd.args, patternSubscription)
+	case cmdPUnsubscribe:
+		return s.handleCommandUnsubscribe(client, cmd.args, patternSubscription)
+	case cmdPublish:
+		return s.handleCommandPublish(cmd.args)
+	case cmdPubSubChannels:
+		return s.handleCommandPubSubChannels(cmd.args, false)
+	case cmdPubSubNumSub:
+		return s.handleCommandPubSubNumSub(cmd.args, false)
+	case cmdPubSubNumPat:
+		return s.handleCommandPubSubNumPat()
+	case cmdSSubscribe:
+		return s.handleCommandSubscribe(client, cmd.args, shardChannelSubscription)
+	case cmdSUnsubscribe:
+		return s.handleCommandUnsubscribe(client, cmd.args, shardChannelSubscription)
+	case cmdSPublish:
+		return s.handleCommandSPublish(cmd.args)
+	case cmdPubSubShardChannels:
+		return s.handleCommandPubSubChannels(cmd.args, true)
+	case cmdPubSubShardNumSub:
+		return s.handleCommandPubSubNumSub(cmd.args, true)
+	case cmdHello:
+		return s.handleCommandHello(client, cmd.args)
+	case cmdSave:
+		return s.handleCommandSave()
+	case cmdBgSave:
+		return s.handleCommandBgSave(cmd.args)
+	case cmdLastSave:
+		return s.handleCommandLastSave()
+	case cmdBgRewriteAof:
+		return s.handleCommandBgRewriteAof()
+	case cmdDump:
+		return s.handleCommandDump(cmd.args)
+	case cmdRestore:
+		return s.handleCommandRestore(cmd.args)
+	case cmdMigrate:
+		return s.handleCommandMigrate(cmd.args)
 	default:
 		return nil, nil
 	}
@@ -156,38 +477,242 @@ func (s *server) handleCommandOnSlave(client *Client, cmd *command) (resp []byte
 	case cmdSet:
 		resp, err = s.handleCommandSetOnSlave(cmd.args)
 	case cmdInfo:
-		err = s.handleCommandInfo(client, cmd.args)
+		resp, err = s.handleCommandInfo(cmd.args)
 	case cmdReplConfGetAck:
 		err = s.handleCommandReplconfGetAck(client)
 	case cmdIncr:
 		resp, err = s.handleCommandIncr(cmd.args)
+	case cmdDel:
+		_, err = s.handleCommandDel(cmd.args)
+	case cmdConfigGet:
+		resp, err = s.handleCommandConfigGet(cmd.args)
+	case cmdConfigSet:
+		resp, err = s.handleCommandConfigSet(cmd.args)
+	case cmdMulti:
+		err = s.handleCommandMulti(client)
+	case cmdExec:
+		err = s.handleCommandExec(client)
+	case cmdDiscard:
+		err = s.handleCommandDiscard(client)
+	case cmdWatch:
+		resp, err = s.handleCommandWatch(client, cmd.args)
+	case cmdUnwatch:
+		resp, err = s.handleCommandUnwatch(client)
+	case cmdFlushAll, cmdFlushDb:
+		_, err = s.handleCommandFlush(cmd.args)
 	case cmdType:
 		resp, err = s.handleCommandType(cmd.args)
 	case cmdXRange:
-		resp, err = s.handleCommandXRANGE(cmd.args)
+		resp, err = s.handleCommandXRANGE(cmd.args, false)
+	case cmdXRevRange:
+		resp, err = s.handleCommandXRANGE(cmd.args, true)
 	case cmdXRead:
-		resp, err = s.handleCommandXREAD(cmd.args)
+		resp, err = s.handleCommandXREAD(client, cmd.args, true)
+	case cmdXLen:
+		resp, err = s.handleCommandXLEN(cmd.args)
+	case cmdXAdd:
+		_, err = s.handleCommandXADD(cmd.args)
+	case cmdXDel:
+		_, err = s.handleCommandXDEL(cmd.args)
+	case cmdXTrim:
+		_, err = s.handleCommandXTRIM(cmd.args)
+	case cmdXSetId:
+		_, err = s.handleCommandXSETID(cmd.args)
+	case cmdXGroupCreate:
+		_, err = s.handleCommandXGroupCreate(cmd.args)
+	case cmdXGroupSetId:
+		_, err = s.handleCommandXGroupSetId(cmd.args)
+	case cmdXGroupDestroy:
+		_, err = s.handleCommandXGroupDestroy(cmd.args)
+	case cmdXGroupCreateConsumer:
+		_, err = s.handleCommandXGroupCreateConsumer(cmd.args)
+	case cmdXGroupDelConsumer:
+		_, err = s.handleCommandXGroupDelConsumer(cmd.args)
+	case cmdXReadGroup:
+		_, err = s.handleCommandXREADGROUP(client, cmd.args, false)
+	case cmdXAck:
+		_, err = s.handleCommandXACK(cmd.args)
+	case cmdXClaim:
+		_, err = s.handleCommandXCLAIM(cmd.args)
+	case cmdXAutoClaim:
+		_, err = s.handleCommandXAUTOCLAIM(cmd.args)
+	case cmdXPending:
+		resp, err = s.handleCommandXPENDING(cmd.args)
+	case cmdXInfoStream:
+		resp, err = s.handleCommandXInfoStream(cmd.args)
+	case cmdXInfoGroups:
+		resp, err = s.handleCommandXInfoGroups(cmd.args)
+	case cmdXInfoConsumers:
+		resp, err = s.handleCommandXInfoConsumers(cmd.args)
+	case cmdHSet:
+		_, err = s.handleCommandHSet(cmd.args)
+	case cmdHDel:
+		_, err = s.handleCommandHDel(cmd.args)
+	case cmdHExpire:
+		_, err = s.handleCommandHExpire(cmd.args, time.Second, false)
+	case cmdHPExpire:
+		_, err = s.handleCommandHExpire(cmd.args, time.Millisecond, false)
+	case cmdHExpireAt:
+		_, err = s.handleCommandHExpire(cmd.args, time.Second, true)
+	case cmdHPExpireAt:
+		_, err = s.handleCommandHExpire(cmd.args, time.Millisecond, true)
+	case cmdHPersist:
+		_, err = s.handleCommandHPersist(cmd.args)
+	case cmdHGetEx:
+		_, err = s.handleCommandHGetEx(cmd.args)
+	case cmdHSetEx:
+		_, err = s.handleCommandHSetEx(cmd.args)
+	case cmdHGet:
+		resp, err = s.handleCommandHGet(cmd.args)
+	case cmdHGetAll:
+		resp, err = s.handleCommandHGetAll(cmd.args)
+	case cmdHLen:
+		resp, err = s.handleCommandHLen(cmd.args)
+	case cmdHTTL:
+		resp, err = s.handleCommandHTTL(cmd.args, time.Second, false)
+	case cmdHPTTL:
+		resp, err = s.handleCommandHTTL(cmd.args, time.Millisecond, false)
+	case cmdHExpireTime:
+		resp, err = s.handleCommandHTTL(cmd.args, time.Second, true)
+	case cmdHPExpireTime:
+		resp, err = s.handleCommandHTTL(cmd.args, time.Millisecond, true)
+	case cmdPing:
+		resp, err = s.handleCommandPing(client, cmd.args)
+	case cmdSubscribe:
+		resp, err = s.handleCommandSubscribe(client, cmd.args, channelSubscription)
+	case cmdUnsubscribe:
+		resp, err = s.handleCommandUnsubscribe(client, cmd.args, channelSubscription)
+	case cmdPSubscribe:
+		resp, err = s.handleCommandSubscribe(client, cmd.args, patternSubscription)
+	case cmdPUnsubscribe:
+		resp, err = s.handleCommandUnsubscribe(client, cmd.args, patternSubscription)
+	case cmdPublish:
+		resp, err = s.handleCommandPublish(cmd.args)
+	case cmdPubSubChannels:
+		resp, err = s.handleCommandPubSubChannels(cmd.args, false)
+	case cmdPubSubNumSub:
+		resp, err = s.handleCommandPubSubNumSub(cmd.args, false)
+	case cmdPubSubNumPat:
+		resp, err = s.handleCommandPubSubNumPat()
+	case cmdSSubscribe:
+		resp, err = s.handleCommandSubscribe(client, cmd.args, shardChannelSubscription)
+	case cmdSUnsubscribe:
+		resp, err = s.handleCommandUnsubscribe(client, cmd.args, shardChannelSubscription)
+	case cmdSPublish:
+		resp, err = s.handleCommandSPublish(cmd.args)
+	case cmdPubSubShardChannels:
+		resp, err = s.handleCommandPubSubChannels(cmd.args, true)
+	case cmdPubSubShardNumSub:
+		resp, err = s.handleCommandPubSubNumSub(cmd.args, true)
+	case cmdHello:
+		resp, err = s.handleCommandHello(client, cmd.args)
+	case cmdSave:
+		resp, err = s.handleCommandSave()
+	case cmdBgSave:
+		resp, err = s.handleCommandBgSave(cmd.args)
+	case cmdLastSave:
+		resp, err = s.handleCommandLastSave()
+	case cmdBgRewriteAof:
+		resp, err = s.handleCommandBgRewriteAof()
+	case cmdDump:
+		resp, err = s.handleCommandDump(cmd.args)
+	case cmdRestore:
+		// RESTORE is propagated by the master, and only by it, so that
+		// the dataset of the slave does not diverge from its own.
+		if !client.isMasterLink {
+			return respAsReadOnlyError(), nil
+		}
+		resp, err = s.handleCommandRestore(cmd.args)
+	case cmdMigrate:
+		// MIGRATE deletes the keys it moves, and is never propagated.
+		resp = respAsReadOnlyError()
 	}
 
-	if err == nil {
-		s.masterReplOffset += cmd.bytesLength()
+	return resp, err
+}
+
+// Targets of propagated commands.
+const (
+	propagateAOF = 1 << iota
+	propagateRepl
+
+	propagateAll = propagateAOF | propagateRepl
+)
+
+// propagateCommand sends cmd to the append-only file, to the slaves, or to
+// both depending on targets.
+func (s *server) propagateCommand(cmd *command, targets int) error {
+	if targets&propagateRepl != 0 {
+		resp, err := cmd.encode()
+		if err != nil {
+			return err
+		}
+		s.propagate(resp)
 	}
 
-	return resp, err
+	if targets&propagateAOF != 0 {
+		resp, err := aofCommand(cmd).encode()
+		if err != nil {
+			return err
+		}
+		s.feedAppendOnlyFile(resp)
+	}
+
+	return nil
 }
 
-func (s *server) propagateCommandToSlaves(cmd *command) error {
-	argsStr := make([]string, 0, len(cmd.args)+1)
-	argsStr = append(argsStr, cmd.name)
-	argsStr = append(argsStr, cmd.args...)
+// propagateTransaction sends the write commands of a transaction wrapped in
+// MULTI and EXEC, all in a single write, so that replicas and the
+// append-only file apply them as one unit.
+func (s *server) propagateTransaction(cmds []*command) error {
+	resp, err := encodeTransaction(cmds)
+	if err != nil {
+		return err
+	}
+	s.propagate(resp)
+
+	aofCmds := make([]*command, 0, len(cmds))
+	for _, cmd := range cmds {
+		aofCmds = append(aofCmds, aofCommand(cmd))
+	}
 
-	resp, err := respAsArray(argsStr)
+	resp, err = encodeTransaction(aofCmds)
 	if err != nil {
 		return err
 	}
+	s.feedAppendOnlyFile(resp)
 
+	return nil
+}
+
+func encodeTransaction(cmds []*command) ([]byte, error) {
+	multi, err := respAsArray([]string{"MULTI"})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := multi
+	for _, cmd := range cmds {
+		cmdResp, err := cmd.encode()
+		if err != nil {
+			return nil, err
+		}
+		resp = append(resp, cmdResp...)
+	}
+
+	exec, err := respAsArray([]string{"EXEC"})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(resp, exec...), nil
+}
+
+// propagate writes resp to the replication stream of every slave.
+func (s *server) propagate(resp []byte) {
 	s.slavesMu.Lock()
 	defer s.slavesMu.Unlock()
+
 	for _, slave := range s.slaves {
 		_, err := slave.Write(resp)
 		if err != nil {
@@ -195,6 +720,4 @@ func (s *server) propagateCommandToSlaves(cmd *command) error {
 			continue
 		}
 	}
-
-	return nil
 }
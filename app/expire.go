@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage"
+)
+
+// Expired keys and hash fields are deleted lazily, when accessed, and by the
+// active expire cycle. As in Redis, only masters delete them: the deletion is
+// propagated to slaves as a DEL or HDEL, and slaves merely hide expired data
+// until then, so that both sides stay consistent.
+
+// expireIfNeeded deletes key if it has expired, and reports whether it has.
+// Callers must hold dataMu.
+func (s *server) expireIfNeeded(key string) bool {
+	expVal, ok := s.data[key]
+	if !ok || !expVal.HasExpired() {
+		return false
+	}
+
+	if s.isMaster() {
+		delete(s.data, key)
+		delete(s.volatileKeys, key)
+		s.signalExpiredKey(key)
+		s.notifyKeyspaceEvent(notifyExpired, "expired", key)
+		s.propagateExpiration(cmdDel, key)
+	}
+
+	return true
+}
+
+// expireHashFieldsIfNeeded deletes the expired fields of the hash at key,
+// and the key itself if no field is left. It reports whether any field was
+// deleted. Callers must hold dataMu.
+func (s *server) expireHashFieldsIfNeeded(key string, hash *storage.Hash) bool {
+	if !s.isMaster() {
+		return false
+	}
+
+	expired := hash.DeleteExpiredFields()
+	if len(expired) == 0 {
+		return false
+	}
+
+	s.signalModifiedKey(key)
+	s.notifyKeyspaceEvent(notifyHash, "hexpired", key)
+	s.propagateExpiration(cmdHDel, key, expired...)
+	s.deleteHashIfEmpty(key, hash)
+
+	return true
+}
+
+// trackVolatileKey records that key has a TTL, or hash fields with one, so
+// that the active expire cycle samples it. Slaves never expire data
+// themselves, so they do not track it. Callers must hold dataMu.
+func (s *server) trackVolatileKey(key string) {
+	if s.isMaster() {
+		s.volatileKeys[key] = struct{}{}
+	}
+}
+
+// hasVolatileData reports whether expVal has a TTL, or hash fields with one.
+func hasVolatileData(expVal *storage.ExpiringValue) bool {
+	return expVal.HasExpiry() || expVal.IsHash() && expVal.Hash.HasExpiringFields()
+}
+
+func (s *server) propagateExpiration(name, key string, args ...string) {
+	err := s.propagateCommand(&command{name: name, args: append([]string{key}, args...)}, propagateAll)
+	if err != nil {
+		fmt.Println("Failed propagating to slaves: ", err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage"
+)
+
+var errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// findHash returns the hash stored at key, or nil if the key does not exist.
+// Callers must hold dataMu.
+func (s *server) findHash(key string) (*storage.Hash, error) {
+	expVal, ok := s.data[key]
+	if !ok {
+		if s.isStream(key) {
+			return nil, errWrongType
+		}
+		return nil, nil
+	}
+
+	if s.expireIfNeeded(key) {
+		return nil, nil
+	}
+
+	if !expVal.IsHash() {
+		return nil, errWrongType
+	}
+
+	s.expireHashFieldsIfNeeded(key, expVal.Hash)
+	if _, ok := s.data[key]; !ok {
+		return nil, nil
+	}
+
+	return expVal.Hash, nil
+}
+
+// findOrCreateHash is like findHash, but creates an empty hash at key if
+// there is none. Callers must hold dataMu.
+func (s *server) findOrCreateHash(key string) (*storage.Hash, error) {
+	hash, err := s.findHash(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if hash == nil {
+		expVal := storage.NewExpiringHash()
+		s.data[key] = expVal
+		hash = expVal.Hash
+	}
+
+	return hash, nil
+}
+
+// deleteHashIfEmpty removes the key of a hash that has no fields left, as
+// Redis never keeps empty aggregates around. Callers must hold dataMu.
+func (s *server) deleteHashIfEmpty(key string, hash *storage.Hash) {
+	if hash == nil || !hash.IsEmpty() {
+		return
+	}
+
+	if expVal, ok := s.data[key]; ok && expVal.Hash == hash {
+		delete(s.data, key)
+		s.notifyKeyspaceEvent(notifyGeneric, "del", key)
+	}
+}
+
+// parseHashFields parses the "FIELDS numfields field [field ...]" block that
+// ends the hash field expiration commands. valuesPerField is 2 when every
+// field is followed by a value, as in HSETEX.
+func parseHashFields(args []string, valuesPerField int) ([]string, error) {
+	if len(args) < 2 || !strings.EqualFold(args[0], "fields") {
+		return nil, errors.New("mandatory argument FIELDS is missing or not at the right position")
+	}
+
+	numFields, err := strconv.Atoi(args[1])
+	if err != nil || numFields <= 0 {
+		return nil, errors.New("Parameter `numFields` should be greater than 0")
+	}
+
+	fields := args[2:]
+	if len(fields) != numFields*valuesPerField {
+		return nil, errors.New("The `numfields` parameter must match the number of arguments")
+	}
+
+	return fields, nil
+}
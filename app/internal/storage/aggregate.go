@@ -0,0 +1,21 @@
+package storage
+
+// List, Set and ZSet hold the values of the types no command operates on
+// yet. They are only kept so that keys loaded from an RDB file survive until
+// the next save.
+type List struct {
+	Elements []string
+}
+
+type Set struct {
+	Members []string
+}
+
+type ZSet struct {
+	Members []ZSetMember
+}
+
+type ZSetMember struct {
+	Member string
+	Score  float64
+}
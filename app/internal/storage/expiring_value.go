@@ -6,6 +6,10 @@ import (
 
 type ExpiringValue struct {
 	Val       string
+	Hash      *Hash
+	List      *List
+	Set       *Set
+	ZSet      *ZSet
 	Created   time.Time
 	ExpiresIn int
 }
@@ -17,6 +21,33 @@ func NewExpiringValue(val string) *ExpiringValue {
 	}
 }
 
+func NewExpiringHash() *ExpiringValue {
+	return &ExpiringValue{
+		Hash:    NewHash(),
+		Created: time.Now().UTC(),
+	}
+}
+
+func (v *ExpiringValue) IsHash() bool {
+	return v.Hash != nil
+}
+
+func (v *ExpiringValue) IsList() bool {
+	return v.List != nil
+}
+
+func (v *ExpiringValue) IsSet() bool {
+	return v.Set != nil
+}
+
+func (v *ExpiringValue) IsZSet() bool {
+	return v.ZSet != nil
+}
+
+func (v *ExpiringValue) IsString() bool {
+	return !v.IsHash() && !v.IsList() && !v.IsSet() && !v.IsZSet()
+}
+
 func (v *ExpiringValue) HasExpired() bool {
 	if v.ExpiresIn < 0 {
 		return true
@@ -26,3 +57,34 @@ func (v *ExpiringValue) HasExpired() bool {
 	}
 	return time.Now().UTC().Sub(v.Created).Milliseconds() >= int64(v.ExpiresIn)
 }
+
+func (v *ExpiringValue) HasExpiry() bool {
+	return v.ExpiresIn != 0
+}
+
+// ExpiresAt returns the absolute expiry time of the value, and false if the
+// value never expires.
+func (v *ExpiringValue) ExpiresAt() (time.Time, bool) {
+	if v.ExpiresIn == 0 {
+		return time.Time{}, false
+	}
+	if v.ExpiresIn < 0 {
+		return v.Created, true
+	}
+	return v.Created.Add(time.Duration(v.ExpiresIn) * time.Millisecond), true
+}
+
+// SetExpiresAt converts an absolute expiry time into the relative ExpiresIn
+// form. Times at or before Created mark the value as already expired.
+func (v *ExpiringValue) SetExpiresAt(t time.Time) {
+	expiresIn := t.Sub(v.Created).Milliseconds()
+	if expiresIn <= 0 {
+		v.ExpiresIn = -1
+		return
+	}
+	v.ExpiresIn = int(expiresIn)
+}
+
+func (v *ExpiringValue) Persist() {
+	v.ExpiresIn = 0
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"time"
+)
+
+// Hash is a field-value map where every field carries its own TTL, reusing
+// ExpiringValue for the per-field expiry bookkeeping.
+type Hash struct {
+	Fields map[string]*ExpiringValue
+}
+
+func NewHash() *Hash {
+	return &Hash{
+		Fields: make(map[string]*ExpiringValue),
+	}
+}
+
+// Get returns the value of a field, hiding it if it has expired. Expired
+// fields are left in place, for DeleteExpiredFields to remove.
+func (h *Hash) Get(field string) (*ExpiringValue, bool) {
+	val, ok := h.Fields[field]
+	if !ok || val.HasExpired() {
+		return nil, false
+	}
+
+	return val, true
+}
+
+// Set stores a field value and clears any TTL the field had. It reports
+// whether the field is new.
+func (h *Hash) Set(field, val string) bool {
+	_, existed := h.Get(field)
+	h.Fields[field] = NewExpiringValue(val)
+	return !existed
+}
+
+// SetKeepTTL stores a field value while preserving the TTL of an existing
+// field. It reports whether the field is new.
+func (h *Hash) SetKeepTTL(field, val string) bool {
+	existing, ok := h.Get(field)
+	if !ok {
+		h.Fields[field] = NewExpiringValue(val)
+		return true
+	}
+
+	expiresAt, hasExpiry := existing.ExpiresAt()
+	fieldVal := NewExpiringValue(val)
+	if hasExpiry {
+		fieldVal.SetExpiresAt(expiresAt)
+	}
+	h.Fields[field] = fieldVal
+
+	return false
+}
+
+// Delete removes a field and reports whether it was there. Expired fields
+// are removed too, as they are by the HDEL a master sends once they expire.
+func (h *Hash) Delete(field string) bool {
+	_, ok := h.Fields[field]
+	delete(h.Fields, field)
+	return ok
+}
+
+// Len returns the number of fields that have not expired.
+func (h *Hash) Len() int {
+	n := 0
+	for _, val := range h.Fields {
+		if !val.HasExpired() {
+			n++
+		}
+	}
+
+	return n
+}
+
+// IsEmpty reports whether the hash has no fields at all, expired ones
+// included, since those are still to be deleted.
+func (h *Hash) IsEmpty() bool {
+	return len(h.Fields) == 0
+}
+
+// DeleteExpiredFields removes all expired fields and returns their names.
+func (h *Hash) DeleteExpiredFields() []string {
+	var expired []string
+
+	for field, val := range h.Fields {
+		if val.HasExpired() {
+			delete(h.Fields, field)
+			expired = append(expired, field)
+		}
+	}
+
+	return expired
+}
+
+// HasExpiringFields reports whether any field has a TTL set.
+func (h *Hash) HasExpiringFields() bool {
+	for _, val := range h.Fields {
+		if val.HasExpiry() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ExpireField sets the absolute expiry time of an existing field. A time
+// that is not in the future deletes the field right away, and the returned
+// flag reports whether that happened.
+func (h *Hash) ExpireField(field string, at time.Time) (deleted bool) {
+	val, ok := h.Get(field)
+	if !ok {
+		return false
+	}
+
+	if !at.After(time.Now().UTC()) {
+		delete(h.Fields, field)
+		return true
+	}
+
+	val.SetExpiresAt(at)
+
+	return false
+}
@@ -0,0 +1,435 @@
+// Package listpack implements the listpack format Redis uses to store
+// small aggregates and stream nodes: a single byte slice of string and
+// integer elements that can be walked in both directions.
+//
+// A listpack starts with a 6-byte header holding its total size (uint32,
+// little endian) and its number of elements (uint16, little endian, 65535 if
+// unknown), followed by the elements and a terminating 0xFF byte. Every
+// element is made of an encoding byte, its data and a backlen that stores the
+// length of the first two parts so the element can be reached from its end.
+package listpack
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+const (
+	headerSize = 6
+	eof        = 0xFF
+
+	// numElementsUnknown is stored in the header once the number of
+	// elements no longer fits in 16 bits.
+	numElementsUnknown = math.MaxUint16
+
+	encoding7BitUint     = 0x00
+	encoding7BitUintMask = 0x80
+	encoding6BitStr      = 0x80
+	encoding6BitStrMask  = 0xC0
+	encoding13BitInt     = 0xC0
+	encoding13BitIntMask = 0xE0
+	encoding12BitStr     = 0xE0
+	encoding12BitStrMask = 0xF0
+	encoding16BitInt     = 0xF1
+	encoding24BitInt     = 0xF2
+	encoding32BitInt     = 0xF3
+	encoding64BitInt     = 0xF4
+	encoding32BitStr     = 0xF0
+)
+
+var ErrCorrupt = errors.New("listpack: corrupt encoding")
+
+type Listpack struct {
+	buf []byte
+}
+
+// Value is a decoded listpack element, either a string or an integer.
+type Value struct {
+	Str   []byte
+	Int   int64
+	IsInt bool
+}
+
+func (v Value) String() string {
+	if v.IsInt {
+		return strconv.FormatInt(v.Int, 10)
+	}
+	return string(v.Str)
+}
+
+func New() *Listpack {
+	buf := make([]byte, headerSize+1, 64)
+	buf[headerSize] = eof
+	lp := &Listpack{buf: buf}
+	lp.setTotalBytes(len(buf))
+	return lp
+}
+
+// FromBytes wraps a serialized listpack, such as one read from an RDB file,
+// after validating its structure.
+func FromBytes(b []byte) (*Listpack, error) {
+	if len(b) < headerSize+1 {
+		return nil, ErrCorrupt
+	}
+
+	if int(binary.LittleEndian.Uint32(b)) != len(b) || b[len(b)-1] != eof {
+		return nil, ErrCorrupt
+	}
+
+	lp := &Listpack{buf: b}
+
+	count := 0
+	for off := lp.First(); off >= 0; off = lp.Next(off) {
+		if _, err := lp.entrySize(off); err != nil {
+			return nil, err
+		}
+		count++
+	}
+
+	if n := binary.LittleEndian.Uint16(b[4:]); n != numElementsUnknown && int(n) != count {
+		return nil, ErrCorrupt
+	}
+
+	return lp, nil
+}
+
+// Bytes returns the serialized listpack. The slice is shared with the
+// listpack and must not be modified.
+func (lp *Listpack) Bytes() []byte {
+	return lp.buf
+}
+
+// Size returns the number of bytes the listpack occupies.
+func (lp *Listpack) Size() int {
+	return len(lp.buf)
+}
+
+// Len returns the number of elements.
+func (lp *Listpack) Len() int {
+	if n := binary.LittleEndian.Uint16(lp.buf[4:]); n != numElementsUnknown {
+		return int(n)
+	}
+
+	count := 0
+	for off := lp.First(); off >= 0; off = lp.Next(off) {
+		count++
+	}
+	return count
+}
+
+// First returns the offset of the first element, or -1 if there is none.
+func (lp *Listpack) First() int {
+	if lp.buf[headerSize] == eof {
+		return -1
+	}
+	return headerSize
+}
+
+// Last returns the offset of the last element, or -1 if there is none.
+func (lp *Listpack) Last() int {
+	return lp.Prev(len(lp.buf) - 1)
+}
+
+// Next returns the offset of the element following the one at off, or -1
+// if it is the last one.
+func (lp *Listpack) Next(off int) int {
+	size, err := lp.entrySize(off)
+	if err != nil {
+		return -1
+	}
+
+	next := off + size + backlenSize(size)
+	if next >= len(lp.buf) || lp.buf[next] == eof {
+		return -1
+	}
+	return next
+}
+
+// Prev returns the offset of the element preceding the one at off, or -1 if
+// it is the first one. off may also be the offset of the terminator.
+func (lp *Listpack) Prev(off int) int {
+	if off <= headerSize {
+		return -1
+	}
+
+	p := off - 1
+	var size, shift uint64
+	for {
+		size |= uint64(lp.buf[p]&127) << shift
+		if lp.buf[p]&128 == 0 {
+			break
+		}
+		shift += 7
+		p--
+		if p < headerSize {
+			return -1
+		}
+	}
+
+	prev := off - int(size) - backlenSize(int(size))
+	if prev < headerSize {
+		return -1
+	}
+	return prev
+}
+
+// Seek returns the offset of the element at index, counting from the end
+// for negative indexes, or -1 if it is out of range.
+func (lp *Listpack) Seek(index int) int {
+	if index < 0 {
+		off := lp.Last()
+		for i := -1; i > index && off >= 0; i-- {
+			off = lp.Prev(off)
+		}
+		return off
+	}
+
+	off := lp.First()
+	for i := 0; i < index && off >= 0; i++ {
+		off = lp.Next(off)
+	}
+	return off
+}
+
+// Get decodes the element at off.
+func (lp *Listpack) Get(off int) Value {
+	b := lp.buf[off:]
+	enc := b[0]
+
+	switch {
+	case enc&encoding7BitUintMask == encoding7BitUint:
+		return Value{Int: int64(enc & 0x7F), IsInt: true}
+	case enc&encoding6BitStrMask == encoding6BitStr:
+		n := int(enc & 0x3F)
+		return Value{Str: b[1 : 1+n]}
+	case enc&encoding13BitIntMask == encoding13BitInt:
+		v := int64(enc&0x1F)<<8 | int64(b[1])
+		if v >= 1<<12 {
+			v -= 1 << 13
+		}
+		return Value{Int: v, IsInt: true}
+	case enc&encoding12BitStrMask == encoding12BitStr:
+		n := int(enc&0x0F)<<8 | int(b[1])
+		return Value{Str: b[2 : 2+n]}
+	case enc == encoding16BitInt:
+		return Value{Int: int64(int16(binary.LittleEndian.Uint16(b[1:]))), IsInt: true}
+	case enc == encoding24BitInt:
+		v := int64(b[1]) | int64(b[2])<<8 | int64(b[3])<<16
+		if v >= 1<<23 {
+			v -= 1 << 24
+		}
+		return Value{Int: v, IsInt: true}
+	case enc == encoding32BitInt:
+		return Value{Int: int64(int32(binary.LittleEndian.Uint32(b[1:]))), IsInt: true}
+	case enc == encoding64BitInt:
+		return Value{Int: int64(binary.LittleEndian.Uint64(b[1:])), IsInt: true}
+	case enc == encoding32BitStr:
+		n := int(binary.LittleEndian.Uint32(b[1:]))
+		return Value{Str: b[5 : 5+n]}
+	default:
+		return Value{}
+	}
+}
+
+// GetInt decodes the element at off as an integer, parsing it if it was
+// stored as a string.
+func (lp *Listpack) GetInt(off int) (int64, error) {
+	v := lp.Get(off)
+	if v.IsInt {
+		return v.Int, nil
+	}
+	return strconv.ParseInt(string(v.Str), 10, 64)
+}
+
+// AppendString appends a string element. Strings that represent integers are
+// stored in integer form, as Redis does.
+func (lp *Listpack) AppendString(s string) {
+	if v, ok := stringToInt64(s); ok {
+		lp.AppendInt(v)
+		return
+	}
+	lp.insert(len(lp.buf)-1, encodeString([]byte(s)))
+}
+
+func (lp *Listpack) AppendInt(v int64) {
+	lp.insert(len(lp.buf)-1, encodeInt(v))
+}
+
+// ReplaceInt replaces the element at off with an integer and returns the
+// offset of the element following it, or -1 if it is the last one.
+func (lp *Listpack) ReplaceInt(off int, v int64) int {
+	size, err := lp.entrySize(off)
+	if err != nil {
+		return -1
+	}
+	old := size + backlenSize(size)
+
+	entry := encodeInt(v)
+	lp.buf = append(lp.buf[:off], append(entry, lp.buf[off+old:]...)...)
+	lp.setTotalBytes(len(lp.buf))
+
+	next := off + len(entry)
+	if lp.buf[next] == eof {
+		return -1
+	}
+	return next
+}
+
+func (lp *Listpack) insert(off int, entry []byte) {
+	lp.buf = append(lp.buf[:off], append(entry, lp.buf[off:]...)...)
+	lp.setTotalBytes(len(lp.buf))
+
+	n := binary.LittleEndian.Uint16(lp.buf[4:])
+	if n != numElementsUnknown {
+		binary.LittleEndian.PutUint16(lp.buf[4:], n+1)
+	}
+}
+
+func (lp *Listpack) setTotalBytes(n int) {
+	binary.LittleEndian.PutUint32(lp.buf, uint32(n))
+}
+
+// entrySize returns the size of the encoding and data of the element at off,
+// not counting its backlen.
+func (lp *Listpack) entrySize(off int) (int, error) {
+	if off < headerSize || off >= len(lp.buf)-1 {
+		return 0, ErrCorrupt
+	}
+
+	b := lp.buf[off:]
+	enc := b[0]
+
+	var size int
+	switch {
+	case enc&encoding7BitUintMask == encoding7BitUint:
+		size = 1
+	case enc&encoding6BitStrMask == encoding6BitStr:
+		size = 1 + int(enc&0x3F)
+	case enc&encoding13BitIntMask == encoding13BitInt:
+		size = 2
+	case enc&encoding12BitStrMask == encoding12BitStr:
+		if len(b) < 2 {
+			return 0, ErrCorrupt
+		}
+		size = 2 + (int(enc&0x0F)<<8 | int(b[1]))
+	case enc == encoding16BitInt:
+		size = 3
+	case enc == encoding24BitInt:
+		size = 4
+	case enc == encoding32BitInt:
+		size = 5
+	case enc == encoding64BitInt:
+		size = 9
+	case enc == encoding32BitStr:
+		if len(b) < 5 {
+			return 0, ErrCorrupt
+		}
+		size = 5 + int(binary.LittleEndian.Uint32(b[1:]))
+	default:
+		return 0, fmt.Errorf("%w: unknown encoding byte 0x%02x", ErrCorrupt, enc)
+	}
+
+	if off+size+backlenSize(size) > len(lp.buf)-1 {
+		return 0, ErrCorrupt
+	}
+
+	return size, nil
+}
+
+func encodeInt(v int64) []byte {
+	var b []byte
+
+	switch {
+	case v >= 0 && v <= 127:
+		b = []byte{byte(v)}
+	case v >= -4096 && v <= 4095:
+		u := uint64(v) & 0x1FFF
+		b = []byte{encoding13BitInt | byte(u>>8), byte(u)}
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		b = []byte{encoding16BitInt, 0, 0}
+		binary.LittleEndian.PutUint16(b[1:], uint16(v))
+	case v >= -(1<<23) && v <= 1<<23-1:
+		u := uint32(v)
+		b = []byte{encoding24BitInt, byte(u), byte(u >> 8), byte(u >> 16)}
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		b = []byte{encoding32BitInt, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(b[1:], uint32(v))
+	default:
+		b = make([]byte, 9)
+		b[0] = encoding64BitInt
+		binary.LittleEndian.PutUint64(b[1:], uint64(v))
+	}
+
+	return appendBacklen(b)
+}
+
+func encodeString(s []byte) []byte {
+	var b []byte
+
+	switch n := len(s); {
+	case n < 64:
+		b = append([]byte{encoding6BitStr | byte(n)}, s...)
+	case n < 4096:
+		b = append([]byte{encoding12BitStr | byte(n>>8), byte(n)}, s...)
+	default:
+		b = make([]byte, 5, 5+n)
+		b[0] = encoding32BitStr
+		binary.LittleEndian.PutUint32(b[1:], uint32(n))
+		b = append(b, s...)
+	}
+
+	return appendBacklen(b)
+}
+
+// appendBacklen appends the backlen of an element made of the bytes in b.
+// The length is split in 7-bit groups, most significant first, with the high
+// bit set on every byte but the first so it can be decoded right to left.
+func appendBacklen(b []byte) []byte {
+	l := uint64(len(b))
+
+	switch {
+	case l <= 127:
+		return append(b, byte(l))
+	case l < 16383:
+		return append(b, byte(l>>7), byte(l&127)|128)
+	case l < 2097151:
+		return append(b, byte(l>>14), byte((l>>7)&127)|128, byte(l&127)|128)
+	case l < 268435455:
+		return append(b, byte(l>>21), byte((l>>14)&127)|128, byte((l>>7)&127)|128, byte(l&127)|128)
+	default:
+		return append(b, byte(l>>28), byte((l>>21)&127)|128, byte((l>>14)&127)|128, byte((l>>7)&127)|128, byte(l&127)|128)
+	}
+}
+
+func backlenSize(l int) int {
+	switch {
+	case l <= 127:
+		return 1
+	case l < 16383:
+		return 2
+	case l < 2097151:
+		return 3
+	case l < 268435455:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// stringToInt64 reports whether s is the canonical decimal representation of
+// an int64, so that storing it as an integer round-trips exactly.
+func stringToInt64(s string) (int64, bool) {
+	if len(s) == 0 || len(s) > 20 {
+		return 0, false
+	}
+
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+
+	return v, strconv.FormatInt(v, 10) == s
+}
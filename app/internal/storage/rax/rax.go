@@ -0,0 +1,333 @@
+// Package rax implements a compressed radix tree mapping byte string keys to
+// values in lexicographic order, in the spirit of the rax tree Redis uses to
+// index streams.
+//
+// Every node stores the compressed edge that leads to it from its parent, so
+// a chain of nodes with a single child collapses into one node. Lookups and
+// ordered seeks cost O(k) in the length of the key rather than O(log n) in
+// the number of keys.
+package rax
+
+import (
+	"bytes"
+	"sort"
+)
+
+type node struct {
+	prefix   []byte
+	children []*node
+	isKey    bool
+	value    any
+}
+
+type Tree struct {
+	root     *node
+	numKeys  int
+	numNodes int
+}
+
+func New() *Tree {
+	return &Tree{
+		root:     &node{},
+		numNodes: 1,
+	}
+}
+
+// Len returns the number of keys.
+func (t *Tree) Len() int {
+	return t.numKeys
+}
+
+// NodeCount returns the number of nodes, including the root.
+func (t *Tree) NodeCount() int {
+	return t.numNodes
+}
+
+// Insert stores value at key and reports whether an existing value was
+// replaced.
+func (t *Tree) Insert(key []byte, value any) bool {
+	n := t.root
+	rest := key
+
+	for {
+		if len(rest) == 0 {
+			replaced := n.isKey
+			n.isKey = true
+			n.value = value
+			if !replaced {
+				t.numKeys++
+			}
+			return replaced
+		}
+
+		idx, child := n.findChild(rest[0])
+		if child == nil {
+			leaf := &node{
+				prefix: append([]byte(nil), rest...),
+				isKey:  true,
+				value:  value,
+			}
+			n.children = append(n.children, nil)
+			copy(n.children[idx+1:], n.children[idx:])
+			n.children[idx] = leaf
+			t.numNodes++
+			t.numKeys++
+			return false
+		}
+
+		common := commonPrefixLen(child.prefix, rest)
+		if common < len(child.prefix) {
+			split := &node{
+				prefix:   child.prefix[:common:common],
+				children: []*node{child},
+			}
+			child.prefix = child.prefix[common:]
+			n.children[idx] = split
+			t.numNodes++
+			child = split
+		}
+
+		n = child
+		rest = rest[common:]
+	}
+}
+
+// Find returns the value stored at key.
+func (t *Tree) Find(key []byte) (any, bool) {
+	n := t.root
+	rest := key
+
+	for len(rest) > 0 {
+		_, child := n.findChild(rest[0])
+		if child == nil || !bytes.HasPrefix(rest, child.prefix) {
+			return nil, false
+		}
+		n = child
+		rest = rest[len(child.prefix):]
+	}
+
+	if !n.isKey {
+		return nil, false
+	}
+	return n.value, true
+}
+
+// Remove deletes key and reports whether it existed.
+func (t *Tree) Remove(key []byte) bool {
+	if !t.remove(t.root, key) {
+		return false
+	}
+	t.numKeys--
+	return true
+}
+
+func (t *Tree) remove(n *node, rest []byte) bool {
+	if len(rest) == 0 {
+		if !n.isKey {
+			return false
+		}
+		n.isKey = false
+		n.value = nil
+		return true
+	}
+
+	idx, child := n.findChild(rest[0])
+	if child == nil || !bytes.HasPrefix(rest, child.prefix) {
+		return false
+	}
+
+	if !t.remove(child, rest[len(child.prefix):]) {
+		return false
+	}
+
+	switch {
+	case !child.isKey && len(child.children) == 0:
+		n.children = append(n.children[:idx], n.children[idx+1:]...)
+		t.numNodes--
+	case !child.isKey && len(child.children) == 1:
+		grandchild := child.children[0]
+		grandchild.prefix = append(append([]byte(nil), child.prefix...), grandchild.prefix...)
+		n.children[idx] = grandchild
+		t.numNodes--
+	}
+
+	return true
+}
+
+// First returns the smallest key.
+func (t *Tree) First() ([]byte, any, bool) {
+	if t.numKeys == 0 {
+		return nil, nil, false
+	}
+	return first(t.root, nil)
+}
+
+// Last returns the greatest key.
+func (t *Tree) Last() ([]byte, any, bool) {
+	if t.numKeys == 0 {
+		return nil, nil, false
+	}
+	return last(t.root, nil)
+}
+
+// Ceil returns the smallest key greater than or equal to key.
+func (t *Tree) Ceil(key []byte) ([]byte, any, bool) {
+	return ceil(t.root, nil, key, false)
+}
+
+// Higher returns the smallest key strictly greater than key.
+func (t *Tree) Higher(key []byte) ([]byte, any, bool) {
+	return ceil(t.root, nil, key, true)
+}
+
+// Floor returns the greatest key less than or equal to key.
+func (t *Tree) Floor(key []byte) ([]byte, any, bool) {
+	return floor(t.root, nil, key, false)
+}
+
+// Lower returns the greatest key strictly less than key.
+func (t *Tree) Lower(key []byte) ([]byte, any, bool) {
+	return floor(t.root, nil, key, true)
+}
+
+// Walk calls fn for every key in ascending order until fn returns false.
+func (t *Tree) Walk(fn func(key []byte, value any) bool) {
+	walk(t.root, nil, fn)
+}
+
+func walk(n *node, path []byte, fn func(key []byte, value any) bool) bool {
+	path = appendPath(path, n.prefix)
+
+	if n.isKey && !fn(path, n.value) {
+		return false
+	}
+
+	for _, child := range n.children {
+		if !walk(child, path, fn) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ceil looks for the smallest key in the subtree of n that is greater than
+// (or, unless strict, equal to) path+rest, where path is the key of n's
+// parent.
+func ceil(n *node, path, rest []byte, strict bool) ([]byte, any, bool) {
+	path = appendPath(path, n.prefix)
+
+	if len(rest) == 0 {
+		if n.isKey && !strict {
+			return path, n.value, true
+		}
+		for _, child := range n.children {
+			if k, v, ok := first(child, path); ok {
+				return k, v, true
+			}
+		}
+		return nil, nil, false
+	}
+
+	for _, child := range n.children {
+		common := commonPrefixLen(child.prefix, rest)
+
+		switch {
+		case common == len(child.prefix):
+			if k, v, ok := ceil(child, path, rest[common:], strict); ok {
+				return k, v, true
+			}
+		case common == len(rest) || child.prefix[common] > rest[common]:
+			return first(child, path)
+		}
+	}
+
+	return nil, nil, false
+}
+
+// floor is the mirror image of ceil.
+func floor(n *node, path, rest []byte, strict bool) ([]byte, any, bool) {
+	path = appendPath(path, n.prefix)
+
+	if len(rest) == 0 {
+		if n.isKey && !strict {
+			return path, n.value, true
+		}
+		return nil, nil, false
+	}
+
+	for i := len(n.children) - 1; i >= 0; i-- {
+		child := n.children[i]
+		common := commonPrefixLen(child.prefix, rest)
+
+		switch {
+		case common == len(child.prefix):
+			if k, v, ok := floor(child, path, rest[common:], strict); ok {
+				return k, v, true
+			}
+		case common < len(rest) && child.prefix[common] < rest[common]:
+			return last(child, path)
+		}
+	}
+
+	if n.isKey {
+		return path, n.value, true
+	}
+
+	return nil, nil, false
+}
+
+func first(n *node, path []byte) ([]byte, any, bool) {
+	for {
+		path = appendPath(path, n.prefix)
+		if n.isKey {
+			return path, n.value, true
+		}
+		if len(n.children) == 0 {
+			return nil, nil, false
+		}
+		n = n.children[0]
+	}
+}
+
+func last(n *node, path []byte) ([]byte, any, bool) {
+	for {
+		path = appendPath(path, n.prefix)
+		if len(n.children) == 0 {
+			return path, n.value, n.isKey
+		}
+		n = n.children[len(n.children)-1]
+	}
+}
+
+// findChild returns the child whose edge starts with b, or nil and the index
+// at which such a child would have to be inserted.
+func (n *node) findChild(b byte) (int, *node) {
+	idx := sort.Search(len(n.children), func(i int) bool {
+		return n.children[i].prefix[0] >= b
+	})
+
+	if idx < len(n.children) && n.children[idx].prefix[0] == b {
+		return idx, n.children[idx]
+	}
+
+	return idx, nil
+}
+
+// appendPath returns a fresh slice, so keys handed out never alias each
+// other.
+func appendPath(path, prefix []byte) []byte {
+	result := make([]byte, 0, len(path)+len(prefix))
+	result = append(result, path...)
+	return append(result, prefix...)
+}
+
+func commonPrefixLen(a, b []byte) int {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
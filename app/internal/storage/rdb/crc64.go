@@ -0,0 +1,32 @@
+package rdb
+
+// Redis checksums RDB files with CRC-64/Jones: the reflected form of the
+// polynomial 0xad93d23594c935a9, with an initial value of 0 and no final
+// xor. hash/crc64 cannot be used as it always complements the checksum.
+const crc64JonesPoly = 0x95ac9329ac4bc9b5
+
+var crc64Table = makeCRC64Table()
+
+func makeCRC64Table() *[256]uint64 {
+	table := new([256]uint64)
+	for i := range table {
+		crc := uint64(i)
+		for bit := 0; bit < 8; bit++ {
+			if crc&1 == 1 {
+				crc = crc>>1 ^ crc64JonesPoly
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
+
+// crc64Update returns the checksum of crc's input followed by p.
+func crc64Update(crc uint64, p []byte) uint64 {
+	for _, b := range p {
+		crc = crc64Table[byte(crc)^b] ^ crc>>8
+	}
+	return crc
+}
@@ -0,0 +1,687 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/listpack"
+)
+
+// Opcodes of module values and module aux data, which hold the typed fields
+// saved by a module.
+const (
+	moduleOpcodeEOF    = 0
+	moduleOpcodeSInt   = 1
+	moduleOpcodeUInt   = 2
+	moduleOpcodeFloat  = 3
+	moduleOpcodeDouble = 4
+	moduleOpcodeString = 5
+)
+
+// Containers of quicklist nodes: a plain node holds a single large element
+// as is, while a packed node is a listpack of elements.
+const (
+	quicklistNodePlain  = 1
+	quicklistNodePacked = 2
+)
+
+// hashListpackNoTTL marks the fields without a TTL in listpacks of hashes
+// with field TTLs.
+const hashListpackNoTTL = 0
+
+// maxPrealloc bounds the capacity allocated from element counts read from a
+// file, so that a corrupt count can not exhaust memory before failing.
+const maxPrealloc = 1024
+
+// parseObject reads the value of a key stored with the given type, converting
+// every encoding of a type into the same Object layout.
+func parseObject(in io.Reader, valType byte) (*Object, error) {
+	switch valType {
+	case typeString:
+		str, err := parseString(in)
+		if err != nil {
+			return nil, err
+		}
+		return &Object{Type: StringObject, String: str}, nil
+	case typeList:
+		elems, err := parseStrings(in)
+		if err != nil {
+			return nil, err
+		}
+		return &Object{Type: ListObject, List: elems}, nil
+	case typeListZiplist:
+		elems, err := parseZiplist(in)
+		if err != nil {
+			return nil, err
+		}
+		return &Object{Type: ListObject, List: elems}, nil
+	case typeListQuicklist, typeListQuicklist2:
+		elems, err := parseQuicklist(in, valType)
+		if err != nil {
+			return nil, err
+		}
+		return &Object{Type: ListObject, List: elems}, nil
+	case typeSet:
+		members, err := parseStrings(in)
+		if err != nil {
+			return nil, err
+		}
+		return &Object{Type: SetObject, Set: members}, nil
+	case typeSetIntset:
+		blob, err := parseString(in)
+		if err != nil {
+			return nil, err
+		}
+		members, err := intsetMembers([]byte(blob))
+		if err != nil {
+			return nil, err
+		}
+		return &Object{Type: SetObject, Set: members}, nil
+	case typeSetListpack:
+		members, err := parseListpack(in)
+		if err != nil {
+			return nil, err
+		}
+		return &Object{Type: SetObject, Set: members}, nil
+	case typeZSet, typeZSet2:
+		return parseZSet(in, valType)
+	case typeZSetZiplist, typeZSetListpack:
+		var pairs []string
+		var err error
+		if valType == typeZSetZiplist {
+			pairs, err = parseZiplist(in)
+		} else {
+			pairs, err = parseListpack(in)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return zsetFromPairs(pairs)
+	case typeHash:
+		return parseHash(in)
+	case typeHashZiplist, typeHashListpack:
+		var pairs []string
+		var err error
+		if valType == typeHashZiplist {
+			pairs, err = parseZiplist(in)
+		} else {
+			pairs, err = parseListpack(in)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return hashFromPairs(pairs)
+	case typeHashMetadata, typeHashMetadataPreGA:
+		return parseHashMetadata(in, valType)
+	case typeHashListpackEx, typeHashListpackExPreGA:
+		return parseHashListpackEx(in, valType)
+	case typeStreamListpacks, typeStreamListpacks2, typeStreamListpacks3:
+		stream, err := parseStream(in, valType)
+		if err != nil {
+			return nil, err
+		}
+		return &Object{Type: StreamObject, Stream: stream}, nil
+	case typeModule, typeModule2:
+		return nil, errors.New("module values are not supported")
+	case typeHashZipmap:
+		return nil, errors.New("zipmap encoded hashes are not supported")
+	default:
+		return nil, fmt.Errorf("unknown value type %d", valType)
+	}
+}
+
+// parseLength reads a length, which unlike strings can not be stored as an
+// integer encoding.
+func parseLength(in io.Reader) (uint64, error) {
+	l, encoded, err := parseLengthEncoding(in)
+	if err != nil {
+		return 0, err
+	}
+	if encoded != 0 {
+		return 0, errors.New("unexpected encoded length")
+	}
+
+	return l, nil
+}
+
+func parseStrings(in io.Reader) ([]string, error) {
+	n, err := parseLength(in)
+	if err != nil {
+		return nil, err
+	}
+
+	strs := make([]string, 0, min(n, maxPrealloc))
+	for range n {
+		str, err := parseString(in)
+		if err != nil {
+			return nil, err
+		}
+		strs = append(strs, str)
+	}
+
+	return strs, nil
+}
+
+func parseZiplist(in io.Reader) ([]string, error) {
+	blob, err := parseString(in)
+	if err != nil {
+		return nil, err
+	}
+
+	return ziplistEntries([]byte(blob))
+}
+
+func parseListpack(in io.Reader) ([]string, error) {
+	blob, err := parseString(in)
+	if err != nil {
+		return nil, err
+	}
+
+	return listpackEntries([]byte(blob))
+}
+
+func listpackEntries(b []byte) ([]string, error) {
+	lp, err := listpack.FromBytes(b)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]string, 0, lp.Len())
+	for off := lp.First(); off >= 0; off = lp.Next(off) {
+		entries = append(entries, lp.Get(off).String())
+	}
+
+	return entries, nil
+}
+
+// parseQuicklist reads the nodes of a list: ziplists for the original
+// quicklist type, and plain or packed nodes for the second version.
+func parseQuicklist(in io.Reader, valType byte) ([]string, error) {
+	n, err := parseLength(in)
+	if err != nil {
+		return nil, err
+	}
+
+	var elems []string
+	for range n {
+		container := uint64(quicklistNodePacked)
+		if valType == typeListQuicklist2 {
+			container, err = parseLength(in)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		blob, err := parseString(in)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case container == quicklistNodePlain:
+			elems = append(elems, blob)
+			continue
+		case container != quicklistNodePacked:
+			return nil, fmt.Errorf("unknown quicklist container %d", container)
+		}
+
+		var nodeElems []string
+		if valType == typeListQuicklist {
+			nodeElems, err = ziplistEntries([]byte(blob))
+		} else {
+			nodeElems, err = listpackEntries([]byte(blob))
+		}
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, nodeElems...)
+	}
+
+	return elems, nil
+}
+
+// parseZSet reads a sorted set with scores stored as strings (the original
+// type) or as binary doubles (the second version).
+func parseZSet(in io.Reader, valType byte) (*Object, error) {
+	n, err := parseLength(in)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &Object{Type: ZSetObject, ZSet: make([]ZSetMember, 0, min(n, maxPrealloc))}
+	for range n {
+		member, err := parseString(in)
+		if err != nil {
+			return nil, err
+		}
+
+		var score float64
+		if valType == typeZSet2 {
+			score, err = parseBinaryDouble(in)
+		} else {
+			score, err = parseStringDouble(in)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		obj.ZSet = append(obj.ZSet, ZSetMember{Member: member, Score: score})
+	}
+
+	return obj, nil
+}
+
+// zsetFromPairs builds a sorted set from the member and score pairs of a
+// ziplist or listpack.
+func zsetFromPairs(pairs []string) (*Object, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("sorted set with an odd number of elements")
+	}
+
+	obj := &Object{Type: ZSetObject, ZSet: make([]ZSetMember, 0, len(pairs)/2)}
+	for i := 0; i < len(pairs); i += 2 {
+		score, err := strconv.ParseFloat(pairs[i+1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sorted set score %q", pairs[i+1])
+		}
+		obj.ZSet = append(obj.ZSet, ZSetMember{Member: pairs[i], Score: score})
+	}
+
+	return obj, nil
+}
+
+func parseHash(in io.Reader) (*Object, error) {
+	n, err := parseLength(in)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &Object{Type: HashObject, Hash: make([]HashField, 0, min(n, maxPrealloc))}
+	for range n {
+		field, err := parseString(in)
+		if err != nil {
+			return nil, err
+		}
+
+		val, err := parseString(in)
+		if err != nil {
+			return nil, err
+		}
+
+		obj.Hash = append(obj.Hash, HashField{Field: field, Value: val})
+	}
+
+	return obj, nil
+}
+
+// hashFromPairs builds a hash from the field and value pairs of a ziplist or
+// listpack.
+func hashFromPairs(pairs []string) (*Object, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("hash with an odd number of elements")
+	}
+
+	obj := &Object{Type: HashObject, Hash: make([]HashField, 0, len(pairs)/2)}
+	for i := 0; i < len(pairs); i += 2 {
+		obj.Hash = append(obj.Hash, HashField{Field: pairs[i], Value: pairs[i+1]})
+	}
+
+	return obj, nil
+}
+
+// parseHashMetadata reads a hash with field TTLs. TTLs are relative to the
+// earliest one, plus one so that 0 means no TTL, except in the pre-GA
+// variant which stores absolute times.
+func parseHashMetadata(in io.Reader, valType byte) (*Object, error) {
+	var minExpire int64
+	if valType == typeHashMetadata {
+		var err error
+		minExpire, err = parseInt64(in)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	n, err := parseLength(in)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := &Object{Type: HashObject, Hash: make([]HashField, 0, min(n, maxPrealloc))}
+	for range n {
+		ttl, err := parseLength(in)
+		if err != nil {
+			return nil, err
+		}
+
+		field, err := parseString(in)
+		if err != nil {
+			return nil, err
+		}
+
+		val, err := parseString(in)
+		if err != nil {
+			return nil, err
+		}
+
+		hashField := HashField{Field: field, Value: val}
+		if ttl != 0 {
+			at := int64(ttl)
+			if valType == typeHashMetadata {
+				at += minExpire - 1
+			}
+			expiresAt := time.UnixMilli(at)
+			hashField.ExpiresAt = &expiresAt
+		}
+		obj.Hash = append(obj.Hash, hashField)
+	}
+
+	return obj, nil
+}
+
+// parseHashListpackEx reads a small hash with field TTLs: a listpack of
+// field, value and absolute TTL triplets, preceded by the earliest TTL
+// except in the pre-GA variant.
+func parseHashListpackEx(in io.Reader, valType byte) (*Object, error) {
+	if valType == typeHashListpackEx {
+		if _, err := parseInt64(in); err != nil {
+			return nil, err
+		}
+	}
+
+	triplets, err := parseListpack(in)
+	if err != nil {
+		return nil, err
+	}
+	if len(triplets)%3 != 0 {
+		return nil, errors.New("hash listpack with an invalid number of elements")
+	}
+
+	obj := &Object{Type: HashObject, Hash: make([]HashField, 0, len(triplets)/3)}
+	for i := 0; i < len(triplets); i += 3 {
+		ttl, err := strconv.ParseInt(triplets[i+2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hash field TTL %q", triplets[i+2])
+		}
+
+		hashField := HashField{Field: triplets[i], Value: triplets[i+1]}
+		if ttl != hashListpackNoTTL {
+			expiresAt := time.UnixMilli(ttl)
+			hashField.ExpiresAt = &expiresAt
+		}
+		obj.Hash = append(obj.Hash, hashField)
+	}
+
+	return obj, nil
+}
+
+// parseStream reads a stream in any of its three versions. The first one
+// lacks the first and max deleted IDs and the number of entries added, as
+// well as the entries read by groups, and the first two lack the active
+// time of consumers; they get the values Redis gives them when loading.
+func parseStream(in io.Reader, valType byte) (*Stream, error) {
+	numNodes, err := parseLength(in)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stream{Nodes: make([]StreamNode, 0, min(numNodes, maxPrealloc))}
+	for range numNodes {
+		key, err := parseString(in)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) != 16 {
+			return nil, errors.New("stream node key is not a stream ID")
+		}
+
+		lp, err := parseString(in)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := listpack.FromBytes([]byte(lp)); err != nil {
+			return nil, err
+		}
+
+		s.Nodes = append(s.Nodes, StreamNode{Key: []byte(key), Listpack: []byte(lp)})
+	}
+
+	if s.Length, err = parseLength(in); err != nil {
+		return nil, err
+	}
+	if s.LastId, err = parseStreamId(in); err != nil {
+		return nil, err
+	}
+
+	if valType >= typeStreamListpacks2 {
+		if s.FirstId, err = parseStreamId(in); err != nil {
+			return nil, err
+		}
+		if s.MaxDeletedId, err = parseStreamId(in); err != nil {
+			return nil, err
+		}
+		if s.EntriesAdded, err = parseLength(in); err != nil {
+			return nil, err
+		}
+	} else {
+		s.EntriesAdded = s.Length
+	}
+
+	numGroups, err := parseLength(in)
+	if err != nil {
+		return nil, err
+	}
+
+	for range numGroups {
+		group, err := parseStreamGroup(in, valType)
+		if err != nil {
+			return nil, err
+		}
+		s.Groups = append(s.Groups, group)
+	}
+
+	return s, nil
+}
+
+func parseStreamGroup(in io.Reader, valType byte) (StreamGroup, error) {
+	var g StreamGroup
+	var err error
+
+	if g.Name, err = parseString(in); err != nil {
+		return g, err
+	}
+	if g.LastId, err = parseStreamId(in); err != nil {
+		return g, err
+	}
+
+	g.EntriesRead = -1
+	if valType >= typeStreamListpacks2 {
+		entriesRead, err := parseLength(in)
+		if err != nil {
+			return g, err
+		}
+		g.EntriesRead = int64(entriesRead)
+	}
+
+	numPending, err := parseLength(in)
+	if err != nil {
+		return g, err
+	}
+
+	pending := make(map[StreamId]bool, min(numPending, maxPrealloc))
+	for range numPending {
+		id, err := parseRawStreamId(in)
+		if err != nil {
+			return g, err
+		}
+
+		deliveryTime, err := parseMillisecondTime(in)
+		if err != nil {
+			return g, err
+		}
+
+		deliveryCount, err := parseLength(in)
+		if err != nil {
+			return g, err
+		}
+
+		g.Pending = append(g.Pending, StreamPendingEntry{ID: id, DeliveryTime: deliveryTime, DeliveryCount: deliveryCount})
+		pending[id] = true
+	}
+
+	numConsumers, err := parseLength(in)
+	if err != nil {
+		return g, err
+	}
+
+	for range numConsumers {
+		var c StreamConsumer
+
+		if c.Name, err = parseString(in); err != nil {
+			return g, err
+		}
+		if c.SeenTime, err = parseMillisecondTime(in); err != nil {
+			return g, err
+		}
+
+		if valType >= typeStreamListpacks3 {
+			activeTime, err := parseInt64(in)
+			if err != nil {
+				return g, err
+			}
+			if activeTime != -1 {
+				c.ActiveTime = time.UnixMilli(activeTime)
+			}
+		} else {
+			c.ActiveTime = c.SeenTime
+		}
+
+		numOwned, err := parseLength(in)
+		if err != nil {
+			return g, err
+		}
+
+		for range numOwned {
+			id, err := parseRawStreamId(in)
+			if err != nil {
+				return g, err
+			}
+			// Consumers only own entries of the group pending entries list.
+			if !pending[id] {
+				return g, errors.New("consumer pending entry missing from the group pending entries list")
+			}
+			c.Pending = append(c.Pending, id)
+		}
+
+		g.Consumers = append(g.Consumers, c)
+	}
+
+	return g, nil
+}
+
+func parseStreamId(in io.Reader) (StreamId, error) {
+	ms, err := parseLength(in)
+	if err != nil {
+		return StreamId{}, err
+	}
+
+	seq, err := parseLength(in)
+	if err != nil {
+		return StreamId{}, err
+	}
+
+	return StreamId{Ms: ms, Seq: seq}, nil
+}
+
+func parseRawStreamId(in io.Reader) (StreamId, error) {
+	raw := make([]byte, 16)
+	if _, err := io.ReadFull(in, raw); err != nil {
+		return StreamId{}, err
+	}
+
+	return StreamId{Ms: binary.BigEndian.Uint64(raw), Seq: binary.BigEndian.Uint64(raw[8:])}, nil
+}
+
+func parseMillisecondTime(in io.Reader) (time.Time, error) {
+	ms, err := parseInt64(in)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.UnixMilli(ms), nil
+}
+
+func parseInt64(in io.Reader) (int64, error) {
+	var v int64
+	err := binary.Read(in, binary.LittleEndian, &v)
+	return v, err
+}
+
+func parseBinaryDouble(in io.Reader) (float64, error) {
+	var bits uint64
+	if err := binary.Read(in, binary.LittleEndian, &bits); err != nil {
+		return 0, err
+	}
+
+	return math.Float64frombits(bits), nil
+}
+
+// parseStringDouble reads a double stored as a length-prefixed string, with
+// special lengths for infinities and NaN.
+func parseStringDouble(in io.Reader) (float64, error) {
+	l, err := parseByte(in)
+	if err != nil {
+		return 0, err
+	}
+
+	switch l {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+
+	buf := make([]byte, l)
+	if _, err := io.ReadFull(in, buf); err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(string(buf), 64)
+}
+
+// skipModuleData reads past the fields saved by a module, up to their EOF
+// opcode. Without the module the fields can not be interpreted, but module
+// aux data is optional and can be dropped.
+func skipModuleData(in io.Reader) error {
+	for {
+		opcode, err := parseLength(in)
+		if err != nil {
+			return err
+		}
+
+		switch opcode {
+		case moduleOpcodeEOF:
+			return nil
+		case moduleOpcodeSInt, moduleOpcodeUInt:
+			_, err = parseLength(in)
+		case moduleOpcodeFloat:
+			_, err = io.ReadFull(in, make([]byte, 4))
+		case moduleOpcodeDouble:
+			_, err = io.ReadFull(in, make([]byte, 8))
+		case moduleOpcodeString:
+			_, err = parseString(in)
+		default:
+			return fmt.Errorf("unknown module opcode %d", opcode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// dumpFooterLen is the size of the footer ending a DUMP payload: the RDB
+// format version on 2 bytes and the CRC64 checksum on 8 bytes.
+const dumpFooterLen = 10
+
+var (
+	ErrDumpPayload = errors.New("DUMP payload version or checksum are wrong")
+	ErrDataFormat  = errors.New("Bad data format")
+)
+
+// Dump serializes obj the way DUMP does: its type and value, as stored in an
+// RDB file, followed by the RDB format version and the CRC64 checksum of
+// everything before it, both little endian.
+func Dump(obj *Object) []byte {
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf)
+	enc.writeByte(objectType(obj))
+	enc.writeObjectPayload(obj)
+	enc.write(binary.LittleEndian.AppendUint16(nil, Version))
+
+	return binary.LittleEndian.AppendUint64(buf.Bytes(), enc.crc)
+}
+
+// Restore decodes a value serialized by Dump, or by any Redis version whose
+// RDB format the loader understands.
+func Restore(payload []byte) (*Object, error) {
+	if len(payload) < dumpFooterLen {
+		return nil, ErrDumpPayload
+	}
+
+	body := payload[:len(payload)-dumpFooterLen]
+	footer := payload[len(payload)-dumpFooterLen:]
+
+	if version := binary.LittleEndian.Uint16(footer); version > maxLoadVersion {
+		return nil, ErrDumpPayload
+	}
+	if crc64Update(0, payload[:len(payload)-8]) != binary.LittleEndian.Uint64(footer[2:]) {
+		return nil, ErrDumpPayload
+	}
+
+	if len(body) == 0 {
+		return nil, ErrDataFormat
+	}
+
+	in := bytes.NewReader(body[1:])
+	obj, err := parseObject(in, body[0])
+	if err != nil || in.Len() > 0 {
+		return nil, ErrDataFormat
+	}
+
+	return obj, nil
+}
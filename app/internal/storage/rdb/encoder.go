@@ -0,0 +1,362 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Version is the RDB format version written by the encoder, the one of Redis
+// 7.4. It is the first to know the hash types with field expiries, which
+// the encoder emits for such hashes.
+const Version = 12
+
+var magic = []byte("REDIS")
+
+// Value types, as stored before every key. The encoder only writes the
+// plain encodings along with stream listpacks, but the loader understands
+// every type written since RDB version 1.
+const (
+	typeString  = 0
+	typeList    = 1
+	typeSet     = 2
+	typeZSet    = 3
+	typeHash    = 4
+	typeZSet2   = 5
+	typeModule  = 6
+	typeModule2 = 7
+
+	typeHashZipmap      = 9
+	typeListZiplist     = 10
+	typeSetIntset       = 11
+	typeZSetZiplist     = 12
+	typeHashZiplist     = 13
+	typeListQuicklist   = 14
+	typeStreamListpacks = 15
+	typeHashListpack    = 16
+	typeZSetListpack    = 17
+	typeListQuicklist2  = 18
+
+	typeStreamListpacks2 = 19
+	typeSetListpack      = 20
+	typeStreamListpacks3 = 21
+
+	// The hash types with field TTLs come from RDB version 12. The pre-GA
+	// variants were written by Redis 7.4 release candidates.
+	typeHashMetadataPreGA   = 22
+	typeHashListpackExPreGA = 23
+	typeHashMetadata        = 24
+	typeHashListpackEx      = 25
+)
+
+// Special string encodings, stored in place of a length after the 0b11
+// prefix.
+const (
+	encodingInt8  = 0
+	encodingInt16 = 1
+	encodingInt32 = 2
+)
+
+// AuxField is a metadata field of an RDB file, such as the server version.
+type AuxField struct {
+	Key   string
+	Value string
+}
+
+// Encoder writes an RDB file, keeping track of the CRC64 checksum of
+// everything written so far. Errors are sticky: once a write fails, later
+// writes are skipped and Err returns the first error.
+type Encoder struct {
+	w   io.Writer
+	crc uint64
+	err error
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+func (e *Encoder) Err() error {
+	return e.err
+}
+
+func (e *Encoder) write(p []byte) {
+	if e.err != nil {
+		return
+	}
+
+	if _, err := e.w.Write(p); err != nil {
+		e.err = err
+		return
+	}
+
+	e.crc = crc64Update(e.crc, p)
+}
+
+func (e *Encoder) writeByte(b byte) {
+	e.write([]byte{b})
+}
+
+// WriteHeader writes the magic string, the format version and the aux
+// fields.
+func (e *Encoder) WriteHeader(fields []AuxField) {
+	e.write(magic)
+	e.write([]byte(fmt.Sprintf("%04d", Version)))
+
+	for _, field := range fields {
+		e.writeByte(aux)
+		e.writeString(field.Key)
+		e.writeString(field.Value)
+	}
+}
+
+// WriteDatabase writes the entries of database db, preceded by the number
+// of keys and of keys with an expiry, so that a loader can size its tables.
+func (e *Encoder) WriteDatabase(db int, entries []Entry) {
+	expires := 0
+	for _, entry := range entries {
+		if entry.ExpiresAt != nil {
+			expires++
+		}
+	}
+
+	e.writeByte(selectDB)
+	e.writeLength(uint64(db))
+	e.writeByte(resizeDB)
+	e.writeLength(uint64(len(entries)))
+	e.writeLength(uint64(expires))
+
+	for _, entry := range entries {
+		e.WriteEntry(entry)
+	}
+}
+
+// WriteEntry writes a key along with its expiry and value.
+func (e *Encoder) WriteEntry(entry Entry) {
+	if entry.ExpiresAt != nil {
+		e.writeByte(expireTimeMillis)
+		e.writeMillisecondTime(*entry.ExpiresAt)
+	}
+
+	e.writeByte(objectType(entry.Object))
+	e.writeString(entry.Key)
+	e.writeObjectPayload(entry.Object)
+}
+
+// WriteEOF ends the file with the EOF opcode and the checksum of everything
+// written before it. Without checksum, 0 is written in its place, which
+// loaders take as a checksum to skip.
+func (e *Encoder) WriteEOF(checksum bool) {
+	e.writeByte(eof)
+
+	raw := make([]byte, 8)
+	if checksum {
+		binary.LittleEndian.PutUint64(raw, e.crc)
+	}
+	e.write(raw)
+}
+
+func objectType(obj *Object) byte {
+	switch obj.Type {
+	case HashObject:
+		for _, field := range obj.Hash {
+			if field.ExpiresAt != nil {
+				return typeHashMetadata
+			}
+		}
+		return typeHash
+	case ListObject:
+		return typeList
+	case SetObject:
+		return typeSet
+	case ZSetObject:
+		return typeZSet2
+	case StreamObject:
+		return typeStreamListpacks3
+	default:
+		return typeString
+	}
+}
+
+func (e *Encoder) writeObjectPayload(obj *Object) {
+	switch objectType(obj) {
+	case typeList:
+		e.writeLength(uint64(len(obj.List)))
+		for _, elem := range obj.List {
+			e.writeString(elem)
+		}
+	case typeSet:
+		e.writeLength(uint64(len(obj.Set)))
+		for _, member := range obj.Set {
+			e.writeString(member)
+		}
+	case typeZSet2:
+		e.writeLength(uint64(len(obj.ZSet)))
+		for _, member := range obj.ZSet {
+			e.writeString(member.Member)
+			e.writeInt64(int64(math.Float64bits(member.Score)))
+		}
+	case typeHash:
+		e.writeLength(uint64(len(obj.Hash)))
+		for _, field := range obj.Hash {
+			e.writeString(field.Field)
+			e.writeString(field.Value)
+		}
+	case typeHashMetadata:
+		e.writeHashMetadata(obj.Hash)
+	case typeStreamListpacks3:
+		e.writeStream(obj.Stream)
+	default:
+		e.writeString(obj.String)
+	}
+}
+
+// writeHashMetadata writes a hash with field TTLs. The TTLs are stored
+// relative to the earliest one, plus one so that 0 means no TTL.
+func (e *Encoder) writeHashMetadata(fields []HashField) {
+	var minExpire int64 = math.MaxInt64
+	for _, field := range fields {
+		if field.ExpiresAt != nil {
+			minExpire = min(minExpire, field.ExpiresAt.UnixMilli())
+		}
+	}
+
+	e.writeInt64(minExpire)
+	e.writeLength(uint64(len(fields)))
+
+	for _, field := range fields {
+		var ttl uint64
+		if field.ExpiresAt != nil {
+			ttl = uint64(field.ExpiresAt.UnixMilli()-minExpire) + 1
+		}
+
+		e.writeLength(ttl)
+		e.writeString(field.Field)
+		e.writeString(field.Value)
+	}
+}
+
+func (e *Encoder) writeStream(s *Stream) {
+	e.writeLength(uint64(len(s.Nodes)))
+	for _, node := range s.Nodes {
+		e.writeRawString(node.Key)
+		e.writeRawString(node.Listpack)
+	}
+
+	e.writeLength(s.Length)
+	e.writeStreamId(s.LastId)
+	e.writeStreamId(s.FirstId)
+	e.writeStreamId(s.MaxDeletedId)
+	e.writeLength(s.EntriesAdded)
+
+	e.writeLength(uint64(len(s.Groups)))
+	for _, group := range s.Groups {
+		e.writeString(group.Name)
+		e.writeStreamId(group.LastId)
+		e.writeLength(uint64(group.EntriesRead))
+
+		e.writeLength(uint64(len(group.Pending)))
+		for _, pending := range group.Pending {
+			e.writeRawStreamId(pending.ID)
+			e.writeMillisecondTime(pending.DeliveryTime)
+			e.writeLength(pending.DeliveryCount)
+		}
+
+		e.writeLength(uint64(len(group.Consumers)))
+		for _, consumer := range group.Consumers {
+			e.writeString(consumer.Name)
+			e.writeMillisecondTime(consumer.SeenTime)
+			if consumer.ActiveTime.IsZero() {
+				e.writeInt64(-1)
+			} else {
+				e.writeMillisecondTime(consumer.ActiveTime)
+			}
+
+			e.writeLength(uint64(len(consumer.Pending)))
+			for _, id := range consumer.Pending {
+				e.writeRawStreamId(id)
+			}
+		}
+	}
+}
+
+func (e *Encoder) writeStreamId(id StreamId) {
+	e.writeLength(id.Ms)
+	e.writeLength(id.Seq)
+}
+
+// writeRawStreamId writes an ID as 16 big endian bytes, without a length
+// prefix.
+func (e *Encoder) writeRawStreamId(id StreamId) {
+	raw := make([]byte, 16)
+	binary.BigEndian.PutUint64(raw, id.Ms)
+	binary.BigEndian.PutUint64(raw[8:], id.Seq)
+	e.write(raw)
+}
+
+func (e *Encoder) writeMillisecondTime(t time.Time) {
+	e.writeInt64(t.UnixMilli())
+}
+
+func (e *Encoder) writeInt64(v int64) {
+	raw := make([]byte, 8)
+	binary.LittleEndian.PutUint64(raw, uint64(v))
+	e.write(raw)
+}
+
+// writeLength writes a length in the shortest of the 6, 14, 32 and 64-bit
+// forms.
+func (e *Encoder) writeLength(l uint64) {
+	switch {
+	case l < 1<<6:
+		e.writeByte(byte(l))
+	case l < 1<<14:
+		e.write([]byte{0x40 | byte(l>>8), byte(l)})
+	case l <= math.MaxUint32:
+		raw := make([]byte, 5)
+		raw[0] = 0x80
+		binary.BigEndian.PutUint32(raw[1:], uint32(l))
+		e.write(raw)
+	default:
+		raw := make([]byte, 9)
+		raw[0] = 0x81
+		binary.BigEndian.PutUint64(raw[1:], l)
+		e.write(raw)
+	}
+}
+
+// writeString writes s as an integer if it is the canonical representation
+// of one that fits in 32 bits, and as a length-prefixed string otherwise.
+func (e *Encoder) writeString(s string) {
+	if len(s) <= 11 {
+		if v, err := strconv.ParseInt(s, 10, 32); err == nil && strconv.FormatInt(v, 10) == s {
+			e.writeInt(v)
+			return
+		}
+	}
+
+	e.writeRawString([]byte(s))
+}
+
+func (e *Encoder) writeInt(v int64) {
+	switch {
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		e.write([]byte{0xC0 | encodingInt8, byte(v)})
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		raw := []byte{0xC0 | encodingInt16, 0, 0}
+		binary.LittleEndian.PutUint16(raw[1:], uint16(v))
+		e.write(raw)
+	default:
+		raw := []byte{0xC0 | encodingInt32, 0, 0, 0, 0}
+		binary.LittleEndian.PutUint32(raw[1:], uint32(v))
+		e.write(raw)
+	}
+}
+
+func (e *Encoder) writeRawString(b []byte) {
+	e.writeLength(uint64(len(b)))
+	e.write(b)
+}
@@ -0,0 +1,648 @@
+//go:build ignore
+
+// gen_testdata writes the RDB fixtures at the top level of testdata. They
+// are laid out the way rdb.c, listpack.c and lzf_c.c of Redis 7.2 and 7.4
+// save the same keys, but are assembled here independently of the encoder
+// of this package, so that the tests do not check it against itself.
+//
+// Run it with go generate.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const out = "testdata"
+
+// Object types, as numbered by rdb.h.
+const (
+	typeString         = 0
+	typeSet            = 2
+	typeHash           = 4
+	typeZSet2          = 5
+	typeSetIntset      = 11
+	typeHashListpack   = 16
+	typeZSetListpack   = 17
+	typeListQuicklist2 = 18
+	typeSetListpack    = 20
+	typeStreamListpks3 = 21
+	typeHashMetadata   = 24
+	typeHashListpackEx = 25
+)
+
+func main() {
+	medium := lcgBytes(100, 1, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789")
+	large := lcgBytes(20000, 2, "")
+
+	// Integer, LZF and 6, 14 and 32-bit length encodings, expiries in
+	// milliseconds.
+	write("strings.rdb", rdbFile(11, "7.2.4", []key{
+		{"int8", typeString, str("-100"), nil},
+		{"int16", typeString, str("30000"), nil},
+		{"int32", typeString, str("-2000000000"), nil},
+		{"int64", typeString, str("9223372036854775807"), nil},
+		{"12345", typeString, str("integer key"), nil},
+		{"short", typeString, str("hello"), nil},
+		{"medium", typeString, str(medium), nil},
+		{"large", typeString, str(large), nil},
+		{"compressible", typeString, str(strings.Repeat("a", 200)), nil},
+		{"expires_ms", typeString, str("bar"), expire(4102444800123)},
+		{"expired_ms", typeString, str("baz"), expire(1000000000000)},
+	}))
+
+	// Quicklists of a single listpack node, holding every integer width,
+	// and large enough to be compressed with LZF.
+	listSmall := []any{"a", "bb", "12", "-5", "1000", "-70000", "2147483648", "9223372036854775807", strings.Repeat("c", 70)}
+	listBig := make([]any, 100)
+	for i := range listBig {
+		listBig[i] = fmt.Sprintf("element-%d", i)
+	}
+	write("lists.rdb", rdbFile(11, "7.2.4", []key{
+		{"list", typeListQuicklist2, cat(length(1), length(2), str(listpack(listSmall))), nil},
+		{"list_compressed", typeListQuicklist2, cat(length(1), length(2), str(listpack(listBig))), nil},
+	}))
+
+	// Intsets of the three widths, a listpack set and a hash table set.
+	setBig := make([][]byte, 0, 130)
+	for i := range 130 {
+		setBig = append(setBig, str(fmt.Sprintf("member-%03d", i)))
+	}
+	write("sets.rdb", rdbFile(11, "7.2.4", []key{
+		{"intset_16", typeSetIntset, str(intset(-3, 7, 32766)), nil},
+		{"intset_32", typeSetIntset, str(intset(1, 2147418110, -2147418110)), nil},
+		{"intset_64", typeSetIntset, str(intset(0, 9223090557583032318, -9223090557583032318)), nil},
+		{"set_listpack", typeSetListpack, str(listpack([]any{"alpha", "beta", "42"})), nil},
+		{"set", typeSet, cat(append([][]byte{length(uint64(len(setBig)))}, setBig...)...), nil},
+	}))
+
+	// Listpack and hash table hashes, listpack and skiplist sorted sets.
+	longValue := strings.Repeat("v", 100)
+	write("hashes_zsets.rdb", rdbFile(11, "7.2.4", []key{
+		{"hash", typeHashListpack, str(listpack([]any{"name", "redis", "version", "7", "ratio", "-1.5"})), nil},
+		{"hash_table", typeHash, cat(length(2), str("short"), str("1"), str("long"), str(longValue)), nil},
+		{"zset", typeZSetListpack, str(listpack([]any{"c", "-3.25", "a", "1", "b", "2.5"})), nil},
+		{"zset_skiplist", typeZSet2, cat(length(2), str(strings.Repeat("m", 70)), float(10.5), str("low"), float(-1)), nil},
+	}))
+
+	write("stream.rdb", rdbFile(11, "7.2.4", []key{
+		{"sensor", typeStreamListpks3, sensorStream(), nil},
+		{"small", typeStreamListpks3, smallStream(), nil},
+	}))
+
+	// Hashes with field TTLs, as Redis 7.4 saves them in RDB version 12.
+	const e1, e2 = 4102444800000, 4102444801500
+	write("hash_ttl.rdb", rdbFile(12, "7.4.0", []key{
+		{"hash_lpex", typeHashListpackEx, cat(millis(e1), str(listpack([]any{"f1", "v1", int64(e1), "f2", "v2", int64(e2), "f3", "v3", 0}))), nil},
+		{"hash_meta", typeHashMetadata, cat(millis(e1), length(3),
+			length(e2-e1+1), str("a"), str("1"),
+			length(0), str("b"), str(longValue),
+			length(1), str("c"), str("3")), nil},
+	}))
+
+	// strings.rdb with the last byte of its checksum flipped.
+	corrupt, err := os.ReadFile(filepath.Join(out, "strings.rdb"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	corrupt[len(corrupt)-1] ^= 0xFF
+	write("corrupt_crc.rdb", corrupt)
+
+	// A version 3 file, from the versions of Redis that stored expiries in
+	// seconds and saved no checksum.
+	write("expire_seconds.rdb", cat([]byte("REDIS0003"), []byte{0xFE, 0x00, 0xFD}, le(int32(2000000000)),
+		[]byte{typeString}, str("expires_s"), str("old"), []byte{0xFF}))
+}
+
+// sensorStream returns a stream of two nodes, without deleted entries, and
+// a consumer group with pending entries. Its millisecond IDs need 64-bit
+// lengths.
+func sensorStream() []byte {
+	const t = 1700000000000
+	node1 := []streamEntry{
+		{t, 0, [][2]string{{"temp", "20"}, {"hum", "40"}}},
+		{t, 1, [][2]string{{"temp", "21"}, {"hum", "41"}}},
+		{t + 5, 0, [][2]string{{"temp", "22"}, {"wind", "3"}}},
+	}
+	node2 := []streamEntry{
+		{t + 10, 0, [][2]string{{"temp", "23"}, {"hum", "43"}}},
+	}
+
+	const delivery = t + 60000
+	return cat(
+		length(2),
+		str(streamId(t, 0)), str(streamNode(node1)),
+		str(streamId(t+10, 0)), str(streamNode(node2)),
+		// The length, the last and first IDs, the max deleted entry ID,
+		// and the number of entries added.
+		length(4),
+		length(t+10), length(0),
+		length(t), length(0),
+		length(0), length(0),
+		length(4),
+		// The group, its last delivered ID, entries read and PEL.
+		length(1),
+		str("readers"), length(t+5), length(0), length(3),
+		length(2),
+		streamId(t, 1), millis(delivery), length(1),
+		streamId(t+5, 0), millis(delivery+1), length(2),
+		// The consumers, with their seen and active times and PELs.
+		length(2),
+		str("alice"), millis(delivery+2), millis(delivery+1), length(2),
+		streamId(t, 1), streamId(t+5, 0),
+		str("bob"), millis(delivery+3), millis(-1), length(0),
+	)
+}
+
+// smallStream returns a stream with 32-bit IDs and no group.
+func smallStream() []byte {
+	return cat(
+		length(1),
+		str(streamId(100000, 7)), str(streamNode([]streamEntry{{100000, 7, [][2]string{{"f", "v"}}}})),
+		length(1),
+		length(100000), length(7),
+		length(100000), length(7),
+		length(0), length(0),
+		length(1),
+		length(0),
+	)
+}
+
+type key struct {
+	name     string
+	typ      byte
+	value    []byte
+	expireAt *int64
+}
+
+func expire(ms int64) *int64 {
+	return &ms
+}
+
+func rdbFile(version int, redisVer string, keys []key) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "REDIS%04d", version)
+	for _, field := range [][2]string{
+		{"redis-ver", redisVer},
+		{"redis-bits", "64"},
+		{"ctime", "1718000000"},
+		{"used-mem", "1000000"},
+		{"repl-stream-db", "0"},
+		{"repl-id", "5a1fb1ae1ef4b0c1d0df8ef5e4e4c1fcb1a5bbfd"},
+		{"repl-offset", "0"},
+		{"aof-base", "0"},
+	} {
+		b.WriteByte(0xFA)
+		b.Write(str(field[0]))
+		b.Write(str(field[1]))
+	}
+
+	b.Write([]byte{0xFE, 0x00})
+	expires := 0
+	for _, k := range keys {
+		if k.expireAt != nil {
+			expires++
+		}
+	}
+	b.WriteByte(0xFB)
+	b.Write(length(uint64(len(keys))))
+	b.Write(length(uint64(expires)))
+
+	for _, k := range keys {
+		if k.expireAt != nil {
+			b.WriteByte(0xFC)
+			b.Write(millis(*k.expireAt))
+		}
+		b.WriteByte(k.typ)
+		b.Write(str(k.name))
+		b.Write(k.value)
+	}
+
+	b.WriteByte(0xFF)
+	b.Write(le(crc64(b.Bytes())))
+
+	return b.Bytes()
+}
+
+func write(name string, data []byte) {
+	if err := os.WriteFile(filepath.Join(out, name), data, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func le(v any) []byte {
+	var b bytes.Buffer
+	if err := binary.Write(&b, binary.LittleEndian, v); err != nil {
+		log.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func millis(ms int64) []byte {
+	return le(ms)
+}
+
+func float(f float64) []byte {
+	return le(math.Float64bits(f))
+}
+
+// lcgBytes returns the high byte of each step of a 64-bit LCG, mapped onto
+// alphabet unless it is empty.
+func lcgBytes(n int, seed uint64, alphabet string) string {
+	b := make([]byte, n)
+	x := seed
+	for i := range b {
+		x = x*6364136223846793005 + 1442695040888963407
+		b[i] = byte(x >> 56)
+		if alphabet != "" {
+			b[i] = alphabet[int(b[i])%len(alphabet)]
+		}
+	}
+	return string(b)
+}
+
+// length encodes n as rdbSaveLen does.
+func length(n uint64) []byte {
+	switch {
+	case n < 1<<6:
+		return []byte{byte(n)}
+	case n < 1<<14:
+		return []byte{0x40 | byte(n>>8), byte(n)}
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32([]byte{0x80}, uint32(n))
+	default:
+		return binary.BigEndian.AppendUint64([]byte{0x81}, n)
+	}
+}
+
+// str encodes s as rdbSaveRawString does: as an integer if it is one of at
+// most 11 characters, compressed with LZF if longer than 20 characters and
+// compressible, or as is.
+func str[T string | []byte](val T) []byte {
+	s := string(val)
+	if len(s) <= 11 {
+		if v, ok := string2ll(s); ok {
+			switch {
+			case v >= math.MinInt8 && v <= math.MaxInt8:
+				return cat([]byte{0xC0}, le(int8(v)))
+			case v >= math.MinInt16 && v <= math.MaxInt16:
+				return cat([]byte{0xC1}, le(int16(v)))
+			case v >= math.MinInt32 && v <= math.MaxInt32:
+				return cat([]byte{0xC2}, le(int32(v)))
+			}
+		}
+	}
+
+	if len(s) > 20 {
+		if comp := lzfCompress([]byte(s), len(s)-4); comp != nil {
+			return cat([]byte{0xC3}, length(uint64(len(comp))), length(uint64(len(s))), comp)
+		}
+	}
+
+	return cat(length(uint64(len(s))), []byte(s))
+}
+
+// string2ll parses s if it is the canonical decimal form of a 64-bit
+// integer, as string2ll of util.c does.
+func string2ll(s string) (int64, bool) {
+	if s == "0" {
+		return 0, true
+	}
+	digits := strings.TrimPrefix(s, "-")
+	if digits == "" || digits[0] < '1' || digits[0] > '9' {
+		return 0, false
+	}
+	for _, c := range []byte(digits) {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+	}
+	v, err := strconv.ParseInt(s, 10, 64)
+	return v, err == nil
+}
+
+// listpack encodes entries, which are strings or integers, as listpack.c
+// does. Strings holding an integer are stored as one.
+func listpack(entries []any) []byte {
+	var body []byte
+	for _, e := range entries {
+		var enc []byte
+		switch e := e.(type) {
+		case int:
+			enc = listpackInt(int64(e))
+		case int64:
+			enc = listpackInt(e)
+		case string:
+			if v, ok := string2ll(e); ok {
+				enc = listpackInt(v)
+			} else {
+				enc = listpackString(e)
+			}
+		}
+		body = append(body, enc...)
+		body = append(body, listpackBacklen(len(enc))...)
+	}
+
+	b := le(uint32(6 + len(body) + 1))
+	b = append(b, le(uint16(min(len(entries), math.MaxUint16)))...)
+	b = append(b, body...)
+	return append(b, 0xFF)
+}
+
+func listpackInt(v int64) []byte {
+	switch {
+	case v >= 0 && v <= 127:
+		return []byte{byte(v)}
+	case v >= -4096 && v <= 4095:
+		u := uint64(v) & (1<<13 - 1)
+		return []byte{byte(u>>8) | 0xC0, byte(u)}
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		return cat([]byte{0xF1}, le(int16(v)))
+	case v >= -1<<23 && v < 1<<23:
+		return cat([]byte{0xF2}, le(int32(v))[:3])
+	case v >= math.MinInt32 && v <= math.MaxInt32:
+		return cat([]byte{0xF3}, le(int32(v)))
+	default:
+		return cat([]byte{0xF4}, le(v))
+	}
+}
+
+func listpackString(s string) []byte {
+	switch l := len(s); {
+	case l < 64:
+		return cat([]byte{0x80 | byte(l)}, []byte(s))
+	case l < 4096:
+		return cat([]byte{0xE0 | byte(l>>8), byte(l)}, []byte(s))
+	default:
+		return cat([]byte{0xF0}, le(uint32(l)), []byte(s))
+	}
+}
+
+func listpackBacklen(l int) []byte {
+	switch {
+	case l <= 127:
+		return []byte{byte(l)}
+	case l < 16383:
+		return []byte{byte(l >> 7), byte(l&127) | 128}
+	default:
+		return []byte{byte(l >> 14), byte(l>>7&127) | 128, byte(l&127) | 128}
+	}
+}
+
+// intset encodes members with the narrowest width that holds all of them.
+func intset(members ...int64) []byte {
+	slices.Sort(members)
+
+	width := 2
+	for _, m := range members {
+		if m < math.MinInt16 || m > math.MaxInt16 {
+			width = max(width, 4)
+		}
+		if m < math.MinInt32 || m > math.MaxInt32 {
+			width = 8
+		}
+	}
+
+	b := cat(le(uint32(width)), le(uint32(len(members))))
+	for _, m := range members {
+		switch width {
+		case 2:
+			b = append(b, le(int16(m))...)
+		case 4:
+			b = append(b, le(int32(m))...)
+		default:
+			b = append(b, le(m)...)
+		}
+	}
+	return b
+}
+
+type streamEntry struct {
+	ms, seq int64
+	fields  [][2]string
+}
+
+func streamId(ms, seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(binary.BigEndian.AppendUint64(nil, ms), seq)
+}
+
+// streamNode encodes entries as a node listpack of t_stream.c, whose master
+// entry holds the fields of the first entry.
+func streamNode(entries []streamEntry) []byte {
+	master := entries[0]
+	masterFields := make([]any, 0, len(master.fields))
+	for _, f := range master.fields {
+		masterFields = append(masterFields, f[0])
+	}
+
+	lp := []any{len(entries), 0, len(masterFields)}
+	lp = append(lp, masterFields...)
+	lp = append(lp, 0)
+
+	for _, e := range entries {
+		same := len(e.fields) == len(masterFields)
+		for i, f := range e.fields {
+			same = same && i < len(masterFields) && f[0] == masterFields[i]
+		}
+
+		flags := 0
+		if same {
+			flags = 2
+		}
+		lp = append(lp, flags, e.ms-master.ms, e.seq-master.seq)
+
+		if same {
+			for _, f := range e.fields {
+				lp = append(lp, f[1])
+			}
+			lp = append(lp, len(e.fields)+3)
+		} else {
+			lp = append(lp, len(e.fields))
+			for _, f := range e.fields {
+				lp = append(lp, f[0], f[1])
+			}
+			lp = append(lp, len(e.fields)*2+4)
+		}
+	}
+
+	return listpack(lp)
+}
+
+var crcTable = func() [256]uint64 {
+	var table [256]uint64
+	for i := range table {
+		c := uint64(i)
+		for range 8 {
+			if c&1 != 0 {
+				c = c>>1 ^ 0x95AC9329AC4BC9B5
+			} else {
+				c >>= 1
+			}
+		}
+		table[i] = c
+	}
+	return table
+}()
+
+// crc64 is the Jones CRC64 of crc64.c.
+func crc64(data []byte) uint64 {
+	var crc uint64
+	for _, b := range data {
+		crc = crcTable[byte(crc)^b] ^ crc>>8
+	}
+	return crc
+}
+
+// lzfCompress is lzf_compress of lzf_c.c, as built by Redis with a 16-bit
+// hash table in VERY_FAST mode. It returns nil if the output would not fit
+// in outLen bytes.
+func lzfCompress(in []byte, outLen int) []byte {
+	const (
+		hlog   = 16
+		hsize  = 1 << hlog
+		maxLit = 1 << 5
+		maxOff = 1 << 13
+		maxRef = 1<<8 + 1<<3
+	)
+	idx := func(h uint32) int {
+		return int((h>>(3*8-hlog) - h*5) & (hsize - 1))
+	}
+
+	// htab holds offsets into in, 0 being no match, as a reference must
+	// come after the start of the input.
+	htab := make([]int, hsize)
+	out := make([]byte, outLen+1+64)
+	inEnd := len(in)
+	ip, op, lit := 0, 1, 0
+	hval := uint32(in[0])<<8 | uint32(in[1])
+
+	for ip < inEnd-2 {
+		hval = hval<<8 | uint32(in[ip+2])
+		slot := idx(hval)
+		ref := htab[slot]
+		htab[slot] = ip
+		off := ip - ref - 1
+
+		if off < maxOff && ref > 0 && ref < ip &&
+			in[ref+2] == in[ip+2] && in[ref] == in[ip] && in[ref+1] == in[ip+1] {
+			l := 2
+			maxLen := min(inEnd-ip-l, maxRef)
+
+			if op+3+1 >= outLen {
+				back := 1
+				if lit > 0 {
+					back = 0
+				}
+				if op-back+3+1 >= outLen {
+					return nil
+				}
+			}
+
+			out[op-lit-1] = byte(lit - 1)
+			if lit == 0 {
+				op--
+			}
+
+			broke := false
+			if maxLen > 16 {
+				for range 16 {
+					l++
+					if in[ref+l] != in[ip+l] {
+						broke = true
+						break
+					}
+				}
+			}
+			if !broke {
+				for {
+					l++
+					if l >= maxLen || in[ref+l] != in[ip+l] {
+						break
+					}
+				}
+			}
+
+			l -= 2
+			ip++
+
+			if l < 7 {
+				out[op] = byte(off>>8 + l<<5)
+				op++
+			} else {
+				out[op] = byte(off>>8 + 7<<5)
+				out[op+1] = byte(l - 7)
+				op += 2
+			}
+			out[op] = byte(off)
+			op++
+
+			lit = 0
+			op++
+
+			ip += l + 1
+			if ip >= inEnd-2 {
+				break
+			}
+
+			ip -= 2
+			hval = uint32(in[ip])<<8 | uint32(in[ip+1])
+			hval = hval<<8 | uint32(in[ip+2])
+			htab[idx(hval)] = ip
+			ip++
+			hval = hval<<8 | uint32(in[ip+2])
+			htab[idx(hval)] = ip
+			ip++
+		} else {
+			if op >= outLen {
+				return nil
+			}
+
+			lit++
+			out[op] = in[ip]
+			op++
+			ip++
+
+			if lit == maxLit {
+				out[op-lit-1] = byte(lit - 1)
+				lit = 0
+				op++
+			}
+		}
+	}
+
+	if op+3 > outLen {
+		return nil
+	}
+
+	for ip < inEnd {
+		lit++
+		out[op] = in[ip]
+		op++
+		ip++
+
+		if lit == maxLit {
+			out[op-lit-1] = byte(lit - 1)
+			lit = 0
+			op++
+		}
+	}
+
+	out[op-lit-1] = byte(lit - 1)
+	if lit == 0 {
+		op--
+	}
+
+	return out[:op]
+}
@@ -0,0 +1,40 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+var errCorruptIntset = errors.New("corrupt intset")
+
+// intsetMembers decodes an intset: the width of its integers (2, 4 or 8
+// bytes), their number and the sorted integers themselves, all little
+// endian.
+func intsetMembers(b []byte) ([]string, error) {
+	if len(b) < 8 {
+		return nil, errCorruptIntset
+	}
+
+	width := int(binary.LittleEndian.Uint32(b))
+	n := int(binary.LittleEndian.Uint32(b[4:]))
+	if (width != 2 && width != 4 && width != 8) || len(b) != 8+n*width {
+		return nil, errCorruptIntset
+	}
+
+	members := make([]string, 0, n)
+	for p := 8; p < len(b); p += width {
+		var v int64
+		switch width {
+		case 2:
+			v = int64(int16(binary.LittleEndian.Uint16(b[p:])))
+		case 4:
+			v = int64(int32(binary.LittleEndian.Uint32(b[p:])))
+		default:
+			v = int64(binary.LittleEndian.Uint64(b[p:]))
+		}
+		members = append(members, strconv.FormatInt(v, 10))
+	}
+
+	return members, nil
+}
@@ -0,0 +1,61 @@
+package rdb
+
+import "errors"
+
+var errCorruptLZF = errors.New("corrupt LZF compressed string")
+
+// lzfDecompress expands data compressed with LZF, which Redis uses for long
+// strings when rdbcompression is enabled. Every chunk starts with a control
+// byte: values below 32 announce a run of ctrl+1 literal bytes, while larger
+// ones are back references whose length is stored in the top 3 bits (with
+// an extra byte when they are all set) and whose offset in the low 5 bits
+// and the next byte.
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	out := make([]byte, 0, min(outLen, len(in)*4))
+
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+
+		if ctrl < 1<<5 {
+			n := ctrl + 1
+			if i+n > len(in) || len(out)+n > outLen {
+				return nil, errCorruptLZF
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, errCorruptLZF
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errCorruptLZF
+		}
+
+		ref := len(out) - (ctrl&0x1F)<<8 - int(in[i]) - 1
+		i++
+		n += 2
+
+		if ref < 0 || len(out)+n > outLen {
+			return nil, errCorruptLZF
+		}
+		// References may overlap the bytes they produce, so they are copied
+		// one byte at a time.
+		for j := 0; j < n; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+
+	if len(out) != outLen {
+		return nil, errCorruptLZF
+	}
+
+	return out, nil
+}
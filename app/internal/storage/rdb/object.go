@@ -0,0 +1,99 @@
+package rdb
+
+import "time"
+
+// ObjectType is the kind of value held by an Object.
+type ObjectType int
+
+const (
+	StringObject ObjectType = iota
+	ListObject
+	SetObject
+	HashObject
+	ZSetObject
+	StreamObject
+)
+
+// Object is a value of the keyspace as stored in RDB files, independent of
+// how the server represents it in memory.
+type Object struct {
+	Type   ObjectType
+	String string
+	List   []string
+	Set    []string
+	Hash   []HashField
+	ZSet   []ZSetMember
+	Stream *Stream
+}
+
+// Entry is a key of a database along with its value and expiry.
+type Entry struct {
+	Key       string
+	ExpiresAt *time.Time
+	Object    *Object
+}
+
+// HashField is a field of a hash, which may expire on its own.
+type HashField struct {
+	Field     string
+	Value     string
+	ExpiresAt *time.Time
+}
+
+// ZSetMember is a member of a sorted set along with its score.
+type ZSetMember struct {
+	Member string
+	Score  float64
+}
+
+// StreamId is a stream entry ID.
+type StreamId struct {
+	Ms  uint64
+	Seq uint64
+}
+
+// Stream holds a stream in the layout Redis uses: listpack nodes indexed by
+// the ID of their master entry, plus the stream metadata and its consumer
+// groups.
+type Stream struct {
+	Nodes        []StreamNode
+	Length       uint64
+	LastId       StreamId
+	FirstId      StreamId
+	MaxDeletedId StreamId
+	EntriesAdded uint64
+	Groups       []StreamGroup
+}
+
+// StreamNode is a serialized listpack along with the 128-bit big endian
+// encoding of its master ID.
+type StreamNode struct {
+	Key      []byte
+	Listpack []byte
+}
+
+type StreamGroup struct {
+	Name   string
+	LastId StreamId
+	// EntriesRead is -1 when the number of entries read is unknown.
+	EntriesRead int64
+	// Pending is the pending entries list of the group, ordered by ID.
+	Pending   []StreamPendingEntry
+	Consumers []StreamConsumer
+}
+
+type StreamPendingEntry struct {
+	ID            StreamId
+	DeliveryTime  time.Time
+	DeliveryCount uint64
+}
+
+type StreamConsumer struct {
+	Name     string
+	SeenTime time.Time
+	// ActiveTime is the zero time if the consumer never read an entry.
+	ActiveTime time.Time
+	// Pending lists the IDs of the group pending entries owned by the
+	// consumer, ordered by ID.
+	Pending []StreamId
+}
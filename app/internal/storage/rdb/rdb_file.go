@@ -1,14 +1,15 @@
 package rdb
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"strconv"
-	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -19,13 +20,14 @@ const (
 	expireTimeMillis = 0xFC
 	resizeDB         = 0xFB
 	aux              = 0xFA
+	freq             = 0xF9
+	idle             = 0xF8
+	moduleAux        = 0xF7
+	functionPreGA    = 0xF6
+	function2        = 0xF5
+	slotInfo         = 0xF4
 )
 
-type value struct {
-	Val string
-	Exp *time.Time
-}
-
 type info struct {
 	MagicNumber [5]byte
 	Version     [4]byte
@@ -34,47 +36,175 @@ type info struct {
 type RDBFile struct {
 	Dir        string
 	DBFilename string
-	DBs        []*RDBDatabase
 	info       info
 	auxiliary  map[string]string
-}
-
-type RDBDatabase struct {
-	Data map[string]value
-	mu   *sync.Mutex
+	// loaded and total track the progress of Load, in bytes.
+	loaded atomic.Int64
+	total  atomic.Int64
 }
 
 func NewRDBFile(dir, filename string) *RDBFile {
 	return &RDBFile{
 		Dir:        dir,
 		DBFilename: filename,
-		DBs:        make([]*RDBDatabase, 0),
 		auxiliary:  make(map[string]string),
 	}
 
 }
 
-func (s *RDBFile) Load() error {
-	file, err := os.ReadFile(filepath.Join(s.Dir, s.DBFilename))
+// maxLoadVersion is the most recent RDB format version the loader
+// understands.
+const maxLoadVersion = Version
+
+// CorruptError reports a malformed RDB file, along with the byte offset of
+// the record that could not be read.
+type CorruptError struct {
+	Offset int64
+	Err    error
+}
+
+func (e *CorruptError) Error() string {
+	return fmt.Sprintf("corrupt file at byte %d: %v", e.Offset, e.Err)
+}
+
+func (e *CorruptError) Unwrap() error {
+	return e.Err
+}
+
+// EntryFunc receives every key of an RDB file as soon as it is decoded,
+// along with the index of its database.
+type EntryFunc func(db int, entry Entry) error
+
+// loadReader reads a file through a buffer, keeping track of the offset
+// reached and of the CRC64 of everything read so far.
+type loadReader struct {
+	r      *bufio.Reader
+	offset int64
+	crc    uint64
+	loaded *atomic.Int64
+}
+
+func (r *loadReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.crc = crc64Update(r.crc, p[:n])
+	r.offset += int64(n)
+	r.loaded.Store(r.offset)
+	return n, err
+}
+
+// Load streams the RDB file through fn, so that the file is never held in
+// memory as a whole. Errors returned by fn stop the load. The CRC64
+// checksum ending the file is verified unless verifyChecksum is false, or
+// the file was saved without one.
+func (s *RDBFile) Load(verifyChecksum bool, fn EntryFunc) error {
+	file, err := os.Open(s.Path())
 	if err != nil {
 		return err
 	}
+	defer file.Close()
 
-	in := bytes.NewReader(file)
-	err = binary.Read(in, binary.BigEndian, &s.info)
-
+	stat, err := file.Stat()
 	if err != nil {
 		return err
 	}
+	s.total.Store(stat.Size())
+	s.loaded.Store(0)
+
+	in := &loadReader{r: bufio.NewReaderSize(file, 1<<16), loaded: &s.loaded}
+	if err := s.loadHeader(in); err != nil {
+		return &CorruptError{Offset: 0, Err: err}
+	}
+
+	var offset int64
+	if err := s.loadRecords(in, &offset, fn); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return &CorruptError{Offset: offset, Err: err}
+	}
+
+	return s.checkChecksum(in, verifyChecksum)
+}
+
+// LoadProgress returns the number of bytes read by Load so far, along with
+// the size of the file.
+func (s *RDBFile) LoadProgress() (loaded, total int64) {
+	return s.loaded.Load(), s.total.Load()
+}
+
+// Aux returns the aux fields of the file read by Load, such as the version
+// of Redis that saved it.
+func (s *RDBFile) Aux() map[string]string {
+	return s.auxiliary
+}
+
+func (s *RDBFile) loadHeader(in io.Reader) error {
+	if err := binary.Read(in, binary.BigEndian, &s.info); err != nil {
+		return err
+	}
+
+	if !bytes.Equal(s.info.MagicNumber[:], magic) {
+		return errors.New("wrong signature")
+	}
 
-	var databaseHashTableSize int32
+	if v := s.FormatVersion(); v < 1 || v > maxLoadVersion {
+		return fmt.Errorf("can't handle RDB format version %s", s.info.Version[:])
+	}
+
+	return nil
+}
+
+// FormatVersion returns the RDB format version of the file read by Load, or
+// -1 if it is not a number.
+func (s *RDBFile) FormatVersion() int {
+	v, err := strconv.Atoi(string(s.info.Version[:]))
+	if err != nil {
+		return -1
+	}
+	return v
+}
+
+// checkChecksum compares the CRC64 of everything read up to the end of the
+// EOF opcode with the checksum following it. Files older than version 5
+// have no checksum, and files saved with rdbchecksum disabled store 0.
+func (s *RDBFile) checkChecksum(in *loadReader, verify bool) error {
+	if s.FormatVersion() < 5 {
+		return nil
+	}
+
+	end, got := in.offset, in.crc
+
+	var expected uint64
+	if err := binary.Read(in, binary.LittleEndian, &expected); err != nil {
+		return &CorruptError{Offset: end, Err: io.ErrUnexpectedEOF}
+	}
+
+	if !verify || expected == 0 {
+		return nil
+	}
+
+	if got != expected {
+		return &CorruptError{Offset: end, Err: fmt.Errorf("wrong checksum: expected %016x, got %016x", expected, got)}
+	}
+
+	return nil
+}
+
+// loadRecords reads opcodes and keys up to the EOF opcode, keeping offset at
+// the start of the record being read.
+func (s *RDBFile) loadRecords(in *loadReader, offset *int64, fn EntryFunc) error {
+	// db is the index of the current database, or -1 before the first
+	// SELECTDB opcode.
+	db := -1
+	// expiresAt is set by an expire opcode and applies to the next key.
+	var expiresAt *time.Time
 
-outer:
 	for {
-		fb, errPa := parseByte(in)
-		if errPa != nil {
-			return errPa
+		*offset = in.offset
 
+		fb, err := parseByte(in)
+		if err != nil {
+			return err
 		}
 
 		switch fb {
@@ -91,100 +221,107 @@ outer:
 
 			s.auxiliary[key] = val
 		case selectDB:
-			_, _, err = parseLengthEncoding(in)
+			index, err := parseLength(in)
 			if err != nil {
 				return err
 			}
+
+			db = int(index)
 		case resizeDB:
-			databaseHashTableSize, _, err = parseLengthEncoding(in)
+			// The sizes of the main and expires tables are only hints.
+			for range 2 {
+				if _, err := parseLength(in); err != nil {
+					return err
+				}
+			}
+		case slotInfo:
+			// The slot ID, its size and the number of its keys with an
+			// expiry, which are only useful to clusters.
+			for range 3 {
+				if _, err := parseLength(in); err != nil {
+					return err
+				}
+			}
+		case expireTimeMillis:
+			ms, err := parseInt64(in)
 			if err != nil {
 				return err
 			}
 
-			_, _, err = parseLengthEncoding(in)
+			expiryTime := time.UnixMilli(ms)
+			expiresAt = &expiryTime
+		case expireTimeSec:
+			var sec int32
+
+			err := binary.Read(in, binary.LittleEndian, &sec)
 			if err != nil {
 				return err
 			}
 
-			db := &RDBDatabase{
-				Data: make(map[string]value),
-				mu:   &sync.Mutex{},
+			expiryTime := time.Unix(int64(sec), 0)
+			expiresAt = &expiryTime
+		case idle:
+			// The LRU idle time of the next key. Keys are never evicted, so
+			// it is not kept.
+			if _, err := parseLength(in); err != nil {
+				return err
+			}
+		case freq:
+			// The LFU frequency of the next key, not kept either.
+			if _, err := parseByte(in); err != nil {
+				return err
+			}
+		case moduleAux:
+			// The module ID, followed by when the data was saved relative
+			// to the keyspace, as an unsigned integer with its opcode.
+			if _, err := parseLength(in); err != nil {
+				return err
+			}
+			whenOpcode, err := parseLength(in)
+			if err != nil {
+				return err
+			}
+			if whenOpcode != moduleOpcodeUInt {
+				return errors.New("invalid module aux data")
+			}
+			if _, err := parseLength(in); err != nil {
+				return err
 			}
-			s.DBs = append(s.DBs, db)
-
-			for range databaseHashTableSize {
-				var valType byte
-				var val value
-
-				kpF, err := parseByte(in)
-				if err != nil {
-					return err
-				}
 
-				switch kpF {
-				case expireTimeMillis:
-					msBuffer := make([]byte, 8)
-
-					err := binary.Read(in, binary.BigEndian, &msBuffer)
-					if err != nil {
-						return err
-					}
-
-					i := int64(msBuffer[0]) + int64(msBuffer[1])<<8 + int64(msBuffer[2])<<16 + int64(msBuffer[3])<<24 + int64(msBuffer[4])<<32 + int64(msBuffer[5])<<40 + int64(msBuffer[6])<<48 + int64(msBuffer[7])<<56
-					expiryTime := time.Unix(i/1000, i%1000*1000)
-					val.Exp = &expiryTime
-
-					valType, err = parseByte(in)
-					if err != nil {
-						return err
-					}
-				case expireTimeSec:
-					secBuffer := make([]byte, 4)
-
-					err := binary.Read(in, binary.BigEndian, &secBuffer)
-					if err != nil {
-						return err
-					}
-
-					i := int64(secBuffer[0]) + int64(secBuffer[1])<<8 + int64(secBuffer[2])<<16 + int64(secBuffer[3])<<24
-					expiryTime := time.Unix(i, 0)
-					val.Exp = &expiryTime
-
-					valType, err = parseByte(in)
-					if err != nil {
-						return err
-					}
-				default:
-					valType = kpF
-				}
+			if err := skipModuleData(in); err != nil {
+				return err
+			}
+		case function2:
+			// The code of a function library. Functions can not run here,
+			// so libraries are dropped.
+			if _, err := parseString(in); err != nil {
+				return err
+			}
+		case functionPreGA:
+			return errors.New("pre-GA function format is not supported")
+		case eof:
+			return nil
+		default:
+			if db < 0 {
+				return errors.New("key outside of a database")
+			}
 
-				key, err := parseString(in)
-				if err != nil {
-					return err
-				}
-				switch valType {
-				case 0:
-					val.Val, err = parseString(in)
-					if err != nil {
-						return err
-					}
-				default:
-					return errors.New("type is not implemented")
-				}
+			key, err := parseString(in)
+			if err != nil {
+				return err
+			}
 
-				db.mu.Lock()
-				db.Data[key] = val
-				db.mu.Unlock()
+			obj, err := parseObject(in, fb)
+			if err != nil {
+				return err
 			}
 
-		case eof:
-			break outer
-		default:
-			return errors.New("unknown byte marker")
+			if err := fn(db, Entry{Key: key, ExpiresAt: expiresAt, Object: obj}); err != nil {
+				return err
+			}
+			expiresAt = nil
 		}
 	}
-
-	return nil
 }
 
 func parseByte(io io.Reader) (byte, error) {
@@ -198,37 +335,40 @@ func parseByte(io io.Reader) (byte, error) {
 	return fb, nil
 }
 
-func parseLengthEncoding(in io.Reader) (int32, byte, error) {
+// parseLengthEncoding reads a length in its 6, 14, 32 or 64-bit form, the
+// last two being big endian. For the 0b11 prefix, which announces a string
+// stored as an integer or compressed, it returns the prefix byte instead.
+func parseLengthEncoding(in io.Reader) (uint64, byte, error) {
 	f, err := parseByte(in)
 	if err != nil {
 		return 0, 0, err
 	}
 
-	encType := f >> 6
-
-	switch encType {
+	switch f >> 6 {
 	case 0b00:
-		return int32(f & 0x3F), 0, nil
+		return uint64(f & 0x3F), 0, nil
 	case 0b01:
 		s, err := parseByte(in)
 		if err != nil {
 			return 0, 0, err
 		}
 
-		return int32(f&0x3F) + int32(s), 0, err
+		return uint64(f&0x3F)<<8 | uint64(s), 0, nil
 	case 0b10:
-		var l int32
-
-		err := binary.Read(in, binary.LittleEndian, &l)
-		if err != nil {
-			return 0, 0, err
+		switch f {
+		case 0x80:
+			var l uint32
+			err := binary.Read(in, binary.BigEndian, &l)
+			return uint64(l), 0, err
+		case 0x81:
+			var l uint64
+			err := binary.Read(in, binary.BigEndian, &l)
+			return l, 0, err
+		default:
+			return 0, 0, fmt.Errorf("invalid length encoding 0x%02x", f)
 		}
-
-		return l, 0, err
-	case 0b11:
-		return 0, f, nil
 	default:
-		return 0, 0, errors.New("invalid string encoding")
+		return 0, f, nil
 	}
 }
 
@@ -239,14 +379,17 @@ func parseString(in io.Reader) (string, error) {
 	}
 
 	if encoded == 0 {
-		buf := make([]byte, length)
-
-		err := binary.Read(in, binary.BigEndian, &buf)
+		// The length is not trusted for allocating the buffer up front, so
+		// that a corrupt one fails on the missing data instead.
+		buf, err := io.ReadAll(io.LimitReader(in, int64(length)))
 		if err != nil {
 			return "", err
 		}
+		if uint64(len(buf)) != length {
+			return "", io.ErrUnexpectedEOF
+		}
 
-		return string(buf), err
+		return string(buf), nil
 	}
 
 	switch encoded & byte(0x3F) {
@@ -278,8 +421,37 @@ func parseString(in io.Reader) (string, error) {
 
 		return strconv.Itoa(int(l)), nil
 	case 3:
-		return "", errors.New("compressed is not support yet")
+		return parseCompressedString(in)
 	default:
 		return "", errors.New("invalid string (integer) encoding")
 	}
 }
+
+// parseCompressedString reads an LZF compressed string: its compressed and
+// uncompressed lengths followed by the compressed data.
+func parseCompressedString(in io.Reader) (string, error) {
+	clen, err := parseLength(in)
+	if err != nil {
+		return "", err
+	}
+
+	ulen, err := parseLength(in)
+	if err != nil {
+		return "", err
+	}
+
+	compressed, err := io.ReadAll(io.LimitReader(in, int64(clen)))
+	if err != nil {
+		return "", err
+	}
+	if uint64(len(compressed)) != clen {
+		return "", io.ErrUnexpectedEOF
+	}
+
+	out, err := lzfDecompress(compressed, int(ulen))
+	if err != nil {
+		return "", err
+	}
+
+	return string(out), nil
+}
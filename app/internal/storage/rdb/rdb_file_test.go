@@ -0,0 +1,399 @@
+package rdb
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// loadFixture decodes an RDB file of testdata into its keys, which must all
+// be in database 0.
+func loadFixture(t *testing.T, name string) (map[string]Entry, error) {
+	t.Helper()
+
+	entries := make(map[string]Entry)
+	file := NewRDBFile("testdata", name)
+	err := file.Load(true, func(db int, entry Entry) error {
+		if db != 0 {
+			t.Errorf("key %q loaded in database %d", entry.Key, db)
+		}
+		entries[entry.Key] = entry
+		return nil
+	})
+
+	return entries, err
+}
+
+// normalize sorts the elements of unordered types, so that objects compare
+// equal whatever the order Redis saved them in. Stream nodes are dropped:
+// streams are compared through their entries instead.
+func normalize(obj *Object) *Object {
+	norm := *obj
+	switch obj.Type {
+	case SetObject:
+		norm.Set = slices.Clone(obj.Set)
+		slices.Sort(norm.Set)
+	case HashObject:
+		norm.Hash = slices.Clone(obj.Hash)
+		slices.SortFunc(norm.Hash, func(a, b HashField) int {
+			return strings.Compare(a.Field, b.Field)
+		})
+	case ZSetObject:
+		norm.ZSet = slices.Clone(obj.ZSet)
+		slices.SortFunc(norm.ZSet, func(a, b ZSetMember) int {
+			return cmp.Or(cmp.Compare(a.Score, b.Score), strings.Compare(a.Member, b.Member))
+		})
+	case StreamObject:
+		str := *obj.Stream
+		str.Nodes = nil
+		norm.Stream = &str
+	}
+	return &norm
+}
+
+// pseudoRandomBytes returns the bytes gen_testdata.go writes for large
+// values: the high byte of each step of a 64-bit LCG.
+func pseudoRandomBytes(n int, seed uint64) string {
+	b := make([]byte, n)
+	x := seed
+	for i := range b {
+		x = x*6364136223846793005 + 1442695040888963407
+		b[i] = byte(x >> 56)
+	}
+	return string(b)
+}
+
+func at(ms int64) *time.Time {
+	t := time.UnixMilli(ms)
+	return &t
+}
+
+func str(s string) *Object {
+	return &Object{Type: StringObject, String: s}
+}
+
+func list(elems ...string) *Object {
+	return &Object{Type: ListObject, List: elems}
+}
+
+func set(members ...string) *Object {
+	return &Object{Type: SetObject, Set: members}
+}
+
+const streamTime = 1700000000000
+
+// The files listed here, but for the legacy ones, are written by
+// gen_testdata.go.
+//
+//go:generate go run gen_testdata.go
+
+var fixtures = []struct {
+	file string
+	want map[string]Entry
+	// entries holds the entries of the streams of want, whose nodes are not
+	// compared.
+	entries map[string][]StreamEntry
+}{
+	{
+		file: "strings.rdb",
+		want: map[string]Entry{
+			"int8":         {Object: str("-100")},
+			"int16":        {Object: str("30000")},
+			"int32":        {Object: str("-2000000000")},
+			"int64":        {Object: str("9223372036854775807")},
+			"12345":        {Object: str("integer key")},
+			"short":        {Object: str("hello")},
+			"medium":       {Object: str("UgPKrerqCYenotafUwJ0JcqJLpAo8PkNuqobsVeq5NeDylVtdU3lMaCbD1CskM8DSwm5VFe1Acp8jFGw7zYtJeUewpXkSH1jFI42")},
+			"large":        {Object: str(pseudoRandomBytes(20000, 2))},
+			"compressible": {Object: str(strings.Repeat("a", 200))},
+			"expires_ms":   {Object: str("bar"), ExpiresAt: at(4102444800123)},
+			"expired_ms":   {Object: str("baz"), ExpiresAt: at(1000000000000)},
+		},
+	},
+	{
+		file: "lists.rdb",
+		want: map[string]Entry{
+			"list": {Object: list("a", "bb", "12", "-5", "1000", "-70000", "2147483648", "9223372036854775807", strings.Repeat("c", 70))},
+			"list_compressed": {Object: list(func() []string {
+				elems := make([]string, 100)
+				for i := range elems {
+					elems[i] = "element-" + strconv.Itoa(i)
+				}
+				return elems
+			}()...)},
+		},
+	},
+	{
+		file: "sets.rdb",
+		want: map[string]Entry{
+			"intset_16":    {Object: set("-3", "7", "32766")},
+			"intset_32":    {Object: set("-2147418110", "1", "2147418110")},
+			"intset_64":    {Object: set("-9223090557583032318", "0", "9223090557583032318")},
+			"set_listpack": {Object: set("42", "alpha", "beta")},
+			"set": {Object: set(func() []string {
+				members := make([]string, 130)
+				for i := range members {
+					members[i] = fmt.Sprintf("member-%03d", i)
+				}
+				return members
+			}()...)},
+		},
+	},
+	{
+		file: "hashes_zsets.rdb",
+		want: map[string]Entry{
+			"hash": {Object: &Object{Type: HashObject, Hash: []HashField{
+				{Field: "name", Value: "redis"},
+				{Field: "ratio", Value: "-1.5"},
+				{Field: "version", Value: "7"},
+			}}},
+			"hash_table": {Object: &Object{Type: HashObject, Hash: []HashField{
+				{Field: "long", Value: strings.Repeat("v", 100)},
+				{Field: "short", Value: "1"},
+			}}},
+			"zset": {Object: &Object{Type: ZSetObject, ZSet: []ZSetMember{
+				{Member: "c", Score: -3.25},
+				{Member: "a", Score: 1},
+				{Member: "b", Score: 2.5},
+			}}},
+			"zset_skiplist": {Object: &Object{Type: ZSetObject, ZSet: []ZSetMember{
+				{Member: "low", Score: -1},
+				{Member: strings.Repeat("m", 70), Score: 10.5},
+			}}},
+		},
+	},
+	{
+		file: "stream.rdb",
+		want: map[string]Entry{
+			"sensor": {Object: &Object{Type: StreamObject, Stream: &Stream{
+				Length:       4,
+				LastId:       StreamId{Ms: streamTime + 10},
+				FirstId:      StreamId{Ms: streamTime},
+				EntriesAdded: 4,
+				Groups: []StreamGroup{{
+					Name:        "readers",
+					LastId:      StreamId{Ms: streamTime + 5},
+					EntriesRead: 3,
+					Pending: []StreamPendingEntry{
+						{ID: StreamId{Ms: streamTime, Seq: 1}, DeliveryTime: time.UnixMilli(streamTime + 60000), DeliveryCount: 1},
+						{ID: StreamId{Ms: streamTime + 5}, DeliveryTime: time.UnixMilli(streamTime + 60001), DeliveryCount: 2},
+					},
+					Consumers: []StreamConsumer{
+						{
+							Name:       "alice",
+							SeenTime:   time.UnixMilli(streamTime + 60002),
+							ActiveTime: time.UnixMilli(streamTime + 60001),
+							Pending:    []StreamId{{Ms: streamTime, Seq: 1}, {Ms: streamTime + 5}},
+						},
+						{
+							Name:     "bob",
+							SeenTime: time.UnixMilli(streamTime + 60003),
+						},
+					},
+				}},
+			}}},
+			"small": {Object: &Object{Type: StreamObject, Stream: &Stream{
+				Length:       1,
+				LastId:       StreamId{Ms: 100000, Seq: 7},
+				FirstId:      StreamId{Ms: 100000, Seq: 7},
+				EntriesAdded: 1,
+			}}},
+		},
+		entries: map[string][]StreamEntry{
+			"sensor": {
+				{ID: StreamId{Ms: streamTime}, Fields: []string{"temp", "20", "hum", "40"}},
+				{ID: StreamId{Ms: streamTime, Seq: 1}, Fields: []string{"temp", "21", "hum", "41"}},
+				{ID: StreamId{Ms: streamTime + 5}, Fields: []string{"temp", "22", "wind", "3"}},
+				{ID: StreamId{Ms: streamTime + 10}, Fields: []string{"temp", "23", "hum", "43"}},
+			},
+			"small": {
+				{ID: StreamId{Ms: 100000, Seq: 7}, Fields: []string{"f", "v"}},
+			},
+		},
+	},
+	{
+		file: "hash_ttl.rdb",
+		want: map[string]Entry{
+			"hash_lpex": {Object: &Object{Type: HashObject, Hash: []HashField{
+				{Field: "f1", Value: "v1", ExpiresAt: at(4102444800000)},
+				{Field: "f2", Value: "v2", ExpiresAt: at(4102444801500)},
+				{Field: "f3", Value: "v3"},
+			}}},
+			"hash_meta": {Object: &Object{Type: HashObject, Hash: []HashField{
+				{Field: "a", Value: "1", ExpiresAt: at(4102444801500)},
+				{Field: "b", Value: strings.Repeat("v", 100)},
+				{Field: "c", Value: "3", ExpiresAt: at(4102444800000)},
+			}}},
+		},
+	},
+	{
+		file: "expire_seconds.rdb",
+		want: map[string]Entry{
+			"expires_s": {Object: str("old"), ExpiresAt: at(2000000000000)},
+		},
+	},
+	{
+		file: "legacy/easily_compressible_string_key.rdb",
+		want: map[string]Entry{
+			strings.Repeat("a", 200): {Object: str("Key that redis should compress easily")},
+		},
+	},
+	{
+		file: "legacy/keys_with_expiry.rdb",
+		want: map[string]Entry{
+			"expires_ms_precision": {Object: str("2022-12-25 10:11:12.573 UTC"), ExpiresAt: at(1671963072573)},
+		},
+	},
+	{
+		file: "legacy/rdb_version_5_with_checksum.rdb",
+		want: map[string]Entry{
+			"abcd":         {Object: str("efgh")},
+			"foo":          {Object: str("bar")},
+			"bar":          {Object: str("baz")},
+			"abcdef":       {Object: str("abcdef")},
+			"longerstring": {Object: str("thisisalongerstring.idontknowwhatitmeans")},
+			"abc":          {Object: str("def")},
+		},
+	},
+	{
+		file: "legacy/rdb_v7_list_quicklist.rdb",
+		want: map[string]Entry{
+			"foo": {Object: list("bar", "baz", "boo")},
+		},
+	},
+	{
+		file: "legacy/ziplist_with_integers.rdb",
+		want: map[string]Entry{
+			"ziplist_with_integers": {Object: list("0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12",
+				"-2", "13", "25", "-61", "63", "16380", "-16000", "65535", "-65523", "4194304", "9223372036854775807")},
+		},
+	},
+	{
+		file: "legacy/intset_64.rdb",
+		want: map[string]Entry{
+			"intset_64": {Object: set("9223090557583032316", "9223090557583032317", "9223090557583032318")},
+		},
+	},
+}
+
+func TestLoadFixtures(t *testing.T) {
+	for _, tt := range fixtures {
+		t.Run(tt.file, func(t *testing.T) {
+			got, err := loadFixture(t, tt.file)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Errorf("Load() loaded %d keys, want %d", len(got), len(tt.want))
+			}
+
+			for key, want := range tt.want {
+				entry, ok := got[key]
+				if !ok {
+					t.Errorf("key %q not loaded", key)
+					continue
+				}
+
+				if !reflect.DeepEqual(entry.ExpiresAt, want.ExpiresAt) {
+					t.Errorf("key %q expires at %v, want %v", key, entry.ExpiresAt, want.ExpiresAt)
+				}
+				if g, w := normalize(entry.Object), normalize(want.Object); !reflect.DeepEqual(g, w) {
+					t.Errorf("key %q = %+v, want %+v", key, g, w)
+				}
+
+				if entry.Object.Type != StreamObject {
+					continue
+				}
+				entries, err := entry.Object.Stream.Entries()
+				if err != nil {
+					t.Errorf("key %q: Entries() error = %v", key, err)
+				} else if !reflect.DeepEqual(entries, tt.entries[key]) {
+					t.Errorf("key %q entries = %v, want %v", key, entries, tt.entries[key])
+				}
+			}
+		})
+	}
+}
+
+func TestLoadCorruptChecksum(t *testing.T) {
+	var keys int
+	file := NewRDBFile("testdata", "corrupt_crc.rdb")
+	err := file.Load(true, func(db int, entry Entry) error {
+		keys++
+		return nil
+	})
+
+	var corrupt *CorruptError
+	if !errors.As(err, &corrupt) {
+		t.Fatalf("Load() error = %v, want a CorruptError", err)
+	}
+	if !strings.Contains(corrupt.Err.Error(), "wrong checksum") {
+		t.Errorf("Load() error = %v, want a wrong checksum", err)
+	}
+	// The checksum follows the EOF opcode, which is 9 bytes before the end
+	// of the file.
+	if want := int64(20461 - 8); corrupt.Offset != want {
+		t.Errorf("Load() error offset = %d, want %d", corrupt.Offset, want)
+	}
+	if keys != len(fixtures[0].want) {
+		t.Errorf("Load() read %d keys before failing, want %d", keys, len(fixtures[0].want))
+	}
+
+	if err := file.Load(false, func(int, Entry) error { return nil }); err != nil {
+		t.Errorf("Load() without checksum verification error = %v", err)
+	}
+}
+
+// TestRoundTrip saves the keys of every fixture with the encoder, through
+// both Save and Dump, and checks that the decoder reads them back
+// unchanged.
+func TestRoundTrip(t *testing.T) {
+	for _, tt := range fixtures {
+		t.Run(tt.file, func(t *testing.T) {
+			loaded, err := loadFixture(t, tt.file)
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+
+			entries := make([]Entry, 0, len(loaded))
+			for _, entry := range loaded {
+				entries = append(entries, entry)
+			}
+
+			file := NewRDBFile(t.TempDir(), "dump.rdb")
+			if err := file.Save([]AuxField{{Key: "redis-ver", Value: "7.4.0"}}, entries, true); err != nil {
+				t.Fatalf("Save() error = %v", err)
+			}
+
+			saved := make(map[string]Entry)
+			err = file.Load(true, func(db int, entry Entry) error {
+				saved[entry.Key] = entry
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("Load() of the saved file error = %v", err)
+			}
+			if !reflect.DeepEqual(saved, loaded) {
+				t.Errorf("Load() of the saved file = %+v, want %+v", saved, loaded)
+			}
+
+			for key, entry := range loaded {
+				obj, err := Restore(Dump(entry.Object))
+				if err != nil {
+					t.Errorf("key %q: Restore(Dump()) error = %v", key, err)
+					continue
+				}
+				if !reflect.DeepEqual(obj, entry.Object) {
+					t.Errorf("key %q: Restore(Dump()) = %+v, want %+v", key, obj, entry.Object)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package rdb
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+)
+
+// Path returns the path of the RDB file.
+func (s *RDBFile) Path() string {
+	return filepath.Join(s.Dir, s.DBFilename)
+}
+
+// Save writes the entries of database 0 to the RDB file. The file ends with
+// a CRC64 checksum if checksum is set.
+func (s *RDBFile) Save(aux []AuxField, entries []Entry, checksum bool) error {
+	return s.replace(func(w *bufio.Writer) error {
+		enc := NewEncoder(w)
+		enc.WriteHeader(aux)
+		enc.WriteDatabase(0, entries)
+		enc.WriteEOF(checksum)
+		return enc.Err()
+	})
+}
+
+// SaveRaw replaces the RDB file with data, a whole RDB file encoded
+// elsewhere, like the one a master sends to its replicas.
+func (s *RDBFile) SaveRaw(data []byte) error {
+	return s.replace(func(w *bufio.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+// replace writes the RDB file with write. The file is first written and
+// synced under a temporary name, then renamed over the previous one, so
+// that a failed or interrupted save never leaves a partial file.
+func (s *RDBFile) replace(write func(w *bufio.Writer) error) error {
+	tmp, err := os.CreateTemp(s.Dir, "temp-*.rdb")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	w := bufio.NewWriter(tmp)
+	if err := write(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.Path())
+}
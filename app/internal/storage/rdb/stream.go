@@ -0,0 +1,124 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// Flags of the entries of a stream listpack.
+const (
+	streamItemDeleted    = 1 << 0
+	streamItemSameFields = 1 << 1
+)
+
+var errStreamNode = errors.New("invalid stream listpack")
+
+// StreamEntry is an entry of a stream, with its fields and values
+// interleaved.
+type StreamEntry struct {
+	ID     StreamId
+	Fields []string
+}
+
+// Entries decodes the entries of the stream, in ID order, skipping the
+// deleted ones.
+//
+// A node starts with a master entry: the number of valid and deleted
+// entries, the fields of the first entry and a 0 terminator. Every entry
+// follows as its flags, its ID as a difference from the master ID, its
+// fields unless they are the master ones, its values, and the number of
+// listpack elements it spans.
+func (s *Stream) Entries() ([]StreamEntry, error) {
+	var entries []StreamEntry
+
+	for _, node := range s.Nodes {
+		if len(node.Key) != 16 {
+			return nil, errStreamNode
+		}
+		master := StreamId{
+			Ms:  binary.BigEndian.Uint64(node.Key[:8]),
+			Seq: binary.BigEndian.Uint64(node.Key[8:]),
+		}
+
+		elems, err := listpackEntries(node.Listpack)
+		if err != nil {
+			return nil, err
+		}
+		r := &streamNodeReader{elems: elems}
+
+		r.int() // valid entries
+		r.int() // deleted entries
+		masterFields := make([]string, r.count())
+		for i := range masterFields {
+			masterFields[i] = r.next()
+		}
+		r.int() // master terminator
+
+		for r.err == nil && len(r.elems) > 0 {
+			flags := r.int()
+			id := StreamId{Ms: master.Ms + uint64(r.int()), Seq: master.Seq + uint64(r.int())}
+
+			var fields []string
+			if flags&streamItemSameFields != 0 {
+				fields = make([]string, 0, len(masterFields)*2)
+				for _, field := range masterFields {
+					fields = append(fields, field, r.next())
+				}
+			} else {
+				fields = make([]string, r.count()*2)
+				for i := range fields {
+					fields[i] = r.next()
+				}
+			}
+			r.int() // listpack elements of the entry
+
+			if flags&streamItemDeleted == 0 {
+				entries = append(entries, StreamEntry{ID: id, Fields: fields})
+			}
+		}
+
+		if r.err != nil {
+			return nil, r.err
+		}
+	}
+
+	return entries, nil
+}
+
+// streamNodeReader reads the elements of a stream listpack in order. Errors
+// are sticky, and reading past the end is one.
+type streamNodeReader struct {
+	elems []string
+	err   error
+}
+
+func (r *streamNodeReader) next() string {
+	if len(r.elems) == 0 {
+		r.err = errStreamNode
+		return ""
+	}
+
+	elem := r.elems[0]
+	r.elems = r.elems[1:]
+	return elem
+}
+
+// count reads a number of fields, which can not exceed the number of
+// elements left.
+func (r *streamNodeReader) count() int {
+	n := r.int()
+	if n < 0 || n > int64(len(r.elems)) {
+		r.err = errStreamNode
+		return 0
+	}
+	return int(n)
+}
+
+func (r *streamNodeReader) int() int64 {
+	v, err := strconv.ParseInt(r.next(), 10, 64)
+	if err != nil && r.err == nil {
+		r.err = errStreamNode
+	}
+	return v
+}
@@ -0,0 +1,112 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+var errCorruptZiplist = errors.New("corrupt ziplist")
+
+const (
+	ziplistHeaderSize = 10
+	ziplistEnd        = 0xFF
+)
+
+// ziplistEntries decodes a ziplist, the predecessor of listpacks found in
+// files written before Redis 7. It starts with a 10-byte header (total bytes,
+// offset of the last entry and number of entries) and ends with 0xFF. Every
+// entry holds the length of the previous one, an encoding and its data.
+func ziplistEntries(b []byte) ([]string, error) {
+	if len(b) < ziplistHeaderSize+1 || int(binary.LittleEndian.Uint32(b)) != len(b) || b[len(b)-1] != ziplistEnd {
+		return nil, errCorruptZiplist
+	}
+
+	entries := make([]string, 0, binary.LittleEndian.Uint16(b[8:]))
+
+	p := ziplistHeaderSize
+	for b[p] != ziplistEnd {
+		// The length of the previous entry takes 1 byte, or 5 when the first
+		// one is 254.
+		if b[p] == 254 {
+			p += 5
+		} else {
+			p++
+		}
+		if p >= len(b)-1 {
+			return nil, errCorruptZiplist
+		}
+
+		entry, size, err := ziplistEntry(b[p : len(b)-1])
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+		p += size
+	}
+
+	return entries, nil
+}
+
+// ziplistEntry decodes the entry starting with the encoding at b[0] and
+// returns it along with the number of bytes it takes.
+func ziplistEntry(b []byte) (string, int, error) {
+	enc := b[0]
+
+	str := func(header, n int) (string, int, error) {
+		if header+n > len(b) {
+			return "", 0, errCorruptZiplist
+		}
+		return string(b[header : header+n]), header + n, nil
+	}
+	integer := func(n int) (string, int, error) {
+		if 1+n > len(b) {
+			return "", 0, errCorruptZiplist
+		}
+
+		var v int64
+		switch n {
+		case 1:
+			v = int64(int8(b[1]))
+		case 2:
+			v = int64(int16(binary.LittleEndian.Uint16(b[1:])))
+		case 3:
+			v = int64(int32(uint32(b[1])<<8|uint32(b[2])<<16|uint32(b[3])<<24) >> 8)
+		case 4:
+			v = int64(int32(binary.LittleEndian.Uint32(b[1:])))
+		case 8:
+			v = int64(binary.LittleEndian.Uint64(b[1:]))
+		}
+		return strconv.FormatInt(v, 10), 1 + n, nil
+	}
+
+	switch {
+	case enc>>6 == 0:
+		return str(1, int(enc&0x3F))
+	case enc>>6 == 1:
+		if len(b) < 2 {
+			return "", 0, errCorruptZiplist
+		}
+		return str(2, int(enc&0x3F)<<8|int(b[1]))
+	case enc == 0x80:
+		if len(b) < 5 {
+			return "", 0, errCorruptZiplist
+		}
+		return str(5, int(binary.BigEndian.Uint32(b[1:])))
+	case enc == 0xC0:
+		return integer(2)
+	case enc == 0xD0:
+		return integer(4)
+	case enc == 0xE0:
+		return integer(8)
+	case enc == 0xF0:
+		return integer(3)
+	case enc == 0xFE:
+		return integer(1)
+	case enc >= 0xF1 && enc <= 0xFD:
+		// Small integers between 0 and 12 are stored in the encoding itself.
+		return strconv.Itoa(int(enc&0x0F) - 1), 1, nil
+	default:
+		return "", 0, errCorruptZiplist
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import "strings"
+
+// numSlots is the number of hash slots keys and shard channels are
+// distributed over, as in Redis Cluster.
+const numSlots = 16384
+
+// crc16 computes the CRC16/XMODEM checksum used to map keys to slots.
+func crc16(data string) uint16 {
+	var crc uint16
+	for i := 0; i < len(data); i++ {
+		crc ^= uint16(data[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// keyHashSlot returns the slot of key. If the key contains a non-empty hash
+// tag, such as "{user1}" in "{user1}.followers", only the tag is hashed, so
+// that related keys can be kept in the same slot.
+func keyHashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start != -1 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+
+	return int(crc16(key) % numSlots)
+}
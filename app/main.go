@@ -1,7 +1,6 @@
 package main
 
 import (
-	"fmt"
 	"log"
 )
 
@@ -13,11 +12,6 @@ func main() {
 
 	server := newServer(config)
 
-	_, err = server.loadRDB()
-	if err != nil {
-		fmt.Println("error loading rdb file: ", err)
-	}
-
 	go server.start()
 
 	for {
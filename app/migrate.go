@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	// migrateConnTTL is how long a connection to a MIGRATE target is kept
+	// open while unused, and migrateMaxConns how many are kept at most.
+	migrateConnTTL  = 10 * time.Second
+	migrateMaxConns = 64
+)
+
+// migrateConn is a connection to a MIGRATE target, kept open for the next
+// keys moved to the same instance.
+type migrateConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	// db is the database selected on the target.
+	db      int
+	lastUse time.Time
+}
+
+// migrateConns caches the connections to MIGRATE targets, by address. Only
+// used by MIGRATE, which holds execMu exclusively.
+type migrateConns struct {
+	conns map[string]*migrateConn
+}
+
+func newMigrateConns() *migrateConns {
+	return &migrateConns{conns: make(map[string]*migrateConn)}
+}
+
+// get returns the cached connection to addr, or opens a new one, closing
+// the connections left unused for too long first.
+func (m *migrateConns) get(addr string, timeout time.Duration) (*migrateConn, error) {
+	now := time.Now()
+	for cachedAddr, c := range m.conns {
+		if now.Sub(c.lastUse) > migrateConnTTL {
+			m.close(cachedAddr)
+		}
+	}
+
+	if c, ok := m.conns[addr]; ok {
+		c.lastUse = now
+		return c, nil
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// Make room by dropping any other connection.
+	if len(m.conns) >= migrateMaxConns {
+		for cachedAddr := range m.conns {
+			m.close(cachedAddr)
+			break
+		}
+	}
+
+	// A new connection starts in database 0.
+	c := &migrateConn{conn: conn, r: bufio.NewReader(conn), lastUse: now}
+	m.conns[addr] = c
+
+	return c, nil
+}
+
+func (m *migrateConns) close(addr string) {
+	if c, ok := m.conns[addr]; ok {
+		c.conn.Close()
+		delete(m.conns, addr)
+	}
+}
+
+// targetError is an error reply from a MIGRATE target.
+type targetError struct {
+	msg string
+}
+
+func (e *targetError) Error() string {
+	return e.msg
+}
+
+var errTargetProtocol = errors.New("unexpected reply from target instance")
+
+// readReply reads a simple string, error or integer reply. Error replies are
+// returned as a *targetError.
+func (c *migrateConn) readReply() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	if len(line) == 0 {
+		return "", errTargetProtocol
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return line[1:], nil
+	case '-':
+		return "", &targetError{msg: line[1:]}
+	default:
+		return "", errTargetProtocol
+	}
+}
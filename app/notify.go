@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"sync"
+)
+
+// Classes of keyspace events, selected with the notify-keyspace-events
+// configuration. K and E choose the channels events are published to, and
+// the other flags choose which events are published.
+const (
+	notifyKeyspace = 1 << iota // K
+	notifyKeyevent             // E
+	notifyGeneric              // g
+	notifyString               // $
+	notifyList                 // l
+	notifySet                  // s
+	notifyHash                 // h
+	notifyZset                 // z
+	notifyExpired              // x
+	notifyEvicted              // e
+	notifyStream               // t
+	notifyKeyMiss              // m
+	notifyNew                  // n
+
+	// notifyAll is what the A flag stands for. Key miss and new key events
+	// are excluded, as in Redis, since they are rarely wanted and costly.
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash |
+		notifyZset | notifyExpired | notifyEvicted | notifyStream
+)
+
+var errInvalidNotifyKeyspaceEvents = errors.New("Invalid event class character. Use 'Ag$lshzxeKEtmn'.")
+
+// notifyFlags maps every flag to its class, in the order they are listed
+// when the configuration is read back.
+var notifyFlags = []struct {
+	flag  byte
+	class int
+}{
+	{'g', notifyGeneric},
+	{'$', notifyString},
+	{'l', notifyList},
+	{'s', notifySet},
+	{'h', notifyHash},
+	{'z', notifyZset},
+	{'x', notifyExpired},
+	{'e', notifyEvicted},
+	{'t', notifyStream},
+	{'K', notifyKeyspace},
+	{'E', notifyKeyevent},
+	{'m', notifyKeyMiss},
+	{'n', notifyNew},
+}
+
+// parseNotifyKeyspaceEvents converts the flags of notify-keyspace-events to
+// a set of classes.
+func parseNotifyKeyspaceEvents(flags string) (int, error) {
+	classes := 0
+
+flags:
+	for i := 0; i < len(flags); i++ {
+		if flags[i] == 'A' {
+			classes |= notifyAll
+			continue
+		}
+
+		for _, f := range notifyFlags {
+			if f.flag == flags[i] {
+				classes |= f.class
+				continue flags
+			}
+		}
+
+		return 0, errInvalidNotifyKeyspaceEvents
+	}
+
+	return classes, nil
+}
+
+// formatNotifyKeyspaceEvents is the inverse of parseNotifyKeyspaceEvents,
+// using A whenever possible.
+func formatNotifyKeyspaceEvents(classes int) string {
+	var sb strings.Builder
+
+	if classes&notifyAll == notifyAll {
+		sb.WriteByte('A')
+	}
+
+	for _, f := range notifyFlags {
+		if f.class&notifyAll != 0 && classes&notifyAll == notifyAll {
+			continue
+		}
+		if classes&f.class != 0 {
+			sb.WriteByte(f.flag)
+		}
+	}
+
+	return sb.String()
+}
+
+// keyspaceEvents queues the keyspace notifications raised while dataMu is
+// held, so that they are published once it is released.
+type keyspaceEvents struct {
+	mu      *sync.Mutex
+	pending []keyspaceEvent
+	// publishMu keeps events in order when they are flushed concurrently.
+	publishMu *sync.Mutex
+}
+
+type keyspaceEvent struct {
+	channel string
+	message string
+}
+
+func newKeyspaceEvents() *keyspaceEvents {
+	return &keyspaceEvents{
+		mu:        &sync.Mutex{},
+		publishMu: &sync.Mutex{},
+	}
+}
+
+// notifyKeyspaceEvent queues event on key for the keyspace and keyevent
+// channels, if its class is enabled. It is published by the next call to
+// flushKeyspaceEvents. There is a single database, so channels always refer
+// to database 0.
+func (s *server) notifyKeyspaceEvent(class int, event, key string) {
+	classes := int(s.notifyKeyspaceEvents.Load())
+	if classes&class == 0 {
+		return
+	}
+
+	s.keyspaceEvents.mu.Lock()
+	defer s.keyspaceEvents.mu.Unlock()
+
+	if classes&notifyKeyspace != 0 {
+		s.keyspaceEvents.pending = append(s.keyspaceEvents.pending, keyspaceEvent{"__keyspace@0__:" + key, event})
+	}
+
+	if classes&notifyKeyevent != 0 {
+		s.keyspaceEvents.pending = append(s.keyspaceEvents.pending, keyspaceEvent{"__keyevent@0__:" + event, key})
+	}
+}
+
+// flushKeyspaceEvents publishes the queued keyspace events. It must be
+// called after every command, and by anything else raising events, once
+// dataMu is released.
+func (s *server) flushKeyspaceEvents() {
+	s.keyspaceEvents.publishMu.Lock()
+	defer s.keyspaceEvents.publishMu.Unlock()
+
+	s.keyspaceEvents.mu.Lock()
+	events := s.keyspaceEvents.pending
+	s.keyspaceEvents.pending = nil
+	s.keyspaceEvents.mu.Unlock()
+
+	for _, e := range events {
+		s.pubsub.publish(e.channel, e.message)
+	}
+}
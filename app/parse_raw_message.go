@@ -1,41 +1,189 @@
 package main
 
-import "unicode"
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
 
-func parseRawMessage(msgBuf []byte) []*command {
+// parseRawMessage parses every complete command at the start of msgBuf and
+// returns them along with the number of bytes they took up. A trailing
+// partial command is left unconsumed, so the caller can retry once more data
+// has been read. A malformed command is reported as an error, along with
+// the commands parsed before it.
+//
+// Commands are RESP arrays of bulk strings, which are binary safe, or inline
+// commands made of space separated words. A bulk string on its own, like the
+// RDB file a replica receives from its master, is returned as a command with
+// only a payload. Other top-level replies, like the FULLRESYNC line, are
+// skipped.
+func parseRawMessage(msgBuf []byte) ([]*command, int, error) {
 	cmds := make([]*command, 0)
+	consumed := 0
 
-	var cmd *command
+	for consumed < len(msgBuf) {
+		buf := msgBuf[consumed:]
 
-	for _, b := range msgBuf {
-		bRune := rune(b)
-		switch {
-		case bRune == '*':
-			cmd = &command{
-				rawBytes: []byte{b},
-				args:     make([]string, 0),
-			}
-			cmds = append(cmds, cmd)
-		case unicode.IsDigit(bRune):
-			if cmd == nil {
-				continue
-			}
-			cmd.append(b)
+		var cmd *command
+		var n int
+		var err error
+
+		switch buf[0] {
+		case '*':
+			cmd, n, err = parseRespArray(buf)
+		case '$':
+			cmd, n, err = parseBulkPayload(buf)
+		case '+', '-', ':':
+			n = lineLength(buf)
 		default:
-			if cmd == nil {
-				continue
-			}
-			n := len(cmds) - 1
-			lastCmd := cmds[n]
-			if len(lastCmd.rawBytes) == 1 && lastCmd.rawBytes[0] == '*' {
-				cmds = cmds[:n]
-				n = len(cmds) - 1
-				cmd = cmds[n]
-				cmd.append('*')
-			}
-			cmd.append(b)
-		}
-	}
-
-	return cmds
+			cmd, n = parseInlineCommand(buf)
+		}
+
+		if err != nil {
+			return cmds, consumed, err
+		}
+		if n == 0 {
+			break
+		}
+
+		if cmd != nil {
+			cmds = append(cmds, cmd)
+		}
+		consumed += n
+	}
+
+	return cmds, consumed, nil
+}
+
+// Limits on the lengths of a frame, as enforced by Redis, so that a
+// malformed one is reported rather than waited for.
+const (
+	maxMultibulkLength = 1024 * 1024
+	maxBulkLength      = 512 * 1024 * 1024
+	maxLengthLine      = 64 * 1024
+)
+
+var (
+	errInvalidMultibulkLength = errors.New("Protocol error: invalid multibulk length")
+	errInvalidBulkLength      = errors.New("Protocol error: invalid bulk length")
+)
+
+// parseRespArray parses a RESP array of bulk strings, returning 0 as length
+// if buf does not hold the whole array yet, and an error if it is
+// malformed. As in Redis, an array of negative length is skipped.
+func parseRespArray(buf []byte) (*command, int, error) {
+	count, pos, err := parseLengthLine(buf, 0)
+	if pos == 0 || err != nil {
+		return nil, 0, err
+	}
+	if count > maxMultibulkLength {
+		return nil, 0, errInvalidMultibulkLength
+	}
+	if count < 0 {
+		return nil, pos, nil
+	}
+
+	parts := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		if pos >= len(buf) {
+			return nil, 0, nil
+		}
+		if buf[pos] != '$' {
+			return nil, 0, fmt.Errorf("Protocol error: expected '$', got '%c'", buf[pos])
+		}
+
+		size, next, err := parseLengthLine(buf, pos)
+		if next == 0 || err != nil {
+			return nil, 0, err
+		}
+		if size < 0 || size > maxBulkLength {
+			return nil, 0, errInvalidBulkLength
+		}
+		if next+size+2 > len(buf) {
+			return nil, 0, nil
+		}
+
+		parts = append(parts, string(buf[next:next+size]))
+		pos = next + size + 2
+	}
+
+	return &command{rawBytes: bytes.Clone(buf[:pos]), parts: parts}, pos, nil
+}
+
+// parseBulkPayload parses a bulk string sent outside of an array. The RDB
+// file sent during a full resync is not followed by a CRLF, so the trailing
+// CRLF is only consumed when present.
+func parseBulkPayload(buf []byte) (*command, int, error) {
+	size, pos, err := parseLengthLine(buf, 0)
+	if pos == 0 || err != nil {
+		return nil, 0, err
+	}
+	if size < 0 {
+		return nil, pos, nil
+	}
+	if pos+size > len(buf) {
+		return nil, 0, nil
+	}
+
+	payload := bytes.Clone(buf[pos : pos+size])
+	pos += size
+	if bytes.HasPrefix(buf[pos:], []byte(carriageReturn())) {
+		pos += 2
+	}
+
+	return &command{payload: payload}, pos, nil
+}
+
+func parseInlineCommand(buf []byte) (*command, int) {
+	n := lineLength(buf)
+	if n == 0 {
+		return nil, 0
+	}
+
+	fields := bytes.Fields(buf[:n])
+	if len(fields) == 0 {
+		return nil, n
+	}
+
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		parts = append(parts, string(field))
+	}
+
+	return &command{rawBytes: bytes.Clone(buf[:n]), parts: parts}, n
+}
+
+// parseLengthLine parses a "<type><length>\r\n" header at pos, returning the
+// length and the position right after the header, or 0 as position if the
+// header is not complete yet. A length that is not a number is an error,
+// and so is a header too long to be one.
+func parseLengthLine(buf []byte, pos int) (length int, next int, err error) {
+	end := bytes.Index(buf[pos:], []byte(carriageReturn()))
+	if end < 0 {
+		if len(buf)-pos > maxLengthLine {
+			return 0, 0, errInvalidMultibulkLength
+		}
+		return 0, 0, nil
+	}
+
+	length, err = strconv.Atoi(string(buf[pos+1 : pos+end]))
+	if err != nil {
+		if buf[pos] == '$' {
+			return 0, 0, errInvalidBulkLength
+		}
+		return 0, 0, errInvalidMultibulkLength
+	}
+
+	return length, pos + end + 2, nil
+}
+
+// lineLength returns the length of the first line of buf including its line
+// ending, or 0 if the line is not complete yet.
+func lineLength(buf []byte) int {
+	end := bytes.IndexByte(buf, '\n')
+	if end < 0 {
+		return 0
+	}
+	return end + 1
 }
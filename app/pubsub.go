@@ -0,0 +1,280 @@
+package main
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/glob"
+)
+
+// subscriptionKind tells apart the three independent kinds of pub/sub
+// subscriptions.
+type subscriptionKind int
+
+const (
+	channelSubscription subscriptionKind = iota
+	patternSubscription
+	shardChannelSubscription
+)
+
+// pubSub tracks the channel, pattern and shard channel subscriptions of all
+// clients. The subscriptions of a single client are mirrored on the client
+// itself, and both sides are guarded by mu.
+type pubSub struct {
+	mu       *sync.Mutex
+	channels map[string]map[*Client]struct{}
+	patterns map[string]map[*Client]struct{}
+	// shardChannels is kept per slot, like keys in a cluster, so that all
+	// the channels of a slot can be found together.
+	shardChannels map[int]map[string]map[*Client]struct{}
+}
+
+func newPubSub() *pubSub {
+	return &pubSub{
+		mu:            &sync.Mutex{},
+		channels:      make(map[string]map[*Client]struct{}),
+		patterns:      make(map[string]map[*Client]struct{}),
+		shardChannels: make(map[int]map[string]map[*Client]struct{}),
+	}
+}
+
+// subscriptionCount returns the number of subscriptions of client counted in
+// replies to a subscription of the given kind: shard channels are counted on
+// their own, while channels and patterns are counted together. Callers must
+// hold mu.
+func (p *pubSub) subscriptionCount(client *Client, kind subscriptionKind) int {
+	if kind == shardChannelSubscription {
+		return len(client.shardChannels)
+	}
+	return len(client.channels) + len(client.patterns)
+}
+
+func (p *pubSub) isSubscribed(client *Client) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(client.channels)+len(client.patterns)+len(client.shardChannels) > 0
+}
+
+// registries returns the server-wide registry for a subscription to channel
+// along with the subscriptions of the client of the same kind. The registry
+// of a shard channel is created if needed. Callers must hold mu.
+func (p *pubSub) registries(client *Client, channel string, kind subscriptionKind) (map[string]map[*Client]struct{}, map[string]struct{}) {
+	switch kind {
+	case patternSubscription:
+		return p.patterns, client.patterns
+	case shardChannelSubscription:
+		slot := keyHashSlot(channel)
+		if p.shardChannels[slot] == nil {
+			p.shardChannels[slot] = make(map[string]map[*Client]struct{})
+		}
+		return p.shardChannels[slot], client.shardChannels
+	default:
+		return p.channels, client.channels
+	}
+}
+
+// subscribe subscribes client to a channel, pattern or shard channel, and
+// returns its subscription count afterwards.
+func (p *pubSub) subscribe(client *Client, channel string, kind subscriptionKind) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	registry, own := p.registries(client, channel, kind)
+
+	if _, ok := own[channel]; !ok {
+		own[channel] = struct{}{}
+		if registry[channel] == nil {
+			registry[channel] = make(map[*Client]struct{})
+		}
+		registry[channel][client] = struct{}{}
+	}
+
+	return p.subscriptionCount(client, kind)
+}
+
+// unsubscribe removes the subscription of client to a channel, pattern or
+// shard channel, and returns its subscription count afterwards.
+func (p *pubSub) unsubscribe(client *Client, channel string, kind subscriptionKind) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	registry, own := p.registries(client, channel, kind)
+
+	if _, ok := own[channel]; ok {
+		delete(own, channel)
+		delete(registry[channel], client)
+		if len(registry[channel]) == 0 {
+			delete(registry, channel)
+		}
+	}
+
+	if kind == shardChannelSubscription {
+		slot := keyHashSlot(channel)
+		if len(p.shardChannels[slot]) == 0 {
+			delete(p.shardChannels, slot)
+		}
+	}
+
+	return p.subscriptionCount(client, kind)
+}
+
+// subscriptions returns the channels, patterns or shard channels client is
+// subscribed to.
+func (p *pubSub) subscriptions(client *Client, kind subscriptionKind) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	own := client.channels
+	switch kind {
+	case patternSubscription:
+		own = client.patterns
+	case shardChannelSubscription:
+		own = client.shardChannels
+	}
+
+	names := make([]string, 0, len(own))
+	for name := range own {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// unsubscribeAll removes every subscription of a client that disconnected,
+// and stops writing the messages queued for it.
+func (p *pubSub) unsubscribeAll(client *Client) {
+	for _, kind := range []subscriptionKind{channelSubscription, patternSubscription, shardChannelSubscription} {
+		for _, channel := range p.subscriptions(client, kind) {
+			p.unsubscribe(client, channel, kind)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	client.closePushes()
+}
+
+// publish delivers message to the subscribers of channel and of every
+// pattern matching it, and returns the number of clients that received it.
+// Messages are queued while holding mu, so every subscriber receives them in
+// publishing order, and written by every subscriber on its own, so that a
+// slow one does not hold mu.
+func (p *pubSub) publish(channel, message string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	receivers := 0
+
+	for client := range p.channels[channel] {
+		frame := respAsPush(client.protocol, [][]byte{
+			respAsBulkString("message"),
+			respAsBulkString(channel),
+			respAsBulkString(message),
+		})
+		if client.push(frame) {
+			receivers++
+		}
+	}
+
+	for pattern, clients := range p.patterns {
+		if !glob.Match(pattern, channel) {
+			continue
+		}
+
+		for client := range clients {
+			frame := respAsPush(client.protocol, [][]byte{
+				respAsBulkString("pmessage"),
+				respAsBulkString(pattern),
+				respAsBulkString(channel),
+				respAsBulkString(message),
+			})
+			if client.push(frame) {
+				receivers++
+			}
+		}
+	}
+
+	return receivers
+}
+
+// shardPublish delivers message to the subscribers of the shard channel,
+// which patterns never match, and returns the number of clients that
+// received it.
+func (p *pubSub) shardPublish(channel, message string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	receivers := 0
+
+	for client := range p.shardChannels[keyHashSlot(channel)][channel] {
+		frame := respAsPush(client.protocol, [][]byte{
+			respAsBulkString("smessage"),
+			respAsBulkString(channel),
+			respAsBulkString(message),
+		})
+		if client.push(frame) {
+			receivers++
+		}
+	}
+
+	return receivers
+}
+
+// activeChannels returns the channels with at least one subscriber, limited
+// to those matching pattern unless it is empty.
+func (p *pubSub) activeChannels(pattern string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return matchingChannels(p.channels, pattern)
+}
+
+// activeShardChannels is like activeChannels, for shard channels.
+func (p *pubSub) activeShardChannels(pattern string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	channels := make([]string, 0)
+	for _, slotChannels := range p.shardChannels {
+		channels = append(channels, matchingChannels(slotChannels, pattern)...)
+	}
+	sort.Strings(channels)
+
+	return channels
+}
+
+func matchingChannels(registry map[string]map[*Client]struct{}, pattern string) []string {
+	channels := make([]string, 0, len(registry))
+	for channel := range registry {
+		if pattern == "" || glob.Match(pattern, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	sort.Strings(channels)
+
+	return channels
+}
+
+func (p *pubSub) numSub(channel string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.channels[channel])
+}
+
+func (p *pubSub) shardNumSub(channel string) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.shardChannels[keyHashSlot(channel)][channel])
+}
+
+func (p *pubSub) numPat() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.patterns)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/listpack"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/rdb"
+)
+
+// loadRDB loads an RDB file, if there is one, straight into the keyspace.
+//
+// The server only has database 0, so the keys of the other databases are
+// skipped, with a warning for each database.
+func (s *server) loadRDB(file *rdb.RDBFile) error {
+	s.dataMu.Lock()
+	defer s.dataMu.Unlock()
+
+	skipped := make(map[int]bool)
+	err := file.Load(s.rdbChecksum.Load(), func(db int, entry rdb.Entry) error {
+		if db != 0 {
+			if !skipped[db] {
+				fmt.Printf("Warning: skipping the keys of database %d in %s, only database 0 is supported\n", db, file.Path())
+				skipped[db] = true
+			}
+			return nil
+		}
+		return s.loadRDBEntry(entry)
+	})
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// loadMasterRDB replaces the dataset with the RDB file sent by the master
+// during a full resync. As in Redis, the file is saved as the RDB file of
+// the replica, then loaded from there.
+func (s *server) loadMasterRDB(data []byte) error {
+	s.execMu.Lock()
+	defer s.execMu.Unlock()
+
+	if err := s.rdbFile.SaveRaw(data); err != nil {
+		return err
+	}
+
+	s.signalFlushedDb()
+
+	s.dataMu.Lock()
+	s.data = make(map[string]*storage.ExpiringValue)
+	s.volatileKeys = make(map[string]struct{})
+	s.streams.Streams = make(map[string]*Stream)
+	s.dataMu.Unlock()
+
+	return s.loadRDB(s.rdbFile)
+}
+
+// isAllowedWhileLoading reports whether the command name may run before the
+// dataset is loaded, which is only the case for commands that do not touch
+// it.
+func isAllowedWhileLoading(name string) bool {
+	switch name {
+	case cmdInfo, cmdConfigGet, cmdConfigSet, cmdHello:
+		return true
+	default:
+		return false
+	}
+}
+
+// loadRDBEntry adds a key read from the RDB file to the keyspace. Callers must
+// hold dataMu.
+//
+// Masters skip the keys and hash fields that expired while the server was
+// down. Replicas keep them, as they wait for the deletions of their master.
+//
+// The key replaces any value already at it, whatever its type, as a file
+// holding the same key twice keeps the last one.
+func (s *server) loadRDBEntry(entry rdb.Entry) error {
+	now := time.Now()
+	if s.isMaster() && entry.ExpiresAt != nil && !entry.ExpiresAt.After(now) {
+		return nil
+	}
+
+	if entry.Object.Type == rdb.StreamObject {
+		stream, err := streamFromRDB(entry.Key, entry.Object.Stream)
+		if err != nil {
+			return err
+		}
+		delete(s.data, entry.Key)
+		s.streams.Streams[entry.Key] = stream
+		return nil
+	}
+
+	var expVal *storage.ExpiringValue
+	switch obj := entry.Object; obj.Type {
+	case rdb.HashObject:
+		expVal = storage.NewExpiringHash()
+		for _, field := range obj.Hash {
+			if s.isMaster() && field.ExpiresAt != nil && !field.ExpiresAt.After(now) {
+				continue
+			}
+
+			val := storage.NewExpiringValue(field.Value)
+			if field.ExpiresAt != nil {
+				val.SetExpiresAt(*field.ExpiresAt)
+			}
+			expVal.Hash.Fields[field.Field] = val
+		}
+		if len(expVal.Hash.Fields) == 0 {
+			return nil
+		}
+	case rdb.ListObject:
+		expVal = storage.NewExpiringValue("")
+		expVal.List = &storage.List{Elements: obj.List}
+	case rdb.SetObject:
+		expVal = storage.NewExpiringValue("")
+		expVal.Set = &storage.Set{Members: obj.Set}
+	case rdb.ZSetObject:
+		members := make([]storage.ZSetMember, 0, len(obj.ZSet))
+		for _, member := range obj.ZSet {
+			members = append(members, storage.ZSetMember{Member: member.Member, Score: member.Score})
+		}
+		expVal = storage.NewExpiringValue("")
+		expVal.ZSet = &storage.ZSet{Members: members}
+	default:
+		expVal = storage.NewExpiringValue(obj.String)
+	}
+
+	if entry.ExpiresAt != nil {
+		expVal.SetExpiresAt(*entry.ExpiresAt)
+	}
+	s.deleteStream(entry.Key)
+	s.data[entry.Key] = expVal
+	if hasVolatileData(expVal) {
+		s.trackVolatileKey(entry.Key)
+	}
+
+	return nil
+}
+
+// streamFromRDB rebuilds a stream from its RDB layout. Nodes are listpacks
+// in the format the server uses itself, so they are indexed as is.
+func streamFromRDB(key string, str *rdb.Stream) (*Stream, error) {
+	s := NewStream(key)
+
+	for _, node := range str.Nodes {
+		lp, err := listpack.FromBytes(node.Listpack)
+		if err != nil {
+			return nil, fmt.Errorf("stream %s: %w", key, err)
+		}
+		s.index.Insert(node.Key, &streamNode{lp: lp, masterId: streamIdFromRaxKey(node.Key)})
+	}
+
+	s.length = int(str.Length)
+	s.EntriesAdded = int(str.EntriesAdded)
+	s.LastId = streamIdFromRDB(str.LastId)
+	s.MaxDeletedEntryId = streamIdFromRDB(str.MaxDeletedId)
+
+	for _, g := range str.Groups {
+		lastId := StreamEntryId{MillisTime: g.LastId.Ms, SequenceNr: g.LastId.Seq}
+		group, _ := s.CreateGroup(g.Name, &lastId, int(g.EntriesRead))
+
+		for _, pending := range g.Pending {
+			id := StreamEntryId{MillisTime: pending.ID.Ms, SequenceNr: pending.ID.Seq}
+			group.Pending[id] = &StreamPendingEntry{
+				ID:            id,
+				DeliveryTime:  pending.DeliveryTime,
+				DeliveryCount: int(pending.DeliveryCount),
+			}
+		}
+
+		for _, c := range g.Consumers {
+			consumer := &StreamConsumer{
+				Name:       c.Name,
+				SeenTime:   c.SeenTime,
+				ActiveTime: c.ActiveTime,
+				Pending:    make(map[StreamEntryId]*StreamPendingEntry),
+			}
+			for _, rdbId := range c.Pending {
+				id := StreamEntryId{MillisTime: rdbId.Ms, SequenceNr: rdbId.Seq}
+				pending := group.Pending[id]
+				pending.Consumer = consumer
+				consumer.Pending[id] = pending
+			}
+			group.Consumers[c.Name] = consumer
+		}
+
+		for id, pending := range group.Pending {
+			if pending.Consumer == nil {
+				return nil, fmt.Errorf("stream %s: pending entry %s of group %s has no consumer", key, id.String(), g.Name)
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// streamIdFromRDB converts an ID of the stream metadata, where 0-0 stands for
+// no ID at all.
+func streamIdFromRDB(id rdb.StreamId) *StreamEntryId {
+	if id.Ms == 0 && id.Seq == 0 {
+		return nil
+	}
+	return &StreamEntryId{MillisTime: id.Ms, SequenceNr: id.Seq}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage"
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/rdb"
+)
+
+var (
+	errBgsaveInProgress = errors.New("Background save already in progress")
+	errBgsaveBusy       = errors.New("Another child process is active (AOF?): can't BGSAVE right now. Use BGSAVE SCHEDULE in order to schedule a BGSAVE whenever possible")
+)
+
+// persistence tracks the RDB saves and append-only file rewrites of the
+// server. Only one of them runs in the background at a time, the other one
+// being scheduled until it is done. Guarded by mu, except for dirty.
+type persistence struct {
+	mu               *sync.Mutex
+	lastSave         time.Time
+	lastBgsaveTry    time.Time
+	bgsaveInProgress bool
+	bgsaveScheduled  bool
+	lastBgsaveOk     bool
+
+	aofRewriteInProgress bool
+	aofRewriteScheduled  bool
+	aofRewriteStart      time.Time
+	lastAofRewriteOk     bool
+	// dirty counts the changes to the dataset since the last successful
+	// save.
+	dirty atomic.Int64
+	// loading is set while the dataset is loaded at startup, which
+	// loadingStart records. loadProgress reports the bytes loaded so far
+	// out of the size of the file being loaded.
+	loading      atomic.Bool
+	loadingStart time.Time
+	loadProgress func() (loaded, total int64)
+}
+
+func newPersistence() *persistence {
+	return &persistence{
+		mu:               &sync.Mutex{},
+		lastSave:         time.Now(),
+		lastBgsaveOk:     true,
+		lastAofRewriteOk: true,
+	}
+}
+
+// rdbSnapshot copies the keyspace into RDB entries, skipping expired keys
+// and hash fields. Callers must hold execMu exclusively, which makes the
+// snapshot consistent: no command can run while it is taken.
+func (s *server) rdbSnapshot() []rdb.Entry {
+	s.dataMu.RLock()
+	defer s.dataMu.RUnlock()
+
+	entries := make([]rdb.Entry, 0, len(s.data)+len(s.streams.Streams))
+
+	for key, expVal := range s.data {
+		if expVal.HasExpired() {
+			continue
+		}
+
+		entry := rdb.Entry{Key: key, Object: rdbObject(expVal)}
+		if at, ok := expVal.ExpiresAt(); ok {
+			entry.ExpiresAt = &at
+		}
+
+		entries = append(entries, entry)
+	}
+
+	for _, stream := range s.streams.Streams {
+		entries = append(entries, rdb.Entry{Key: stream.Key, Object: stream.rdbObject()})
+	}
+
+	return entries
+}
+
+// rdbObject copies the value of a key in the RDB layout.
+func rdbObject(expVal *storage.ExpiringValue) *rdb.Object {
+	switch {
+	case expVal.IsHash():
+		return hashRDBObject(expVal.Hash)
+	case expVal.IsList():
+		return &rdb.Object{Type: rdb.ListObject, List: expVal.List.Elements}
+	case expVal.IsSet():
+		return &rdb.Object{Type: rdb.SetObject, Set: expVal.Set.Members}
+	case expVal.IsZSet():
+		return zsetRDBObject(expVal.ZSet)
+	default:
+		return &rdb.Object{Type: rdb.StringObject, String: expVal.Val}
+	}
+}
+
+func hashRDBObject(hash *storage.Hash) *rdb.Object {
+	fields := make([]rdb.HashField, 0, len(hash.Fields))
+	for field, val := range hash.Fields {
+		if val.HasExpired() {
+			continue
+		}
+
+		hashField := rdb.HashField{Field: field, Value: val.Val}
+		if at, ok := val.ExpiresAt(); ok {
+			hashField.ExpiresAt = &at
+		}
+		fields = append(fields, hashField)
+	}
+
+	return &rdb.Object{Type: rdb.HashObject, Hash: fields}
+}
+
+func zsetRDBObject(zset *storage.ZSet) *rdb.Object {
+	members := make([]rdb.ZSetMember, 0, len(zset.Members))
+	for _, member := range zset.Members {
+		members = append(members, rdb.ZSetMember{Member: member.Member, Score: member.Score})
+	}
+
+	return &rdb.Object{Type: rdb.ZSetObject, ZSet: members}
+}
+
+// rdbObject copies the stream in the RDB layout. Nodes are already stored as
+// listpacks in the format Redis uses, so they are copied as is.
+func (s *Stream) rdbObject() *rdb.Object {
+	str := &rdb.Stream{
+		Length:       uint64(s.length),
+		EntriesAdded: uint64(s.EntriesAdded),
+	}
+
+	s.index.Walk(func(key []byte, val any) bool {
+		node := val.(*streamNode)
+		str.Nodes = append(str.Nodes, rdb.StreamNode{
+			Key:      append([]byte(nil), key...),
+			Listpack: append([]byte(nil), node.lp.Bytes()...),
+		})
+		return true
+	})
+
+	if s.LastId != nil {
+		str.LastId = s.LastId.rdbId()
+	}
+	if first := s.firstEntryId(); first != nil {
+		str.FirstId = first.rdbId()
+	}
+	if s.MaxDeletedEntryId != nil {
+		str.MaxDeletedId = s.MaxDeletedEntryId.rdbId()
+	}
+
+	for _, group := range s.sortedGroups() {
+		g := rdb.StreamGroup{
+			Name:        group.Name,
+			LastId:      group.LastDeliveredId.rdbId(),
+			EntriesRead: int64(group.EntriesRead),
+		}
+
+		for _, pending := range group.sortedPending() {
+			g.Pending = append(g.Pending, rdb.StreamPendingEntry{
+				ID:            pending.ID.rdbId(),
+				DeliveryTime:  pending.DeliveryTime,
+				DeliveryCount: uint64(pending.DeliveryCount),
+			})
+		}
+
+		for _, consumer := range group.sortedConsumers() {
+			c := rdb.StreamConsumer{
+				Name:       consumer.Name,
+				SeenTime:   consumer.SeenTime,
+				ActiveTime: consumer.ActiveTime,
+			}
+			for _, pending := range consumer.sortedPending() {
+				c.Pending = append(c.Pending, pending.ID.rdbId())
+			}
+			g.Consumers = append(g.Consumers, c)
+		}
+
+		str.Groups = append(str.Groups, g)
+	}
+
+	return &rdb.Object{Type: rdb.StreamObject, Stream: str}
+}
+
+func (id *StreamEntryId) rdbId() rdb.StreamId {
+	return rdb.StreamId{Ms: id.MillisTime, Seq: id.SequenceNr}
+}
+
+// rdbAuxFields returns the auxiliary fields of an RDB file, which may be the
+// base file of the append-only file.
+func (s *server) rdbAuxFields(aofBase bool) []rdb.AuxField {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	base := "0"
+	if aofBase {
+		base = "1"
+	}
+
+	return []rdb.AuxField{
+		{Key: "redis-ver", Value: serverVersion},
+		{Key: "redis-bits", Value: "64"},
+		{Key: "ctime", Value: strconv.FormatInt(time.Now().Unix(), 10)},
+		{Key: "used-mem", Value: strconv.FormatUint(mem.Alloc, 10)},
+		{Key: "aof-base", Value: base},
+	}
+}
+
+// saveRDB writes the dataset to the RDB file before returning. Callers must
+// hold execMu exclusively.
+func (s *server) saveRDB() error {
+	s.persistence.mu.Lock()
+	defer s.persistence.mu.Unlock()
+
+	if s.persistence.bgsaveInProgress {
+		return errBgsaveInProgress
+	}
+
+	err := s.rdbFile.Save(s.rdbAuxFields(false), s.rdbSnapshot(), s.rdbChecksum.Load())
+	if err != nil {
+		return err
+	}
+
+	s.persistence.lastSave = time.Now()
+	s.persistence.dirty.Store(0)
+
+	return nil
+}
+
+// bgsaveRDB takes a snapshot of the dataset and writes it to the RDB file in
+// the background. Callers must hold execMu exclusively, but only for as long
+// as the snapshot is copied: commands resume while the file is written.
+//
+// While the append-only file is rewritten, the save fails, or is scheduled
+// if schedule is set, which it reports.
+func (s *server) bgsaveRDB(schedule bool) (scheduled bool, err error) {
+	s.persistence.mu.Lock()
+	defer s.persistence.mu.Unlock()
+
+	if s.persistence.bgsaveInProgress {
+		return false, errBgsaveInProgress
+	}
+
+	if s.persistence.aofRewriteInProgress {
+		if !schedule {
+			return false, errBgsaveBusy
+		}
+		s.persistence.bgsaveScheduled = true
+		return true, nil
+	}
+
+	s.startBgsave()
+	return false, nil
+}
+
+// startBgsave starts a background save. Callers must hold execMu
+// exclusively, and persistence.mu.
+func (s *server) startBgsave() {
+	aux, entries := s.rdbAuxFields(false), s.rdbSnapshot()
+	checksum := s.rdbChecksum.Load()
+	dirty := s.persistence.dirty.Load()
+	s.persistence.bgsaveInProgress = true
+	s.persistence.bgsaveScheduled = false
+	s.persistence.lastBgsaveTry = time.Now()
+
+	go func() {
+		err := s.rdbFile.Save(aux, entries, checksum)
+		if err != nil {
+			fmt.Println("Background saving error: ", err)
+		}
+
+		s.persistence.mu.Lock()
+		defer s.persistence.mu.Unlock()
+
+		s.persistence.bgsaveInProgress = false
+		s.persistence.lastBgsaveOk = err == nil
+		if err == nil {
+			s.persistence.lastSave = time.Now()
+			// Changes made while the file was written are not part of it.
+			s.persistence.dirty.Add(-dirty)
+		}
+	}()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultSaveRules = "3600 1 300 100 60 10000"
+
+	saveCronInterval = time.Second
+	// bgsaveRetryDelay is how long automatic saves wait after a failed one.
+	bgsaveRetryDelay = 5 * time.Second
+)
+
+var errInvalidSaveRules = errors.New("Invalid save parameters")
+
+// saveRule triggers a background save once at least changes writes happened
+// and seconds elapsed since the last successful save.
+type saveRule struct {
+	seconds int
+	changes int
+}
+
+// parseSaveRules parses the save configuration: a list of "<seconds>
+// <changes>" pairs, where an empty list disables automatic saves.
+func parseSaveRules(rules string) ([]saveRule, error) {
+	fields := strings.Fields(rules)
+	if len(fields)%2 != 0 {
+		return nil, errInvalidSaveRules
+	}
+
+	parsed := make([]saveRule, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err := strconv.Atoi(fields[i])
+		if err != nil || seconds < 1 {
+			return nil, errInvalidSaveRules
+		}
+
+		changes, err := strconv.Atoi(fields[i+1])
+		if err != nil || changes < 0 {
+			return nil, errInvalidSaveRules
+		}
+
+		parsed = append(parsed, saveRule{seconds: seconds, changes: changes})
+	}
+
+	return parsed, nil
+}
+
+func formatSaveRules(rules []saveRule) string {
+	fields := make([]string, 0, len(rules)*2)
+	for _, rule := range rules {
+		fields = append(fields, strconv.Itoa(rule.seconds), strconv.Itoa(rule.changes))
+	}
+	return strings.Join(fields, " ")
+}
+
+// saveCron starts a background save whenever one of the save rules is
+// satisfied or one was scheduled, and likewise rewrites the append-only
+// file.
+func (s *server) saveCron() {
+	ticker := time.NewTicker(saveCronInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if s.shouldAutoSave(time.Now()) {
+			s.execMu.Lock()
+			_, err := s.bgsaveRDB(false)
+			s.execMu.Unlock()
+
+			if err != nil {
+				fmt.Println("Failed starting background save: ", err)
+			}
+		}
+
+		if s.shouldAutoRewrite() {
+			s.execMu.Lock()
+			_, err := s.bgrewriteAppendOnlyFile()
+			s.execMu.Unlock()
+
+			if err != nil {
+				fmt.Println("Failed starting background AOF rewrite: ", err)
+			}
+		}
+	}
+}
+
+func (s *server) shouldAutoSave(now time.Time) bool {
+	p := s.persistence
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.bgsaveInProgress || p.aofRewriteInProgress {
+		return false
+	}
+	if p.bgsaveScheduled {
+		return true
+	}
+
+	// After a failure, wait before retrying so that a persistent error, such
+	// as a full disk, does not turn into a save loop.
+	if !p.lastBgsaveOk && now.Sub(p.lastBgsaveTry) < bgsaveRetryDelay {
+		return false
+	}
+
+	dirty := p.dirty.Load()
+	for _, rule := range *s.saveRules.Load() {
+		if dirty >= int64(rule.changes) && now.Sub(p.lastSave) > time.Duration(rule.seconds)*time.Second {
+			return true
+		}
+	}
+
+	return false
+}
@@ -18,18 +18,48 @@ type server struct {
 	slaves   []net.Conn
 	slavesMu *sync.Mutex
 	ackChan  chan bool
-	streams  *Streams
+	// volatileKeys holds the keys that may have a TTL, or hash fields with
+	// one, for the active expire cycle to sample. Keys are dropped by the
+	// cycle once they have none. Guarded by dataMu.
+	volatileKeys map[string]struct{}
+	// streams holds the stream keys. Like data, they are guarded by dataMu,
+	// down to their entries and consumer groups.
+	streams *Streams
+	// watchedKeys maps every watched key to the clients watching it.
+	watchedKeys map[string][]*Client
+	watchMu     *sync.Mutex
+	// execMu is held shared by every command and exclusively by EXEC, which
+	// makes transactions atomic.
+	execMu *sync.RWMutex
+	pubsub *pubSub
+	// keyspaceEvents queues keyspace notifications until dataMu is
+	// released.
+	keyspaceEvents *keyspaceEvents
+	// persistence tracks RDB saves.
+	persistence *persistence
+	aof         *appendOnlyFile
+	// migrateConns caches the connections opened by MIGRATE.
+	migrateConns *migrateConns
 }
 
 func newServer(config *serverConfig) server {
 	return server{
-		serverConfig: config,
-		data:         make(map[string]*storage.ExpiringValue),
-		dataMu:       &sync.RWMutex{},
-		slaves:       []net.Conn{},
-		slavesMu:     &sync.Mutex{},
-		ackChan:      make(chan bool),
-		streams:      NewStreams(),
+		serverConfig:   config,
+		data:           make(map[string]*storage.ExpiringValue),
+		dataMu:         &sync.RWMutex{},
+		volatileKeys:   make(map[string]struct{}),
+		slaves:         []net.Conn{},
+		slavesMu:       &sync.Mutex{},
+		ackChan:        make(chan bool),
+		streams:        NewStreams(),
+		watchedKeys:    make(map[string][]*Client),
+		watchMu:        &sync.Mutex{},
+		execMu:         &sync.RWMutex{},
+		pubsub:         newPubSub(),
+		keyspaceEvents: newKeyspaceEvents(),
+		persistence:    newPersistence(),
+		aof:            newAppendOnlyFile(),
+		migrateConns:   newMigrateConns(),
 	}
 }
 
@@ -42,6 +72,22 @@ func (s *server) isSlave() bool {
 }
 
 func (s *server) start() {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Clients are accepted while the dataset is loaded, and told to retry
+	// until it is. A file that can not be loaded is left alone for
+	// inspection, rather than replaced with an empty dataset by the next
+	// save.
+	s.persistence.loading.Store(true)
+	go s.serve(ln)
+
+	if err := s.loadDataFromDisk(); err != nil {
+		log.Fatalf("error loading data: %v", err)
+	}
+
 	if s.isSlave() {
 		masterConn, err := s.doHandshakeWithMaster()
 		if err != nil {
@@ -49,17 +95,47 @@ func (s *server) start() {
 			return
 		}
 
-		go s.handleClient(masterConn)
+		master := NewClient(masterConn)
+		master.isMasterLink = true
+		go s.handleClient(master)
+	} else {
+		go s.activeExpireCycle()
 	}
 
-	log.Fatal(s.listenAndServe())
+	go s.saveCron()
+	go s.aofFsyncCron()
 }
 
-func (s *server) listenAndServe() error {
-	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
-	if err != nil {
+// loadDataFromDisk loads the append-only file if it is enabled, as it is
+// more up to date than the RDB file, and the RDB file otherwise. As in
+// Redis, the RDB file is ignored when the append-only file is enabled but
+// does not exist yet. The append-only file is then opened to log writes.
+func (s *server) loadDataFromDisk() error {
+	defer s.persistence.loading.Store(false)
+
+	s.persistence.mu.Lock()
+	s.persistence.loadingStart = time.Now()
+	if s.appendOnly.Load() {
+		s.persistence.loadProgress = s.aof.loadProgress
+	} else {
+		s.persistence.loadProgress = s.rdbFile.LoadProgress
+	}
+	s.persistence.mu.Unlock()
+
+	if !s.appendOnly.Load() {
+		return s.loadRDB(s.rdbFile)
+	}
+
+	if err := s.loadAppendOnlyFile(); err != nil {
 		return err
 	}
+	// Replayed commands are already on disk.
+	s.persistence.dirty.Store(0)
+
+	return s.openAppendOnlyFile()
+}
+
+func (s *server) serve(ln net.Listener) {
 	defer ln.Close()
 
 	for {
@@ -69,84 +145,99 @@ func (s *server) listenAndServe() error {
 			continue
 		}
 
-		go s.handleClient(conn)
+		go s.handleClient(NewClient(conn))
 	}
 }
 
-func (s *server) handleClient(conn net.Conn) {
-	client := NewClient(conn)
+func (s *server) handleClient(client *Client) {
 	defer client.Close()
+	defer s.unwatchAllKeys(client)
+	defer s.pubsub.unsubscribeAll(client)
 
 	buf := make([]byte, 1024)
+	var pending []byte
 	for {
 		n, err := client.Conn.Read(buf)
-		if err != nil && err != io.EOF {
-			fmt.Println("Error reading from conn: ", err)
-			continue
+		if err != nil {
+			if err != io.EOF {
+				fmt.Println("Error reading from conn: ", err)
+			}
+			return
 		}
 
-		msgBuf := make([]byte, n)
-		copy(msgBuf, buf[:n])
-		s.handleRawMessage(client, msgBuf)
+		pending = append(pending, buf[:n]...)
+		consumed, err := s.handleRawMessage(client, pending)
+		if err != nil {
+			// No more data can complete a malformed frame, so the
+			// connection is dropped, as Redis does, after telling the
+			// client why.
+			fmt.Println("Protocol error from client: ", err)
+			client.Write(respAsError(err.Error()))
+			return
+		}
+		pending = pending[consumed:]
 	}
 }
 
-func (s *server) handleRawMessage(client *Client, msgBuf []byte) error {
-	cmds := parseRawMessage(msgBuf)
+// handleRawMessage handles every complete command in msgBuf and returns the
+// number of bytes consumed. Commands preceding a malformed one are handled
+// before its error is returned.
+func (s *server) handleRawMessage(client *Client, msgBuf []byte) (int, error) {
+	cmds, consumed, parseErr := parseRawMessage(msgBuf)
 
 	for _, command := range cmds {
-		err := s.handleCommand(client, command)
+		var err error
+		switch {
+		case command.payload == nil:
+			err = s.handleCommand(client, command)
+		case client.isMasterLink:
+			err = s.loadMasterRDB(command.payload)
+		}
 		if err != nil {
 			fmt.Println("cmd error: ", err)
 		}
 	}
 
-	return nil
-}
-
-func (s *server) loadRDB() (bool, error) {
-	err := s.rdbFile.Load()
-	if err != nil {
-		return false, err
-	}
-
-	s.dataMu.Lock()
-	now := time.Now().UTC()
-	for _, db := range s.rdbFile.DBs {
-		for key, rdbObj := range db.Data {
-			var expiresIn int
-			if rdbObj.Exp != nil {
-				expiresIn = int(rdbObj.Exp.Sub(now).Milliseconds())
-			}
-			s.data[key] = &storage.ExpiringValue{
-				Val:       rdbObj.Val,
-				Created:   now,
-				ExpiresIn: expiresIn,
-			}
-		}
-	}
-	s.dataMu.Unlock()
-
-	return true, nil
+	return consumed, parseErr
 }
 
 func (s *server) getKeys() []string {
 	s.dataMu.RLock()
 	defer s.dataMu.RUnlock()
 
-	keys := make([]string, 0, len(s.data))
+	keys := make([]string, 0, len(s.data)+len(s.streams.Streams))
 	for key := range s.data {
 		keys = append(keys, key)
 	}
+	for key := range s.streams.Streams {
+		keys = append(keys, key)
+	}
 	return keys
 }
 
-func (s *server) findStream(key string) *Stream {
-	for _, str := range s.streams.Streams {
-		if str.Key == key {
-			return str
-		}
+// findStream returns the stream at key, or nil if the key does not exist.
+// Streams are part of the keyspace, so callers must hold dataMu.
+func (s *server) findStream(key string) (*Stream, error) {
+	if _, ok := s.data[key]; ok && !s.expireIfNeeded(key) {
+		return nil, errWrongType
+	}
+
+	return s.streams.Streams[key], nil
+}
+
+// isStream reports whether key holds a stream. Callers must hold dataMu.
+func (s *server) isStream(key string) bool {
+	_, ok := s.streams.Streams[key]
+	return ok
+}
+
+// deleteStream removes the stream at key and reports whether there was one.
+// Callers must hold dataMu.
+func (s *server) deleteStream(key string) bool {
+	if !s.isStream(key) {
+		return false
 	}
 
-	return nil
+	delete(s.streams.Streams, key)
+	return true
 }
@@ -3,8 +3,11 @@ package main
 import (
 	"errors"
 	"flag"
+	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/rdb"
 )
@@ -17,13 +20,49 @@ type serverConfig struct {
 	masterReplOffset int
 	role             ServerRole
 	rdbFile          *rdb.RDBFile
+	// notifyKeyspaceEvents holds the classes of keyspace events to publish,
+	// and may be changed at runtime with CONFIG SET.
+	notifyKeyspaceEvents atomic.Int32
+	// saveRules holds the rules triggering automatic saves, and may be
+	// changed at runtime with CONFIG SET.
+	saveRules atomic.Pointer[[]saveRule]
+	// rdbChecksum tells whether RDB files are saved with a CRC64 checksum,
+	// and whether it is verified when loading them.
+	rdbChecksum atomic.Bool
+	// appendOnly enables the append-only file, which is then loaded at
+	// startup instead of the RDB file. Enabling it at runtime rewrites the
+	// file from the dataset.
+	appendOnly atomic.Bool
+	// appendDirname is the directory, within dir, holding the files of the
+	// append-only file and their manifest, named after appendFilename.
+	appendDirname  string
+	appendFilename string
+	appendFsync    atomic.Int32
+	// aofLoadTruncated tells whether an append-only file whose last command
+	// is cut short is loaded anyway.
+	aofLoadTruncated atomic.Bool
+	// The append-only file is rewritten automatically once it grew by
+	// autoAofRewritePercentage percent since the last rewrite, if it is at
+	// least autoAofRewriteMinSize bytes. A percentage of 0 disables it.
+	autoAofRewritePercentage atomic.Int64
+	autoAofRewriteMinSize    atomic.Int64
 }
 
 func newServerConfig() (*serverConfig, error) {
 	port := flag.Int("port", 6379, "Server port number")
 	replicaOf := flag.String("replicaof", "", "<MASTER_HOST> <MASTER_PORT>")
 	rdbFileDir := flag.String("dir", "", "RDB file dir")
-	rdbFileName := flag.String("dbfilename", "", "RDB file name")
+	rdbFileName := flag.String("dbfilename", "dump.rdb", "RDB file name")
+	notifyKeyspaceEvents := flag.String("notify-keyspace-events", "", "Classes of keyspace events to publish")
+	save := flag.String("save", defaultSaveRules, "Save rules, as \"<seconds> <changes>\" pairs")
+	rdbChecksum := flag.String("rdbchecksum", "yes", "Whether RDB files carry a CRC64 checksum (yes or no)")
+	appendOnly := flag.String("appendonly", "no", "Whether writes are logged to the append-only file (yes or no)")
+	appendFilename := flag.String("appendfilename", "appendonly.aof", "Append-only file name")
+	appendDirname := flag.String("appenddirname", "appendonlydir", "Append-only file directory, within dir")
+	appendFsync := flag.String("appendfsync", "everysec", "When the append-only file is synced to disk (always, everysec or no)")
+	aofLoadTruncated := flag.String("aof-load-truncated", "yes", "Whether a truncated append-only file is loaded (yes or no)")
+	autoAofRewritePercentage := flag.String("auto-aof-rewrite-percentage", "100", "Growth of the append-only file triggering a rewrite, in percent")
+	autoAofRewriteMinSize := flag.String("auto-aof-rewrite-min-size", "64mb", "Minimum size of the append-only file for an automatic rewrite")
 	flag.Parse()
 
 	config := &serverConfig{
@@ -36,6 +75,64 @@ func newServerConfig() (*serverConfig, error) {
 		return nil, err
 	}
 
+	classes, err := parseNotifyKeyspaceEvents(*notifyKeyspaceEvents)
+	if err != nil {
+		return nil, err
+	}
+	config.notifyKeyspaceEvents.Store(int32(classes))
+
+	saveRules, err := parseSaveRules(*save)
+	if err != nil {
+		return nil, err
+	}
+	config.saveRules.Store(&saveRules)
+
+	checksum, err := parseYesNo(*rdbChecksum)
+	if err != nil {
+		return nil, err
+	}
+	config.rdbChecksum.Store(checksum)
+
+	enabled, err := parseYesNo(*appendOnly)
+	if err != nil {
+		return nil, err
+	}
+	config.appendOnly.Store(enabled)
+
+	if err := checkFilename(*appendFilename); err != nil {
+		return nil, fmt.Errorf("appendfilename %w", err)
+	}
+	config.appendFilename = *appendFilename
+
+	if err := checkFilename(*appendDirname); err != nil {
+		return nil, fmt.Errorf("appenddirname %w", err)
+	}
+	config.appendDirname = *appendDirname
+
+	policy, err := parseAppendFsync(*appendFsync)
+	if err != nil {
+		return nil, err
+	}
+	config.appendFsync.Store(int32(policy))
+
+	loadTruncated, err := parseYesNo(*aofLoadTruncated)
+	if err != nil {
+		return nil, err
+	}
+	config.aofLoadTruncated.Store(loadTruncated)
+
+	percentage, err := parsePercentage(*autoAofRewritePercentage)
+	if err != nil {
+		return nil, err
+	}
+	config.autoAofRewritePercentage.Store(percentage)
+
+	minSize, err := parseMemory(*autoAofRewriteMinSize)
+	if err != nil {
+		return nil, err
+	}
+	config.autoAofRewriteMinSize.Store(minSize)
+
 	return config, nil
 }
 
@@ -67,3 +164,81 @@ func (c *serverConfig) parseReplicaOf(replicaOf string) error {
 
 	return nil
 }
+
+var errYesNo = errors.New("argument must be 'yes' or 'no'")
+
+// parseYesNo parses the value of a boolean parameter.
+func parseYesNo(val string) (bool, error) {
+	switch strings.ToLower(val) {
+	case "yes":
+		return true, nil
+	case "no":
+		return false, nil
+	default:
+		return false, errYesNo
+	}
+}
+
+func formatYesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+var errFilename = errors.New("can't be a path, just a filename")
+
+// checkFilename rejects names of files that would not end up in dir.
+func checkFilename(name string) error {
+	if len(name) == 0 || name == "." || name == ".." || strings.ContainsAny(name, "/\\") {
+		return errFilename
+	}
+	return nil
+}
+
+var errPercentage = errors.New("argument must be a positive integer")
+
+func parsePercentage(val string) (int64, error) {
+	percentage, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || percentage < 0 {
+		return 0, errPercentage
+	}
+	return percentage, nil
+}
+
+var errMemory = errors.New("argument must be a memory value")
+
+// memoryUnits are the suffixes allowed in memory values, as in Redis
+// configuration files.
+var memoryUnits = []struct {
+	suffix string
+	bytes  int64
+}{
+	{"kb", 1 << 10},
+	{"mb", 1 << 20},
+	{"gb", 1 << 30},
+	{"k", 1000},
+	{"m", 1000 * 1000},
+	{"g", 1000 * 1000 * 1000},
+	{"b", 1},
+}
+
+// parseMemory parses a number of bytes, optionally followed by a unit such
+// as "mb".
+func parseMemory(val string) (int64, error) {
+	val = strings.ToLower(val)
+
+	mul := int64(1)
+	for _, unit := range memoryUnits {
+		if strings.HasSuffix(val, unit.suffix) {
+			val, mul = strings.TrimSuffix(val, unit.suffix), unit.bytes
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(val, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/mul {
+		return 0, errMemory
+	}
+	return n * mul, nil
+}
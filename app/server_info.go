@@ -2,12 +2,14 @@ package main
 
 import (
 	"fmt"
+	"time"
 )
 
 type ServerInfoSection string
 
 const (
-	replication ServerInfoSection = "replication"
+	replication        ServerInfoSection = "replication"
+	persistenceSection ServerInfoSection = "persistence"
 )
 
 func (s *server) replicationInfo() []string {
@@ -25,3 +27,104 @@ func (s *server) replicationInfo() []string {
 
 	return info
 }
+
+func (s *server) persistenceInfo() []string {
+	p := s.persistence
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	bgsaveInProgress := 0
+	if p.bgsaveInProgress {
+		bgsaveInProgress = 1
+	}
+
+	aofEnabled := 0
+	if s.appendOnly.Load() {
+		aofEnabled = 1
+	}
+
+	aofRewriteInProgress, aofCurrentRewriteTime := 0, -1
+	if p.aofRewriteInProgress {
+		aofRewriteInProgress = 1
+		aofCurrentRewriteTime = int(time.Since(p.aofRewriteStart).Seconds())
+	}
+
+	aofRewriteScheduled := 0
+	if p.aofRewriteScheduled {
+		aofRewriteScheduled = 1
+	}
+
+	aofLastBgrewriteStatus := "ok"
+	if !p.lastAofRewriteOk {
+		aofLastBgrewriteStatus = "err"
+	}
+
+	s.aof.mu.Lock()
+	aofLastWriteStatus := "ok"
+	if !s.aof.lastWriteOk {
+		aofLastWriteStatus = "err"
+	}
+	aofCurrentSize, aofBaseSize := s.aof.currentSize, s.aof.baseSize
+	s.aof.mu.Unlock()
+
+	loading := 0
+	if p.loading.Load() {
+		loading = 1
+	}
+
+	lastBgsaveStatus := "ok"
+	if !p.lastBgsaveOk {
+		lastBgsaveStatus = "err"
+	}
+
+	info := []string{
+		fmt.Sprintf("loading:%d", loading),
+	}
+
+	// The progress is only reported while loading, and the time left
+	// extrapolated from the rate so far.
+	if loading == 1 {
+		loaded, total := p.loadProgress()
+		elapsed := time.Since(p.loadingStart).Seconds()
+
+		var perc float64
+		if total > 0 {
+			perc = float64(loaded) / float64(total) * 100
+		}
+
+		eta := 1
+		if loaded > 0 {
+			eta = int(float64(total-loaded) / (float64(loaded) / elapsed))
+		}
+
+		info = append(info,
+			fmt.Sprintf("loading_start_time:%d", p.loadingStart.Unix()),
+			fmt.Sprintf("loading_total_bytes:%d", total),
+			fmt.Sprintf("loading_loaded_bytes:%d", loaded),
+			fmt.Sprintf("loading_loaded_perc:%.2f", perc),
+			fmt.Sprintf("loading_eta_seconds:%d", eta),
+		)
+	}
+
+	info = append(info,
+		fmt.Sprintf("rdb_changes_since_last_save:%d", p.dirty.Load()),
+		fmt.Sprintf("rdb_bgsave_in_progress:%d", bgsaveInProgress),
+		fmt.Sprintf("rdb_last_save_time:%d", p.lastSave.Unix()),
+		fmt.Sprintf("rdb_last_bgsave_status:%s", lastBgsaveStatus),
+		fmt.Sprintf("aof_enabled:%d", aofEnabled),
+		fmt.Sprintf("aof_rewrite_in_progress:%d", aofRewriteInProgress),
+		fmt.Sprintf("aof_rewrite_scheduled:%d", aofRewriteScheduled),
+		fmt.Sprintf("aof_current_rewrite_time_sec:%d", aofCurrentRewriteTime),
+		fmt.Sprintf("aof_last_bgrewrite_status:%s", aofLastBgrewriteStatus),
+		fmt.Sprintf("aof_last_write_status:%s", aofLastWriteStatus),
+	)
+
+	if aofEnabled == 1 {
+		info = append(info,
+			fmt.Sprintf("aof_current_size:%d", aofCurrentSize),
+			fmt.Sprintf("aof_base_size:%d", aofBaseSize),
+		)
+	}
+
+	return info
+}
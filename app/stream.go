@@ -4,196 +4,253 @@ import (
 	"errors"
 	"strconv"
 	"strings"
-	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/rax"
 )
 
 var (
 	ErrInvalidStreamEntrId                    = errors.New("is invalid")
 	ErrStreamEntryIdSmallerThanZero           = errors.New("must be greater than 0-0")
 	ErrStreamEntryIdEqualOrSmallerThanTopItem = errors.New("is equal or smaller than the target stream top item")
-	ErrInvalidStartIndex                      = errors.New("invalid start index")
-	ErrInvalidEndIndex                        = errors.New("invalid end index")
+	ErrInvalidStartIndex                      = errors.New("invalid start ID for the interval")
+	ErrInvalidEndIndex                        = errors.New("invalid end ID for the interval")
+	ErrInvalidStreamIdArg                     = errors.New("Invalid stream ID specified as stream command argument")
+	ErrStreamExhausted                        = errors.New("The stream has exhausted the last possible ID, unable to add more items")
 )
 
 type Stream struct {
-	Key     string
-	Entries []*StreamEntry
+	Key string
+	// index maps the master ID of every node to the node itself.
+	index  *rax.Tree
+	length int
+	// LastId is the ID of the last entry ever added, which may since have
+	// been deleted or trimmed away.
+	LastId            *StreamEntryId
+	EntriesAdded      int
+	MaxDeletedEntryId *StreamEntryId
+	Groups            map[string]*StreamConsumerGroup
 }
 
 func NewStream(key string) *Stream {
 	return &Stream{
-		Key:     key,
-		Entries: make([]*StreamEntry, 0),
+		Key:    key,
+		index:  rax.New(),
+		Groups: make(map[string]*StreamConsumerGroup),
 	}
 }
 
 func (s *Stream) AddEntry(entry *StreamEntry) {
-	s.Entries = append(s.Entries, entry)
-}
+	var node *streamNode
+	if _, last, ok := s.index.Last(); ok {
+		node = last.(*streamNode)
+	}
 
-func (s *Stream) isEmpty() bool {
-	return len(s.Entries) == 0
-}
+	if node == nil || node.isFull() {
+		node = newStreamNode(*entry.ID, entry.Fields)
+		s.index.Insert(entry.ID.raxKey(), node)
+	}
 
-func (s *Stream) lastEntry() *StreamEntry {
-	return s.Entries[len(s.Entries)-1]
+	node.append(*entry.ID, entry.Fields, entry.Values)
+
+	s.length++
+	s.LastId = entry.ID
+	s.EntriesAdded++
 }
 
-func (s *Stream) findEntryByMillis(millis int) *StreamEntry {
-	for _, entry := range s.Entries {
-		if entry.ID.MillisTime == millis {
-			return entry
+// DeleteEntry removes the entry with the given ID and reports whether it
+// existed. Deleted IDs are accounted for in MaxDeletedEntryId.
+func (s *Stream) DeleteEntry(id *StreamEntryId) bool {
+	key, val, ok := s.index.Floor(id.raxKey())
+	if !ok {
+		return false
+	}
+
+	node := val.(*streamNode)
+	for _, e := range node.entries() {
+		if e.deleted || e.id.Compare(id) != 0 {
+			continue
+		}
+
+		node.markDeleted(e)
+		if node.count() == 0 {
+			s.index.Remove(key)
+		}
+		s.length--
+
+		if s.MaxDeletedEntryId == nil || s.MaxDeletedEntryId.Compare(id) < 0 {
+			deletedId := e.id
+			s.MaxDeletedEntryId = &deletedId
 		}
+
+		return true
 	}
 
-	return nil
+	return false
 }
 
-func (s *Stream) findEntries(start, end *string) ([]*StreamEntry, error) {
-	if s.isEmpty() {
-		return s.Entries, nil
-	}
+func (s *Stream) Len() int {
+	return s.length
+}
 
-	var startMillis *int
-	var startSeqNr *int
+func (s *Stream) isEmpty() bool {
+	return s.length == 0
+}
 
-	var endMillis *int
-	var endSeqNr *int
+func (s *Stream) firstEntry() *StreamEntry {
+	entries := s.rangeEntries(&minStreamEntryId, &maxStreamEntryId, 1, false)
+	if len(entries) == 0 {
+		return nil
+	}
+	return entries[0]
+}
 
-	updateStartMillis := func() error {
-		startMs, startNr, err := parseStreamEntryId(*start)
-		if err != nil {
-			return err
-		}
-		startMillis = startMs
-		startSeqNr = startNr
+func (s *Stream) lastEntry() *StreamEntry {
+	entries := s.rangeEntries(&minStreamEntryId, &maxStreamEntryId, 1, true)
+	if len(entries) == 0 {
 		return nil
 	}
+	return entries[0]
+}
 
-	updateEndMillis := func() error {
-		endMs, endNr, err := parseStreamEntryId(*end)
-		if err != nil {
-			return err
-		}
-		endMillis = endMs
-		endSeqNr = endNr
+func (s *Stream) firstEntryId() *StreamEntryId {
+	entry := s.firstEntry()
+	if entry == nil {
 		return nil
 	}
+	return entry.ID
+}
 
-	if start == nil || *start == "-" {
-		err := updateEndMillis()
-		if err != nil {
-			return nil, err
-		}
-	} else if end == nil || *end == "+" {
-		err := updateStartMillis()
-		if err != nil {
-			return nil, err
-		}
-	} else {
-		err := updateStartMillis()
+// radixTreeStats reports the number of keys and nodes of the radix tree
+// indexing the stream.
+func (s *Stream) radixTreeStats() (keys int, nodes int) {
+	return s.index.Len(), s.index.NodeCount()
+}
+
+func (s *Stream) findEntry(id *StreamEntryId) *StreamEntry {
+	entries := s.rangeEntries(id, id, 1, false)
+	if len(entries) == 0 {
+		return nil
+	}
+	return entries[0]
+}
+
+// entriesAfter returns up to count entries with an ID greater than id. A
+// count of 0 means no limit.
+func (s *Stream) entriesAfter(id *StreamEntryId, count int) []*StreamEntry {
+	start, ok := id.next()
+	if !ok {
+		return []*StreamEntry{}
+	}
+	return s.rangeEntries(start, &maxStreamEntryId, count, false)
+}
+
+// findEntries returns the entries between the inclusive start and end IDs
+// given as command arguments. A nil start or end leaves that side of the
+// range open.
+func (s *Stream) findEntries(start, end *string) ([]*StreamEntry, error) {
+	startId, endId := minStreamEntryId, maxStreamEntryId
+
+	if start != nil {
+		id, err := parseStreamRangeBound(*start, true)
 		if err != nil {
 			return nil, err
 		}
-		err = updateEndMillis()
+		startId = *id
+	}
+
+	if end != nil {
+		id, err := parseStreamRangeBound(*end, false)
 		if err != nil {
 			return nil, err
 		}
+		endId = *id
 	}
 
-	result := make([]*StreamEntry, 0, len(s.Entries))
-
-	for _, entry := range s.Entries {
-		entryIdMillis := entry.ID.MillisTime
-		entryIdSeqNr := entry.ID.SequenceNr
+	return s.rangeEntries(&startId, &endId, 0, false), nil
+}
 
-		startMillisEquality := func() bool {
-			if entryIdMillis == *startMillis {
-				if entryIdSeqNr >= *startSeqNr {
-					result = append(result, entry)
-				}
-				return true
-			}
-			return false
-		}
+// rangeEntries returns up to count entries with IDs between start and end,
+// both inclusive, in ascending order or in descending order if reverse is
+// set. A count of 0 means no limit.
+//
+// The node holding start (or end, in reverse) is found with a single seek in
+// the radix tree, after which nodes are visited in order until the range or
+// count is exhausted.
+func (s *Stream) rangeEntries(start, end *StreamEntryId, count int, reverse bool) []*StreamEntry {
+	result := make([]*StreamEntry, 0)
+	if start.Compare(end) > 0 {
+		return result
+	}
 
-		endMillisEquality := func() bool {
-			if entryIdMillis == *endMillis {
-				if entryIdSeqNr <= *endSeqNr {
-					result = append(result, entry)
-				}
-				return true
-			}
-			return false
+	if !reverse {
+		key, val, ok := s.index.Floor(start.raxKey())
+		if !ok {
+			key, val, ok = s.index.First()
 		}
 
-		if startMillis == nil {
-			if entryIdMillis < *endMillis {
-				result = append(result, entry)
-				continue
+		for ; ok; key, val, ok = s.index.Higher(key) {
+			node := val.(*streamNode)
+			if node.masterId.Compare(end) > 0 {
+				break
 			}
 
-			endMillisEquality()
+			for _, e := range node.entries() {
+				if e.deleted || e.id.Compare(start) < 0 {
+					continue
+				}
+				if e.id.Compare(end) > 0 {
+					return result
+				}
 
-			continue
+				result = append(result, node.read(e))
+				if count > 0 && len(result) >= count {
+					return result
+				}
+			}
 		}
 
-		if endMillis == nil {
-			if entryIdMillis > *startMillis {
-				result = append(result, entry)
-				continue
-			}
+		return result
+	}
 
-			startMillisEquality()
+	for key, val, ok := s.index.Floor(end.raxKey()); ok; key, val, ok = s.index.Lower(key) {
+		node := val.(*streamNode)
+		entries := node.entries()
 
-			continue
-		}
-
-		if startMillis != nil && endMillis != nil {
-			if entryIdMillis > *startMillis && entryIdMillis < *endMillis {
-				result = append(result, entry)
+		for i := len(entries) - 1; i >= 0; i-- {
+			e := entries[i]
+			if e.deleted || e.id.Compare(end) > 0 {
 				continue
 			}
-
-			if startMillisEquality() {
-				continue
+			if e.id.Compare(start) < 0 {
+				return result
 			}
 
-			if endMillisEquality() {
-				continue
+			result = append(result, node.read(e))
+			if count > 0 && len(result) >= count {
+				return result
 			}
 		}
 	}
 
-	return result, nil
-}
-
-func (s *Stream) findEntriesNewerThan(t time.Time) []*StreamEntry {
-	result := make([]*StreamEntry, 0, len(s.Entries))
-	for _, entry := range s.Entries {
-		if entry.Created.After(t) {
-			result = append(result, entry)
-		}
-	}
 	return result
 }
 
-func parseStreamEntryId(id string) (millis *int, seqNr *int, err error) {
+func parseStreamEntryId(id string) (millis *uint64, seqNr *uint64, err error) {
 	pieces := strings.Split(id, "-")
 
 	if len(pieces) > 2 {
 		return nil, nil, ErrInvalidStreamEntrId
 	}
 
-	ms, err := strconv.Atoi(pieces[0])
+	ms, err := strconv.ParseUint(pieces[0], 10, 64)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	var nr *int
+	var nr *uint64
 
 	if len(pieces) == 2 {
-		n, err := strconv.Atoi(pieces[1])
+		n, err := strconv.ParseUint(pieces[1], 10, 64)
 		if err != nil {
 			return nil, nil, err
 		}
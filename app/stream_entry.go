@@ -1,15 +1,14 @@
 package main
 
-import (
-	"sync"
-	"time"
-)
-
+// StreamEntry is a decoded stream entry. Entries are stored encoded in the
+// nodes of their stream and only materialized when they are added or read.
+//
+// Fields and Values hold the field-value pairs in the order they were added.
+// As in Redis, a field name may appear more than once.
 type StreamEntry struct {
-	ID      *StreamEntryId
-	Data    map[string]string
-	Created time.Time
-	dataMu  *sync.Mutex
+	ID     *StreamEntryId
+	Fields []string
+	Values []string
 }
 
 func (s *Stream) NewStreamEntry(id string) (*StreamEntry, error) {
@@ -19,25 +18,20 @@ func (s *Stream) NewStreamEntry(id string) (*StreamEntry, error) {
 	}
 
 	return &StreamEntry{
-		ID:      entryId,
-		Data:    make(map[string]string),
-		Created: time.Now().UTC(),
-		dataMu:  &sync.Mutex{},
+		ID: entryId,
 	}, nil
 }
 
 func (e *StreamEntry) AddData(key, val string) {
-	e.dataMu.Lock()
-	defer e.dataMu.Unlock()
-
-	e.Data[key] = val
+	e.Fields = append(e.Fields, key)
+	e.Values = append(e.Values, val)
 }
 
 func (e *StreamEntry) encodeToResp() ([]byte, error) {
-	vals := make([]string, 0, len(e.Data)*2)
-	for key, val := range e.Data {
-		vals = append(vals, key)
-		vals = append(vals, val)
+	vals := make([]string, 0, len(e.Fields)*2)
+	for i := range e.Fields {
+		vals = append(vals, e.Fields[i])
+		vals = append(vals, e.Values[i])
 	}
 
 	valsResp, err := respAsArray(vals)
@@ -52,3 +46,20 @@ func (e *StreamEntry) encodeToResp() ([]byte, error) {
 
 	return respAsByteArrays(entryBytes)
 }
+
+// encodeEntriesToResp encodes entries as an array of [id, [field, value ...]]
+// pairs, the reply format shared by the stream range and read commands.
+func encodeEntriesToResp(entries []*StreamEntry) ([]byte, error) {
+	entriesBytes := make([][]byte, 0, len(entries))
+
+	for _, entry := range entries {
+		entryBytesResp, err := entry.encodeToResp()
+		if err != nil {
+			return nil, err
+		}
+
+		entriesBytes = append(entriesBytes, entryBytesResp)
+	}
+
+	return respAsByteArrays(entriesBytes)
+}
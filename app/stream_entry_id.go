@@ -2,78 +2,214 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// StreamEntryId is a 128-bit stream ID made of a millisecond timestamp and a
+// sequence number, both unsigned 64-bit integers.
 type StreamEntryId struct {
-	MillisTime int
-	SequenceNr int
+	MillisTime uint64
+	SequenceNr uint64
 }
 
-func (s *Stream) NewStreamEntryId(id string) (*StreamEntryId, error) {
-	var millisTime int
-	var sequenceNr int
+var (
+	minStreamEntryId = StreamEntryId{MillisTime: 0, SequenceNr: 0}
+	maxStreamEntryId = StreamEntryId{MillisTime: math.MaxUint64, SequenceNr: math.MaxUint64}
+)
 
+// NewStreamEntryId resolves the ID given to XADD, which is either "*", a
+// "<ms>-*" with an automatic sequence number or an explicit "<ms>-<seq>", and
+// checks it is greater than the last ID of the stream.
+func (s *Stream) NewStreamEntryId(id string) (*StreamEntryId, error) {
 	if id == "*" {
-		millisTime = int(time.Now().UTC().UnixMilli())
-		sequenceNr = 0
-	} else {
-		pieces := strings.Split(id, "-")
-
-		if len(pieces) != 2 {
-			return nil, ErrInvalidStreamEntrId
-		}
-
-		ms, err := strconv.Atoi(pieces[0])
-		if err != nil {
-			return nil, ErrInvalidStreamEntrId
-		}
-		millisTime = ms
-
-		if pieces[1] == "*" {
-			if s.isEmpty() {
-				sequenceNr = 1
-			} else {
-				matchingEntry := s.findEntryByMillis(millisTime)
-				if matchingEntry == nil {
-					sequenceNr = 0
-				} else {
-					sequenceNr = matchingEntry.ID.SequenceNr + 1
-				}
-			}
-		} else {
-			nr, err := strconv.Atoi(pieces[1])
-			if err != nil {
-				return nil, ErrInvalidStreamEntrId
-			}
-			sequenceNr = nr
-		}
+		return s.nextAutoId(uint64(time.Now().UTC().UnixMilli()))
+	}
 
-		if millisTime <= 0 && sequenceNr <= 0 {
-			return nil, ErrStreamEntryIdSmallerThanZero
-		}
+	pieces := strings.Split(id, "-")
+	if len(pieces) > 2 {
+		return nil, ErrInvalidStreamEntrId
+	}
 
-		if !s.isEmpty() {
-			lastEntryId := s.lastEntry().ID
+	millisTime, err := strconv.ParseUint(pieces[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidStreamEntrId
+	}
 
-			if lastEntryId.MillisTime > millisTime {
-				return nil, ErrStreamEntryIdEqualOrSmallerThanTopItem
-			}
+	var sequenceNr uint64
 
-			if lastEntryId.MillisTime == millisTime && lastEntryId.SequenceNr >= sequenceNr {
+	switch {
+	case len(pieces) == 1:
+	case pieces[1] == "*":
+		switch {
+		case s.LastId != nil && s.LastId.MillisTime > millisTime:
+			return nil, ErrStreamEntryIdEqualOrSmallerThanTopItem
+		case s.LastId != nil && s.LastId.MillisTime == millisTime:
+			if s.LastId.SequenceNr == math.MaxUint64 {
 				return nil, ErrStreamEntryIdEqualOrSmallerThanTopItem
 			}
+			sequenceNr = s.LastId.SequenceNr + 1
+		case millisTime == 0:
+			sequenceNr = 1
+		}
+	default:
+		sequenceNr, err = strconv.ParseUint(pieces[1], 10, 64)
+		if err != nil {
+			return nil, ErrInvalidStreamEntrId
 		}
 	}
 
-	return &StreamEntryId{
+	entryId := &StreamEntryId{
 		MillisTime: millisTime,
 		SequenceNr: sequenceNr,
-	}, nil
+	}
+
+	if entryId.Compare(&minStreamEntryId) == 0 {
+		return nil, ErrStreamEntryIdSmallerThanZero
+	}
+
+	if s.LastId != nil && entryId.Compare(s.LastId) <= 0 {
+		return nil, ErrStreamEntryIdEqualOrSmallerThanTopItem
+	}
+
+	return entryId, nil
+}
+
+// nextAutoId generates the ID of an entry added at nowMillis. IDs never go
+// backwards: if the clock stalls or regresses, the last ID of the stream is
+// incremented instead.
+func (s *Stream) nextAutoId(nowMillis uint64) (*StreamEntryId, error) {
+	if s.LastId == nil || nowMillis > s.LastId.MillisTime {
+		return &StreamEntryId{MillisTime: nowMillis, SequenceNr: 0}, nil
+	}
+
+	next, ok := s.LastId.next()
+	if !ok {
+		return nil, ErrStreamExhausted
+	}
+
+	return next, nil
 }
 
 func (id *StreamEntryId) String() string {
 	return fmt.Sprintf("%d-%d", id.MillisTime, id.SequenceNr)
 }
+
+// Compare returns -1, 0 or 1 depending on whether id sorts before, equal to
+// or after other.
+func (id *StreamEntryId) Compare(other *StreamEntryId) int {
+	switch {
+	case id.MillisTime < other.MillisTime:
+		return -1
+	case id.MillisTime > other.MillisTime:
+		return 1
+	case id.SequenceNr < other.SequenceNr:
+		return -1
+	case id.SequenceNr > other.SequenceNr:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// parseStreamRangeId parses a complete ("<ms>-<seq>") or incomplete ("<ms>")
+// entry ID given as a command argument, filling in defaultSeqNr for a missing
+// sequence number.
+func parseStreamRangeId(id string, defaultSeqNr uint64) (*StreamEntryId, error) {
+	ms, nr, err := parseStreamEntryId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	seqNr := defaultSeqNr
+	if nr != nil {
+		seqNr = *nr
+	}
+
+	return &StreamEntryId{
+		MillisTime: *ms,
+		SequenceNr: seqNr,
+	}, nil
+}
+
+// parseStreamRangeBound parses the start or end of a range given as a command
+// argument. "-" and "+" stand for the smallest and greatest possible IDs, an
+// incomplete start or end ID covers the whole millisecond, and a "(" prefix
+// makes the bound exclusive.
+func parseStreamRangeBound(raw string, isStart bool) (*StreamEntryId, error) {
+	exclusive := strings.HasPrefix(raw, "(")
+	if exclusive {
+		raw = raw[1:]
+	}
+
+	var id *StreamEntryId
+
+	switch raw {
+	case "-", "+":
+		if exclusive {
+			return nil, ErrInvalidStreamIdArg
+		}
+		bound := minStreamEntryId
+		if raw == "+" {
+			bound = maxStreamEntryId
+		}
+		return &bound, nil
+	default:
+		defaultSeqNr := uint64(0)
+		if !isStart {
+			defaultSeqNr = math.MaxUint64
+		}
+
+		parsed, err := parseStreamRangeId(raw, defaultSeqNr)
+		if err != nil {
+			return nil, ErrInvalidStreamIdArg
+		}
+		id = parsed
+	}
+
+	if !exclusive {
+		return id, nil
+	}
+
+	if isStart {
+		next, ok := id.next()
+		if !ok {
+			return nil, ErrInvalidStartIndex
+		}
+		return next, nil
+	}
+
+	prev, ok := id.prev()
+	if !ok {
+		return nil, ErrInvalidEndIndex
+	}
+	return prev, nil
+}
+
+// next returns the smallest ID greater than id, and false if id is already
+// the greatest possible ID.
+func (id *StreamEntryId) next() (*StreamEntryId, bool) {
+	switch {
+	case id.SequenceNr < math.MaxUint64:
+		return &StreamEntryId{MillisTime: id.MillisTime, SequenceNr: id.SequenceNr + 1}, true
+	case id.MillisTime < math.MaxUint64:
+		return &StreamEntryId{MillisTime: id.MillisTime + 1, SequenceNr: 0}, true
+	default:
+		return nil, false
+	}
+}
+
+// prev returns the greatest ID smaller than id, and false if id is already
+// the smallest possible ID.
+func (id *StreamEntryId) prev() (*StreamEntryId, bool) {
+	switch {
+	case id.SequenceNr > 0:
+		return &StreamEntryId{MillisTime: id.MillisTime, SequenceNr: id.SequenceNr - 1}, true
+	case id.MillisTime > 0:
+		return &StreamEntryId{MillisTime: id.MillisTime - 1, SequenceNr: math.MaxUint64}, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// streamGroupEntriesReadUnknown marks a consumer group whose read counter
+// can not be derived, for instance after XGROUP SETID to an arbitrary ID.
+const streamGroupEntriesReadUnknown = -1
+
+type StreamConsumerGroup struct {
+	Name            string
+	LastDeliveredId *StreamEntryId
+	EntriesRead     int
+	Pending         map[StreamEntryId]*StreamPendingEntry
+	Consumers       map[string]*StreamConsumer
+}
+
+type StreamConsumer struct {
+	Name       string
+	SeenTime   time.Time
+	ActiveTime time.Time
+	Pending    map[StreamEntryId]*StreamPendingEntry
+}
+
+// StreamPendingEntry is an entry of a pending entries list (PEL): a message
+// that was delivered to a consumer but not yet acknowledged.
+type StreamPendingEntry struct {
+	ID            StreamEntryId
+	Consumer      *StreamConsumer
+	DeliveryTime  time.Time
+	DeliveryCount int
+}
+
+func NewStreamConsumerGroup(name string, lastDeliveredId *StreamEntryId, entriesRead int) *StreamConsumerGroup {
+	return &StreamConsumerGroup{
+		Name:            name,
+		LastDeliveredId: lastDeliveredId,
+		EntriesRead:     entriesRead,
+		Pending:         make(map[StreamEntryId]*StreamPendingEntry),
+		Consumers:       make(map[string]*StreamConsumer),
+	}
+}
+
+func (s *Stream) findGroup(name string) *StreamConsumerGroup {
+	return s.Groups[name]
+}
+
+// CreateGroup adds a consumer group and reports whether the name was free.
+func (s *Stream) CreateGroup(name string, lastDeliveredId *StreamEntryId, entriesRead int) (*StreamConsumerGroup, bool) {
+	if group, ok := s.Groups[name]; ok {
+		return group, false
+	}
+
+	group := NewStreamConsumerGroup(name, lastDeliveredId, entriesRead)
+	s.Groups[name] = group
+
+	return group, true
+}
+
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, ok := s.Groups[name]; !ok {
+		return false
+	}
+
+	delete(s.Groups, name)
+
+	return true
+}
+
+// sortedGroups returns the consumer groups ordered by name, as Redis keeps
+// them in a radix tree.
+func (s *Stream) sortedGroups() []*StreamConsumerGroup {
+	groups := make([]*StreamConsumerGroup, 0, len(s.Groups))
+	for _, group := range s.Groups {
+		groups = append(groups, group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+
+	return groups
+}
+
+// estimateDistanceFromFirstEverEntry returns the number of entries added to
+// the stream up to and including id, or streamGroupEntriesReadUnknown if
+// deletions make that impossible to tell.
+func (s *Stream) estimateDistanceFromFirstEverEntry(id *StreamEntryId) int {
+	if s.EntriesAdded == 0 {
+		return 0
+	}
+
+	if s.isEmpty() && (s.LastId == nil || id.Compare(s.LastId) <= 0) {
+		return s.EntriesAdded
+	}
+
+	if s.LastId != nil {
+		switch id.Compare(s.LastId) {
+		case 0:
+			return s.EntriesAdded
+		case 1:
+			return streamGroupEntriesReadUnknown
+		}
+	}
+
+	if s.isEmpty() {
+		return streamGroupEntriesReadUnknown
+	}
+
+	firstId := s.firstEntryId()
+	if s.MaxDeletedEntryId == nil || s.MaxDeletedEntryId.Compare(firstId) < 0 {
+		switch id.Compare(firstId) {
+		case -1:
+			return s.EntriesAdded - s.Len()
+		case 0:
+			return s.EntriesAdded - s.Len() + 1
+		}
+	}
+
+	return streamGroupEntriesReadUnknown
+}
+
+// hasTombstonesAfter reports whether entries newer than id may have been
+// deleted, which makes incremental read counting unreliable.
+func (s *Stream) hasTombstonesAfter(id *StreamEntryId) bool {
+	if s.isEmpty() || s.MaxDeletedEntryId == nil {
+		return false
+	}
+	return s.MaxDeletedEntryId.Compare(id) >= 0
+}
+
+// markDelivered advances the group's last delivered ID and read counter past
+// an entry handed out with the special ">" ID.
+func (g *StreamConsumerGroup) markDelivered(stream *Stream, id *StreamEntryId) {
+	if id.Compare(g.LastDeliveredId) <= 0 {
+		return
+	}
+
+	if g.EntriesRead != streamGroupEntriesReadUnknown && !stream.hasTombstonesAfter(id) {
+		g.EntriesRead++
+	} else if stream.EntriesAdded > 0 {
+		g.EntriesRead = stream.estimateDistanceFromFirstEverEntry(id)
+	}
+
+	g.LastDeliveredId = id
+}
+
+// lag returns the number of entries in the stream the group has yet to
+// read, and false if deletions make it impossible to tell.
+func (g *StreamConsumerGroup) lag(stream *Stream) (int, bool) {
+	if stream.EntriesAdded == 0 {
+		return 0, true
+	}
+
+	if g.EntriesRead != streamGroupEntriesReadUnknown && !stream.hasTombstonesAfter(g.LastDeliveredId) {
+		return stream.EntriesAdded - g.EntriesRead, true
+	}
+
+	entriesRead := stream.estimateDistanceFromFirstEverEntry(g.LastDeliveredId)
+	if entriesRead == streamGroupEntriesReadUnknown {
+		return 0, false
+	}
+
+	return stream.EntriesAdded - entriesRead, true
+}
+
+func (g *StreamConsumerGroup) findConsumer(name string) *StreamConsumer {
+	return g.Consumers[name]
+}
+
+// CreateConsumer adds a consumer and reports whether it did not exist yet.
+func (g *StreamConsumerGroup) CreateConsumer(name string) (*StreamConsumer, bool) {
+	if consumer, ok := g.Consumers[name]; ok {
+		return consumer, false
+	}
+
+	now := time.Now().UTC()
+	consumer := &StreamConsumer{
+		Name:     name,
+		SeenTime: now,
+		Pending:  make(map[StreamEntryId]*StreamPendingEntry),
+	}
+	g.Consumers[name] = consumer
+
+	return consumer, true
+}
+
+// DeleteConsumer removes a consumer together with its pending entries and
+// returns how many entries were pending, or -1 if there was no consumer.
+func (g *StreamConsumerGroup) DeleteConsumer(name string) int {
+	consumer, ok := g.Consumers[name]
+	if !ok {
+		return -1
+	}
+
+	for id := range consumer.Pending {
+		delete(g.Pending, id)
+	}
+	delete(g.Consumers, name)
+
+	return len(consumer.Pending)
+}
+
+// deliver records that the entry with the given ID was delivered to a
+// consumer, creating or updating its PEL entry.
+func (g *StreamConsumerGroup) deliver(id StreamEntryId, consumer *StreamConsumer, now time.Time) {
+	pending, ok := g.Pending[id]
+	if !ok {
+		pending = &StreamPendingEntry{ID: id}
+		g.Pending[id] = pending
+	}
+
+	g.assign(pending, consumer)
+	pending.DeliveryTime = now
+	pending.DeliveryCount++
+}
+
+// assign moves a pending entry to the PEL of a consumer.
+func (g *StreamConsumerGroup) assign(pending *StreamPendingEntry, consumer *StreamConsumer) {
+	if pending.Consumer != nil && pending.Consumer != consumer {
+		delete(pending.Consumer.Pending, pending.ID)
+	}
+
+	pending.Consumer = consumer
+	consumer.Pending[pending.ID] = pending
+}
+
+// Ack removes an entry from the PEL and reports whether it was pending.
+func (g *StreamConsumerGroup) Ack(id StreamEntryId) bool {
+	pending, ok := g.Pending[id]
+	if !ok {
+		return false
+	}
+
+	delete(pending.Consumer.Pending, id)
+	delete(g.Pending, id)
+
+	return true
+}
+
+func (g *StreamConsumerGroup) sortedPending() []*StreamPendingEntry {
+	return sortPendingEntries(g.Pending)
+}
+
+// sortedConsumers returns the consumers of the group ordered by name.
+func (g *StreamConsumerGroup) sortedConsumers() []*StreamConsumer {
+	consumers := make([]*StreamConsumer, 0, len(g.Consumers))
+	for _, consumer := range g.Consumers {
+		consumers = append(consumers, consumer)
+	}
+
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+
+	return consumers
+}
+
+func (c *StreamConsumer) sortedPending() []*StreamPendingEntry {
+	return sortPendingEntries(c.Pending)
+}
+
+// touch records that the consumer tried to read (seen) and, if it actually
+// got something, was active at now.
+func (c *StreamConsumer) touch(now time.Time, active bool) {
+	c.SeenTime = now
+	if active {
+		c.ActiveTime = now
+	}
+}
+
+func sortPendingEntries(pel map[StreamEntryId]*StreamPendingEntry) []*StreamPendingEntry {
+	entries := make([]*StreamPendingEntry, 0, len(pel))
+	for _, pending := range pel {
+		entries = append(entries, pending)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID.Compare(&entries[j].ID) < 0
+	})
+
+	return entries
+}
+
+func (p *StreamPendingEntry) idle(now time.Time) int {
+	idle := now.Sub(p.DeliveryTime).Milliseconds()
+	if idle < 0 {
+		return 0
+	}
+	return int(idle)
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/binary"
+
+	"github.com/codecrafters-io/redis-starter-go/app/internal/storage/listpack"
+)
+
+// Streams are stored like Redis does: a radix tree indexed by the ID of the
+// first entry of each node (the master ID), where every node is a listpack
+// holding up to streamNodeMaxEntries entries.
+//
+// A node starts with a master entry holding the number of valid and deleted
+// entries and the field names of the first entry added to it:
+//
+//	count | deleted | num-fields | field_1 | ... | field_N | 0
+//
+// Every entry then stores its ID as a delta from the master ID. Entries with
+// exactly the master fields only store their values:
+//
+//	flags | ms-diff | seq-diff | num-fields | field_1 | value_1 | ... | lp-count
+//	flags | ms-diff | seq-diff | value_1 | ... | value_N | lp-count  (SAMEFIELDS)
+//
+// lp-count is the number of listpack elements of the entry before it, which
+// allows walking a node backwards. Deleted entries are only flagged, and the
+// node is dropped once all of its entries are deleted.
+const (
+	streamNodeMaxBytes   = 4096
+	streamNodeMaxEntries = 100
+
+	streamItemFlagNone       = 0
+	streamItemFlagDeleted    = 1
+	streamItemFlagSameFields = 2
+)
+
+type streamNode struct {
+	lp       *listpack.Listpack
+	masterId StreamEntryId
+}
+
+// streamNodeEntry locates an entry inside a node.
+type streamNodeEntry struct {
+	id      StreamEntryId
+	offset  int
+	deleted bool
+}
+
+func newStreamNode(masterId StreamEntryId, fields []string) *streamNode {
+	lp := listpack.New()
+	lp.AppendInt(0)
+	lp.AppendInt(0)
+	lp.AppendInt(int64(len(fields)))
+	for _, field := range fields {
+		lp.AppendString(field)
+	}
+	lp.AppendInt(0)
+
+	return &streamNode{
+		lp:       lp,
+		masterId: masterId,
+	}
+}
+
+// raxKey encodes an ID as the 128-bit big endian key used to index stream
+// nodes, so that the byte order of keys matches the order of IDs.
+func (id *StreamEntryId) raxKey() []byte {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, id.MillisTime)
+	binary.BigEndian.PutUint64(key[8:], id.SequenceNr)
+	return key
+}
+
+func streamIdFromRaxKey(key []byte) StreamEntryId {
+	return StreamEntryId{
+		MillisTime: binary.BigEndian.Uint64(key),
+		SequenceNr: binary.BigEndian.Uint64(key[8:]),
+	}
+}
+
+func (n *streamNode) count() int {
+	v, _ := n.lp.GetInt(n.lp.Seek(0))
+	return int(v)
+}
+
+func (n *streamNode) deleted() int {
+	v, _ := n.lp.GetInt(n.lp.Seek(1))
+	return int(v)
+}
+
+// isFull reports whether a new entry has to go into a new node.
+func (n *streamNode) isFull() bool {
+	return n.lp.Size() >= streamNodeMaxBytes || n.count()+n.deleted() >= streamNodeMaxEntries
+}
+
+func (n *streamNode) masterFields() []string {
+	off := n.lp.Seek(2)
+	numFields, _ := n.lp.GetInt(off)
+
+	fields := make([]string, 0, numFields)
+	for i := int64(0); i < numFields; i++ {
+		off = n.lp.Next(off)
+		fields = append(fields, n.lp.Get(off).String())
+	}
+
+	return fields
+}
+
+// firstEntryOffset returns the offset of the flags of the first entry, right
+// after the master entry.
+func (n *streamNode) firstEntryOffset() int {
+	off := n.lp.Seek(2)
+	numFields, _ := n.lp.GetInt(off)
+	for i := int64(0); i <= numFields+1; i++ {
+		off = n.lp.Next(off)
+	}
+	return off
+}
+
+// append adds an entry to the node, keeping its fields in the given order.
+// The entry only stores its values if its fields match the master fields.
+func (n *streamNode) append(id StreamEntryId, fields, values []string) {
+	masterFields := n.masterFields()
+	sameFields := len(fields) == len(masterFields)
+	for i := 0; sameFields && i < len(fields); i++ {
+		sameFields = fields[i] == masterFields[i]
+	}
+
+	flags := int64(streamItemFlagNone)
+	if sameFields {
+		flags |= streamItemFlagSameFields
+	}
+
+	n.lp.AppendInt(flags)
+	// Deltas are stored as signed integers and wrap around, so they decode
+	// back to the same unsigned ID even when they overflow an int64.
+	n.lp.AppendInt(int64(id.MillisTime - n.masterId.MillisTime))
+	n.lp.AppendInt(int64(id.SequenceNr - n.masterId.SequenceNr))
+
+	lpCount := int64(3 + len(values))
+	if sameFields {
+		for _, val := range values {
+			n.lp.AppendString(val)
+		}
+	} else {
+		n.lp.AppendInt(int64(len(fields)))
+		for i := range fields {
+			n.lp.AppendString(fields[i])
+			n.lp.AppendString(values[i])
+		}
+		lpCount += int64(len(fields)) + 1
+	}
+	n.lp.AppendInt(lpCount)
+
+	n.lp.ReplaceInt(n.lp.Seek(0), int64(n.count()+1))
+}
+
+// entries lists the entries of the node in ID order, deleted ones included.
+func (n *streamNode) entries() []streamNodeEntry {
+	numMasterFields := len(n.masterFields())
+	result := make([]streamNodeEntry, 0, n.count()+n.deleted())
+
+	for off := n.firstEntryOffset(); off >= 0; {
+		flags, _ := n.lp.GetInt(off)
+		msOff := n.lp.Next(off)
+		msDiff, _ := n.lp.GetInt(msOff)
+		seqOff := n.lp.Next(msOff)
+		seqDiff, _ := n.lp.GetInt(seqOff)
+
+		result = append(result, streamNodeEntry{
+			id: StreamEntryId{
+				MillisTime: n.masterId.MillisTime + uint64(msDiff),
+				SequenceNr: n.masterId.SequenceNr + uint64(seqDiff),
+			},
+			offset:  off,
+			deleted: flags&streamItemFlagDeleted != 0,
+		})
+
+		next := n.lp.Next(seqOff)
+		skip := numMasterFields
+		if flags&streamItemFlagSameFields == 0 {
+			numFields, _ := n.lp.GetInt(next)
+			skip = int(numFields)*2 + 1
+		}
+		for i := 0; i <= skip && next >= 0; i++ {
+			next = n.lp.Next(next)
+		}
+		off = next
+	}
+
+	return result
+}
+
+// read decodes the entry located at e.
+func (n *streamNode) read(e streamNodeEntry) *StreamEntry {
+	flags, _ := n.lp.GetInt(e.offset)
+	off := n.lp.Next(n.lp.Next(n.lp.Next(e.offset)))
+
+	id := e.id
+	entry := &StreamEntry{
+		ID: &id,
+	}
+
+	if flags&streamItemFlagSameFields != 0 {
+		for _, field := range n.masterFields() {
+			entry.AddData(field, n.lp.Get(off).String())
+			off = n.lp.Next(off)
+		}
+		return entry
+	}
+
+	numFields, _ := n.lp.GetInt(off)
+	for i := int64(0); i < numFields; i++ {
+		off = n.lp.Next(off)
+		field := n.lp.Get(off).String()
+		off = n.lp.Next(off)
+		entry.AddData(field, n.lp.Get(off).String())
+	}
+
+	return entry
+}
+
+// markDeleted flags the entry located at e as deleted and updates the
+// counters of the master entry. Offsets of entries may change afterwards.
+func (n *streamNode) markDeleted(e streamNodeEntry) {
+	flags, _ := n.lp.GetInt(e.offset)
+	n.lp.ReplaceInt(e.offset, flags|streamItemFlagDeleted)
+
+	count, deleted := n.count(), n.deleted()
+	n.lp.ReplaceInt(n.lp.Seek(1), int64(deleted+1))
+	n.lp.ReplaceInt(n.lp.Seek(0), int64(count-1))
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	streamTrimMaxLen = "maxlen"
+	streamTrimMinId  = "minid"
+
+	// streamTrimDefaultLimit caps how many entries an approximate trim may
+	// evict in one go when no LIMIT is given, mirroring Redis' default of
+	// 100 * stream-node-max-entries.
+	streamTrimDefaultLimit = 100 * 100
+)
+
+var (
+	ErrSyntax               = errors.New("syntax error")
+	ErrStreamTrimLimitExact = errors.New("syntax error, LIMIT cannot be used without the special ~ option")
+	ErrStreamTrimMaxLen     = errors.New("The MAXLEN argument must be >= 0.")
+	ErrStreamTrimLimit      = errors.New("The LIMIT argument must be >= 0.")
+)
+
+type streamTrimOptions struct {
+	strategy    string
+	approximate bool
+	maxLen      int
+	minId       *StreamEntryId
+	limit       int
+}
+
+// parseStreamTrimOptions parses "MAXLEN|MINID [=|~] threshold [LIMIT count]"
+// starting at args[0] and returns the number of arguments consumed.
+func parseStreamTrimOptions(args []string) (*streamTrimOptions, int, error) {
+	opts := &streamTrimOptions{
+		strategy: strings.ToLower(args[0]),
+	}
+	idx := 1
+
+	if idx < len(args) && (args[idx] == "=" || args[idx] == "~") {
+		opts.approximate = args[idx] == "~"
+		idx++
+	}
+
+	if idx >= len(args) {
+		return nil, 0, ErrSyntax
+	}
+
+	threshold := args[idx]
+	idx++
+
+	switch opts.strategy {
+	case streamTrimMaxLen:
+		maxLen, err := strconv.Atoi(threshold)
+		if err != nil {
+			return nil, 0, errors.New("value is not an integer or out of range")
+		}
+		if maxLen < 0 {
+			return nil, 0, ErrStreamTrimMaxLen
+		}
+		opts.maxLen = maxLen
+	case streamTrimMinId:
+		minId, err := parseStreamRangeId(threshold, 0)
+		if err != nil {
+			return nil, 0, ErrInvalidStreamIdArg
+		}
+		opts.minId = minId
+	default:
+		return nil, 0, ErrSyntax
+	}
+
+	if idx+1 < len(args) && strings.EqualFold(args[idx], "limit") {
+		limit, err := strconv.Atoi(args[idx+1])
+		if err != nil {
+			return nil, 0, errors.New("value is not an integer or out of range")
+		}
+		if limit < 0 {
+			return nil, 0, ErrStreamTrimLimit
+		}
+		if !opts.approximate {
+			return nil, 0, ErrStreamTrimLimitExact
+		}
+		opts.limit = limit
+		idx += 2
+	} else if opts.approximate {
+		opts.limit = streamTrimDefaultLimit
+	}
+
+	return opts, idx, nil
+}
+
+// trim evicts entries from the head of the stream according to opts and
+// returns how many were removed. Whole nodes are dropped from the radix tree
+// while possible; only an exact trim then deletes single entries from the
+// first remaining node. A limit of 0 on an approximate trim means no limit.
+func (s *Stream) trim(opts *streamTrimOptions) int {
+	trimmed := 0
+
+	for {
+		key, val, ok := s.index.First()
+		if !ok {
+			break
+		}
+
+		node := val.(*streamNode)
+		entries := node.entries()
+		count := node.count()
+
+		if opts.approximate && opts.limit > 0 && trimmed+count > opts.limit {
+			break
+		}
+
+		var removeNode bool
+		switch opts.strategy {
+		case streamTrimMaxLen:
+			removeNode = s.length-count >= opts.maxLen
+		case streamTrimMinId:
+			removeNode = entries[len(entries)-1].id.Compare(opts.minId) < 0
+		}
+
+		if removeNode {
+			s.index.Remove(key)
+			s.length -= count
+			trimmed += count
+			continue
+		}
+
+		if opts.approximate {
+			break
+		}
+
+		for {
+			e, found := firstLiveEntry(node.entries())
+			if !found {
+				break
+			}
+
+			if opts.strategy == streamTrimMaxLen && s.length <= opts.maxLen {
+				break
+			}
+			if opts.strategy == streamTrimMinId && e.id.Compare(opts.minId) >= 0 {
+				break
+			}
+
+			node.markDeleted(e)
+			s.length--
+			trimmed++
+		}
+
+		if node.count() == 0 {
+			s.index.Remove(key)
+		}
+
+		break
+	}
+
+	return trimmed
+}
+
+func firstLiveEntry(entries []streamNodeEntry) (streamNodeEntry, bool) {
+	for _, e := range entries {
+		if !e.deleted {
+			return e, true
+		}
+	}
+	return streamNodeEntry{}, false
+}
@@ -1,20 +1,114 @@
 package main
 
+import (
+	"sync"
+	"time"
+)
+
 type Streams struct {
-	Streams        []*Stream
-	EntryAddedChan chan bool
-	IsBlocking     bool
+	// Streams maps the key of every stream to it. Keys are shared with the
+	// rest of the keyspace, so a key is either here or in the data map of
+	// the server, never in both.
+	Streams map[string]*Stream
+
+	waitersMu sync.Mutex
+	// waiters holds, for every stream key, the channels of the clients
+	// blocked on it.
+	waiters map[string][]chan struct{}
 }
 
 func NewStreams() *Streams {
 	return &Streams{
-		Streams:        make([]*Stream, 0),
-		EntryAddedChan: make(chan bool),
+		Streams: make(map[string]*Stream),
+		waiters: make(map[string][]chan struct{}),
+	}
+}
+
+// addWaiter registers a waiter for all given keys. The returned channel is
+// signalled whenever an entry is added to one of them, and must be released
+// with removeWaiter.
+func (s *Streams) addWaiter(keys []string) chan struct{} {
+	ready := make(chan struct{}, 1)
+
+	s.waitersMu.Lock()
+	defer s.waitersMu.Unlock()
+
+	for _, key := range keys {
+		s.waiters[key] = append(s.waiters[key], ready)
+	}
+
+	return ready
+}
+
+func (s *Streams) removeWaiter(keys []string, ready chan struct{}) {
+	s.waitersMu.Lock()
+	defer s.waitersMu.Unlock()
+
+	for _, key := range keys {
+		waiters := s.waiters[key]
+		for i, w := range waiters {
+			if w == ready {
+				waiters = append(waiters[:i], waiters[i+1:]...)
+				break
+			}
+		}
+
+		if len(waiters) == 0 {
+			delete(s.waiters, key)
+		} else {
+			s.waiters[key] = waiters
+		}
+	}
+}
+
+// signalKeyReady wakes up every client blocked on key. It never blocks: a
+// waiter that has not consumed a previous signal yet is simply skipped.
+func (s *Streams) signalKeyReady(key string) {
+	s.waitersMu.Lock()
+	defer s.waitersMu.Unlock()
+
+	for _, ready := range s.waiters[key] {
+		select {
+		case ready <- struct{}{}:
+		default:
+		}
 	}
 }
 
-func (s *Streams) blockAndWaitForEntryAdded() {
-	s.IsBlocking = true
-	<-s.EntryAddedChan
-	s.IsBlocking = false
+// blockUntil calls read every time one of the keys is signalled, until it
+// returns a non-empty result, the timeout expires or disconnected is
+// closed. A timeout of 0 blocks forever. The waiter is registered before
+// the first read so no entry added in between is missed.
+//
+// held is a lock held by the caller, which is released while waiting so that
+// other clients can add entries in the meantime.
+func (s *Streams) blockUntil(keys []string, timeoutMillis int, disconnected <-chan struct{}, held sync.Locker, read func() ([][]byte, error)) ([][]byte, error) {
+	ready := s.addWaiter(keys)
+	defer s.removeWaiter(keys, ready)
+
+	var timeout <-chan time.Time
+	if timeoutMillis > 0 {
+		timer := time.NewTimer(time.Duration(timeoutMillis) * time.Millisecond)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for {
+		result, err := read()
+		if err != nil || len(result) > 0 {
+			return result, err
+		}
+
+		held.Unlock()
+		select {
+		case <-ready:
+		case <-timeout:
+			held.Lock()
+			return nil, nil
+		case <-disconnected:
+			held.Lock()
+			return nil, nil
+		}
+		held.Lock()
+	}
 }
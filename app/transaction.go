@@ -11,6 +11,12 @@ type Transaction struct {
 	Queue  []*command
 	mu     *sync.Mutex
 	isOpen bool
+	// isAborted is set when a command fails to queue, in which case EXEC
+	// discards the whole transaction.
+	isAborted bool
+	// isExecuting is set while EXEC runs the queued commands, which must not
+	// block.
+	isExecuting bool
 }
 
 func NewTransaction(conn net.Conn) *Transaction {
@@ -25,6 +31,10 @@ func (t *Transaction) IsOpen() bool {
 	return t.isOpen
 }
 
+func (t *Transaction) IsAborted() bool {
+	return t.isAborted
+}
+
 func (t *Transaction) Open() error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
@@ -38,13 +48,25 @@ func (t *Transaction) Open() error {
 	return nil
 }
 
+// Abort flags an open transaction as failed. It does nothing outside of a
+// transaction.
+func (t *Transaction) Abort() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.isOpen {
+		t.isAborted = true
+	}
+}
+
 func (t *Transaction) Close() error {
 	t.mu.Lock()
 	defer t.mu.Unlock()
 
 	if t.isOpen {
-		clear(t.Queue)
+		t.Queue = make([]*command, 0)
 		t.isOpen = false
+		t.isAborted = false
 		return nil
 	}
 
@@ -22,6 +22,12 @@ func respAsBulkString(resp string) []byte {
 	return []byte(encoded)
 }
 
+// respAsBinaryBulkString encodes resp as a bulk string even when it is
+// empty, unlike respAsBulkString which encodes "" as a null bulk string.
+func respAsBinaryBulkString(resp string) []byte {
+	return []byte(fmt.Sprintf("$%d%s%s%s", len(resp), carriageReturn(), resp, carriageReturn()))
+}
+
 func respAsSimpleString(resp string) []byte {
 	return []byte(fmt.Sprintf("+%s%s", resp, carriageReturn()))
 }
@@ -39,8 +45,10 @@ func respAsArray(resp []string) ([]byte, error) {
 	encoded = append(encoded, []byte(lenStr)...)
 	encoded = append(encoded, []byte(carriageReturn())...)
 
+	// Elements are binary safe, as commands sent to slaves and to the
+	// append-only file are encoded here and may have empty arguments.
 	for _, r := range resp {
-		encoded = append(encoded, respAsBulkString(r)...)
+		encoded = append(encoded, respAsBinaryBulkString(r)...)
 	}
 
 	return encoded, nil
@@ -86,6 +94,69 @@ func respAsError(err string) []byte {
 	return []byte(errStr)
 }
 
+// isErrorReply reports whether resp is an error reply.
+func isErrorReply(resp []byte) bool {
+	return len(resp) > 0 && resp[0] == '-'
+}
+
+// respAsCodedError encodes an error whose reply starts with a specific error
+// code, such as NOGROUP or BUSYGROUP, instead of the generic ERR.
+func respAsCodedError(code, err string) []byte {
+	return []byte(fmt.Sprint("-", code, " ", err, carriageReturn()))
+}
+
+// respAsEmptyBulkString encodes an empty, non-null bulk string, which
+// respAsBulkString cannot express.
+func respAsEmptyBulkString() []byte {
+	return []byte(fmt.Sprint("$0", carriageReturn(), carriageReturn()))
+}
+
+// respAsPush encodes an out of band message, such as a published message, as
+// a push frame for RESP3 clients and as a plain array for RESP2 clients.
+func respAsPush(protocol int, resps [][]byte) []byte {
+	if protocol < resp3 {
+		encoded, _ := respAsByteArrays(resps)
+		return encoded
+	}
+
+	encoded := []byte(fmt.Sprint(string(push), len(resps), carriageReturn()))
+	for _, r := range resps {
+		encoded = append(encoded, r...)
+	}
+
+	return encoded
+}
+
+// respAsMap encodes alternating keys and values as a map for RESP3 clients
+// and as a flat array for RESP2 clients.
+func respAsMap(protocol int, keysAndValues [][]byte) []byte {
+	if protocol < resp3 {
+		encoded, _ := respAsByteArrays(keysAndValues)
+		return encoded
+	}
+
+	encoded := []byte(fmt.Sprint(string(mapType), len(keysAndValues)/2, carriageReturn()))
+	for _, r := range keysAndValues {
+		encoded = append(encoded, r...)
+	}
+
+	return encoded
+}
+
+func respAsNullArray() []byte {
+	return []byte(fmt.Sprintf("*-1%s", carriageReturn()))
+}
+
+func respAsWrongTypeError() []byte {
+	return []byte(fmt.Sprint("-", errWrongType.Error(), carriageReturn()))
+}
+
+// respAsReadOnlyError is the reply of a slave to a write command that does
+// not come from its master.
+func respAsReadOnlyError() []byte {
+	return respAsCodedError("READONLY", "You can't write against a read only replica.")
+}
+
 func carriageReturn() string {
 	return "\r\n"
 }
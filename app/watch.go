@@ -0,0 +1,145 @@
+package main
+
+// Optimistic locking works like in Redis: every client watching a key is
+// registered in watchedKeys, and any write to that key marks those clients as
+// dirty, which makes their next EXEC fail. Write paths report modified keys
+// through signalModifiedKey.
+
+// watchKeys starts watching keys on behalf of client. Whether each key was
+// already expired is recorded, so that EXEC can tell whether it expired in
+// the meantime.
+func (s *server) watchKeys(client *Client, keys []string) {
+	expired := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		expired[key] = s.isKeyExpired(key)
+	}
+
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+
+	for _, key := range keys {
+		if _, ok := client.watchedKeys[key]; ok {
+			continue
+		}
+
+		client.watchedKeys[key] = expired[key]
+		s.watchedKeys[key] = append(s.watchedKeys[key], client)
+	}
+}
+
+// unwatchAllKeys stops watching every key watched by client and clears its
+// dirty flag.
+func (s *server) unwatchAllKeys(client *Client) {
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+
+	for key := range client.watchedKeys {
+		clients := s.watchedKeys[key]
+		for i, c := range clients {
+			if c == client {
+				clients = append(clients[:i], clients[i+1:]...)
+				break
+			}
+		}
+
+		if len(clients) == 0 {
+			delete(s.watchedKeys, key)
+		} else {
+			s.watchedKeys[key] = clients
+		}
+	}
+
+	clear(client.watchedKeys)
+	client.dirtyCAS = false
+}
+
+// signalModifiedKey marks every client watching key as dirty, and counts the
+// change for the save rules. It must be called by every command that
+// modifies a key.
+func (s *server) signalModifiedKey(key string) {
+	s.persistence.dirty.Add(1)
+
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+
+	for _, client := range s.watchedKeys[key] {
+		client.dirtyCAS = true
+	}
+}
+
+// signalExpiredKey marks as dirty every client watching key, unless it was
+// already expired when watched. It must be called when an expired key is
+// deleted, since isTransactionDirty cannot tell it expired afterwards.
+func (s *server) signalExpiredKey(key string) {
+	s.persistence.dirty.Add(1)
+
+	s.watchMu.Lock()
+	defer s.watchMu.Unlock()
+
+	for _, client := range s.watchedKeys[key] {
+		if !client.watchedKeys[key] {
+			client.dirtyCAS = true
+		}
+	}
+}
+
+// signalFlushedDb marks as dirty every client watching a key that existed
+// before the dataset was flushed. It must be called before the flush.
+func (s *server) signalFlushedDb() {
+	s.watchMu.Lock()
+	keys := make([]string, 0, len(s.watchedKeys))
+	for key := range s.watchedKeys {
+		keys = append(keys, key)
+	}
+	s.watchMu.Unlock()
+
+	for _, key := range keys {
+		if s.keyExists(key) {
+			s.signalModifiedKey(key)
+		}
+	}
+}
+
+// isTransactionDirty reports whether EXEC must fail for client, either
+// because a watched key was modified or because it expired since it was
+// watched.
+func (s *server) isTransactionDirty(client *Client) bool {
+	s.watchMu.Lock()
+	if client.dirtyCAS {
+		s.watchMu.Unlock()
+		return true
+	}
+	watched := make(map[string]bool, len(client.watchedKeys))
+	for key, expired := range client.watchedKeys {
+		watched[key] = expired
+	}
+	s.watchMu.Unlock()
+
+	for key, expiredWhenWatched := range watched {
+		if !expiredWhenWatched && s.isKeyExpired(key) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isKeyExpired reports whether key is still stored but logically expired.
+func (s *server) isKeyExpired(key string) bool {
+	s.dataMu.RLock()
+	defer s.dataMu.RUnlock()
+
+	expVal, ok := s.data[key]
+	return ok && expVal.HasExpired()
+}
+
+func (s *server) keyExists(key string) bool {
+	s.dataMu.RLock()
+	defer s.dataMu.RUnlock()
+
+	if expVal, ok := s.data[key]; ok && !expVal.HasExpired() {
+		return true
+	}
+
+	return s.isStream(key)
+}